@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	mainbiz "my-source/sheet-payment/be/biz"
+	"my-source/sheet-payment/be/config"
+	"my-source/sheet-payment/be/repository"
+)
+
+const auditUsage = "usage: audit verify"
+
+// runAudit handles `audit verify`: it walks the hash chains, prints the first
+// broken link of each and exits with status 1 when there is one.
+func runAudit(args []string) {
+	if len(args) != 1 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, auditUsage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	db, driver := repository.OpenDB(cfg.DatabaseURL)
+	defer db.Close()
+
+	q := repository.Bind(db, driver)
+	report, err := mainbiz.NewAuditor(repository.NewLedgerRepository(q), repository.NewLogRepository(q)).Verify()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, chain := range report.Chains {
+		if b := chain.Broken; b != nil {
+			fmt.Printf("%s\tbroken at seq %d (id %s): %s\n", chain.Chain, b.Seq, b.ID, b.Reason)
+			continue
+		}
+		fmt.Printf("%s\tok, %d entries, head %s\n", chain.Chain, chain.Entries, chain.Head)
+	}
+	if !report.OK {
+		os.Exit(1)
+	}
+}
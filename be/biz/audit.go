@@ -0,0 +1,50 @@
+package mainbiz
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"my-source/sheet-payment/be/repository"
+)
+
+// AuditReport is the result of walking every hash chain. OK is false when
+// any chain has a broken link or entries from before chaining began.
+type AuditReport struct {
+	VerifiedAt time.Time                `json:"verified_at"`
+	OK         bool                     `json:"ok"`
+	Chains     []repository.ChainReport `json:"chains"`
+}
+
+// Auditor verifies the hash chains of the ledger and the audit log, which
+// show whether rows were edited or deleted outside the application.
+type Auditor struct {
+	ledger repository.ILedgerRepository
+	logs   repository.ILogging
+}
+
+func NewAuditor(ledger repository.ILedgerRepository, logs repository.ILogging) *Auditor {
+	return &Auditor{ledger: ledger, logs: logs}
+}
+
+// Verify walks each chain and reports its first broken link and the entries
+// it could not verify.
+func (a *Auditor) Verify() (AuditReport, error) {
+	report := AuditReport{VerifiedAt: time.Now(), OK: true}
+	for _, verify := range []func() (repository.ChainReport, error){a.ledger.Verify, a.logs.Verify} {
+		chain, err := verify()
+		if err != nil {
+			return report, err
+		}
+		report.OK = report.OK && chain.Broken == nil && chain.Unverified == 0
+		report.Chains = append(report.Chains, chain)
+	}
+	return report, nil
+}
+
+func (a *Auditor) VerifyChains(c *fiber.Ctx) error {
+	report, err := a.Verify()
+	if err != nil {
+		return err
+	}
+	return c.JSON(report)
+}
@@ -0,0 +1,33 @@
+package mainbiz
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"my-source/sheet-payment/be/repository"
+	"my-source/sheet-payment/be/repository/memory"
+)
+
+func TestVerifyChains(t *testing.T) {
+	f := newFixture(t)
+	f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+		"amount": 300, "payer": f.ids["Alice"], "split_mode": "equal",
+		"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1, "Carol": 1}),
+	}, fiber.StatusOK)
+	logs := memory.NewLogRepository(f.store)
+	if err := logs.Write(repository.UserLog{Username: "alice", Method: "POST", Path: "/blocks"}); err != nil {
+		t.Fatal(err)
+	}
+	f.app.Get("/admin/audit/verify", NewAuditor(memory.NewLedgerRepository(f.store), logs).VerifyChains)
+
+	var report AuditReport
+	f.decode(f.expect("GET", "/admin/audit/verify", nil, fiber.StatusOK), &report)
+	if !report.OK || len(report.Chains) != 2 {
+		t.Fatalf("report = %+v, want two intact chains", report)
+	}
+	for _, chain := range report.Chains {
+		if chain.Entries == 0 || chain.Head == "" {
+			t.Errorf("%s chain = %+v, want its entries verified", chain.Chain, chain)
+		}
+	}
+}
@@ -6,20 +6,28 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"golang.org/x/crypto/bcrypt"
 
-	jwt "github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
 	"my-source/sheet-payment/be/repository"
 )
 
-var JwtSecret = []byte("j7akAxU")
-
+// AuthHandler signs access tokens with Secret that expire after TokenTTL,
+// and hands out refresh tokens that last RefreshTTL.
 type AuthHandler struct {
-	UserRepo repository.IUserRepository
+	UserRepo   repository.IUserRepository
+	TokenRepo  repository.ITokenRepository
+	Secret     []byte
+	TokenTTL   time.Duration
+	RefreshTTL time.Duration
 }
 
-func NewAuthHandler(usr repository.IUserRepository) *AuthHandler {
+func NewAuthHandler(usr repository.IUserRepository, tokens repository.ITokenRepository, secret []byte,
+	ttl, refreshTTL time.Duration) *AuthHandler {
 	return &AuthHandler{
-		UserRepo: usr,
+		UserRepo:   usr,
+		TokenRepo:  tokens,
+		Secret:     secret,
+		TokenTTL:   ttl,
+		RefreshTTL: refreshTTL,
 	}
 }
 
@@ -39,10 +47,20 @@ func (h *AuthHandler) Register(c *fiber.Ctx) error {
 		return fiber.ErrInternalServerError
 	}
 
+	// The first user of a new instance administers it; everyone after
+	// starts as a viewer until an admin grants more.
+	role := repository.RoleViewer
+	if users, err := h.UserRepo.GetAll(); err != nil {
+		return fiber.ErrInternalServerError
+	} else if len(users) == 0 {
+		role = repository.RoleAdmin
+	}
+
 	user := &repository.User{
 		ID:       uuid.New().String(),
 		Username: body.Username,
 		Password: string(hashed),
+		Role:     role,
 	}
 
 	if err := h.UserRepo.Create(user); err != nil {
@@ -66,15 +84,13 @@ func (h *AuthHandler) Login(c *fiber.Ctx) error {
 		return fiber.ErrUnauthorized
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": user.Username,
-		"exp":      time.Now().Add(time.Hour * 24).Unix(),
-	})
-
-	tokenStr, err := token.SignedString(JwtSecret)
+	// Each login starts a new family of refresh tokens.
+	tokens, refresh, err := h.issue(user, uuid.New().String())
 	if err != nil {
 		return fiber.ErrInternalServerError
 	}
-
-	return c.JSON(fiber.Map{"token": tokenStr})
+	if err := h.TokenRepo.CreateRefreshToken(refresh); err != nil {
+		return fiber.ErrInternalServerError
+	}
+	return c.JSON(tokens)
 }
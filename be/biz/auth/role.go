@@ -0,0 +1,102 @@
+package authenhandler
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"my-source/sheet-payment/be/repository"
+)
+
+// ClaimsKey holds the verified claims of the request's access token, set by
+// RejectRevoked.
+const ClaimsKey = "claims"
+
+// RoleAtLeast reports whether role grants everything min does.
+func RoleAtLeast(role, min string) bool {
+	have, want := slices.Index(repository.Roles, role), slices.Index(repository.Roles, min)
+	return have >= 0 && want >= 0 && have >= want
+}
+
+// RequireRole lets the request through when the access token's role is min
+// or a more privileged one. It runs after RejectRevoked.
+func RequireRole(min string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, ok := c.Locals(ClaimsKey).(jwt.MapClaims)
+		if !ok {
+			return unauthorized(c)
+		}
+		if role, _ := claims["role"].(string); !RoleAtLeast(role, min) {
+			return fiber.NewError(fiber.StatusForbidden, "requires the "+min+" role")
+		}
+		return c.Next()
+	}
+}
+
+// Username returns the user named by the request's access token, or "" when
+// RejectRevoked has not run.
+func Username(c *fiber.Ctx) string {
+	claims, _ := c.Locals(ClaimsKey).(jwt.MapClaims)
+	username, _ := claims["username"].(string)
+	return username
+}
+
+// UserInfo is a user as shown to admins.
+type UserInfo struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type RoleRequest struct {
+	Role string `json:"role"`
+}
+
+func (h *AuthHandler) GetUsers(c *fiber.Ctx) error {
+	users, err := h.UserRepo.GetAll()
+	if err != nil {
+		return err
+	}
+	infos := make([]UserInfo, len(users))
+	for i, u := range users {
+		infos[i] = UserInfo{Username: u.Username, Role: u.Role}
+	}
+	return c.JSON(infos)
+}
+
+// SetRole changes the role of the user named in the path. The user's
+// current access token keeps its role until it is refreshed.
+func (h *AuthHandler) SetRole(c *fiber.Ctx) error {
+	var body RoleRequest
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.ErrBadRequest
+	}
+	if !slices.Contains(repository.Roles, body.Role) {
+		return fiber.NewError(fiber.StatusBadRequest, "unknown role "+body.Role)
+	}
+	// Keep at least one admin, or nobody could appoint another.
+	users, err := h.UserRepo.GetAll()
+	if err != nil {
+		return err
+	}
+	admins, demoted := 0, false
+	for _, u := range users {
+		if u.Role == repository.RoleAdmin {
+			admins++
+			demoted = demoted || u.Username == c.Params("username")
+		}
+	}
+	if demoted && admins == 1 && body.Role != repository.RoleAdmin {
+		return fiber.NewError(fiber.StatusConflict, "cannot demote the last admin")
+	}
+
+	err = h.UserRepo.SetRole(c.Params("username"), body.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(UserInfo{Username: c.Params("username"), Role: body.Role})
+}
@@ -0,0 +1,38 @@
+package authenhandler
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"my-source/sheet-payment/be/repository"
+)
+
+func TestRoles(t *testing.T) {
+	f := newAuthFixture(t)
+	f.expect("POST", "/register", "", map[string]string{"username": "bob", "password": "pw"}, fiber.StatusOK)
+
+	// The first user to register is the admin, later ones are viewers.
+	admin, viewer := f.login(), f.loginAs("bob")
+	if admin.Role != repository.RoleAdmin || viewer.Role != repository.RoleViewer {
+		t.Fatalf("roles = %q, %q", admin.Role, viewer.Role)
+	}
+	f.expect("GET", "/ping", viewer.Token, nil, fiber.StatusOK)
+	f.expect("POST", "/edit", viewer.Token, nil, fiber.StatusForbidden)
+	f.expect("GET", "/admin/users", viewer.Token, nil, fiber.StatusForbidden)
+	f.expect("POST", "/edit", admin.Token, nil, fiber.StatusOK)
+
+	// A promotion applies from the next refresh.
+	f.expect("PUT", "/admin/users/bob/role", admin.Token, RoleRequest{Role: repository.RoleEditor}, fiber.StatusOK)
+	f.expect("POST", "/edit", viewer.Token, nil, fiber.StatusForbidden)
+	editor := f.tokens(f.refresh(viewer.RefreshToken, fiber.StatusOK))
+	if editor.Role != repository.RoleEditor {
+		t.Fatalf("role after refresh = %q", editor.Role)
+	}
+	f.expect("POST", "/edit", editor.Token, nil, fiber.StatusOK)
+
+	f.expect("PUT", "/admin/users/bob/role", admin.Token, RoleRequest{Role: "owner"}, fiber.StatusBadRequest)
+	f.expect("PUT", "/admin/users/carol/role", admin.Token, RoleRequest{Role: repository.RoleEditor},
+		fiber.StatusNotFound)
+	f.expect("PUT", "/admin/users/alice/role", admin.Token, RoleRequest{Role: repository.RoleEditor},
+		fiber.StatusConflict)
+}
@@ -0,0 +1,222 @@
+package authenhandler
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jwt "github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"my-source/sheet-payment/be/repository"
+)
+
+// TokenResponse is returned by login and refresh. ExpiresIn is the lifetime
+// of the access token in seconds.
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Role         string `json:"role"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+// issue signs an access token for the user and creates a refresh token in
+// family. The refresh token's row is returned for the caller to store.
+func (h *AuthHandler) issue(user *repository.User, family string) (TokenResponse, repository.RefreshToken, error) {
+	now := time.Now()
+	access, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"username": user.Username,
+		"role":     user.Role,
+		"jti":      uuid.New().String(),
+		"iat":      now.Unix(),
+		"exp":      now.Add(h.TokenTTL).Unix(),
+	}).SignedString(h.Secret)
+	if err != nil {
+		return TokenResponse{}, repository.RefreshToken{}, err
+	}
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return TokenResponse{}, repository.RefreshToken{}, err
+	}
+	refresh := base64.RawURLEncoding.EncodeToString(secret)
+
+	return TokenResponse{Token: access, RefreshToken: refresh, ExpiresIn: int64(h.TokenTTL / time.Second),
+			Role: user.Role},
+		repository.RefreshToken{
+			ID:        uuid.New().String(),
+			UserID:    user.ID,
+			FamilyID:  family,
+			TokenHash: hashToken(refresh),
+			ExpiresAt: now.Add(h.RefreshTTL),
+			CreatedAt: now,
+		}, nil
+}
+
+// hashToken is how a refresh token is stored, so a leaked table holds no
+// usable tokens.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Refresh trades a refresh token for a new access token and a new refresh
+// token. A refresh token works once: presenting it again means it was
+// copied, so every token of its family is revoked.
+func (h *AuthHandler) Refresh(c *fiber.Ctx) error {
+	var body RefreshRequest
+	if err := c.BodyParser(&body); err != nil || body.RefreshToken == "" {
+		return fiber.ErrBadRequest
+	}
+
+	old, err := h.TokenRepo.GetRefreshToken(hashToken(body.RefreshToken))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.ErrUnauthorized
+	}
+	if err != nil {
+		return fiber.ErrInternalServerError
+	}
+	if old.RevokedAt != nil {
+		return h.reused(old)
+	}
+	if old.ExpiresAt.Before(time.Now()) {
+		return fiber.NewError(fiber.StatusUnauthorized, "refresh token expired")
+	}
+
+	// The role is read again, so a changed role applies from the next refresh.
+	user, err := h.UserRepo.GetByUsername(old.Username)
+	if err != nil {
+		return fiber.ErrUnauthorized
+	}
+	tokens, next, err := h.issue(user, old.FamilyID)
+	if err != nil {
+		return fiber.ErrInternalServerError
+	}
+	if err := h.TokenRepo.RotateRefreshToken(old.ID, next); errors.Is(err, repository.ErrTokenReused) {
+		return h.reused(old)
+	} else if err != nil {
+		return fiber.ErrInternalServerError
+	}
+	return c.JSON(tokens)
+}
+
+func (h *AuthHandler) reused(token repository.RefreshToken) error {
+	slog.Warn("refresh token reused, revoking its family", "user", token.Username, "family", token.FamilyID)
+	if err := h.TokenRepo.RevokeFamily(token.FamilyID); err != nil {
+		return fiber.ErrInternalServerError
+	}
+	return fiber.NewError(fiber.StatusUnauthorized, "refresh token already used")
+}
+
+// Logout revokes the access token it is called with and, when given, the
+// refresh token of the same user. ?all=true revokes every refresh token of
+// the user, e.g. after a token leaked.
+func (h *AuthHandler) Logout(c *fiber.Ctx) error {
+	claims, err := h.claims(c)
+	if err != nil {
+		return fiber.ErrUnauthorized
+	}
+	username, _ := claims["username"].(string)
+	if jti, _ := claims["jti"].(string); jti != "" {
+		exp, err := claims.GetExpirationTime()
+		if err != nil || exp == nil {
+			return fiber.ErrUnauthorized
+		}
+		if err := h.TokenRepo.Deny(jti, exp.Time); err != nil {
+			return fiber.ErrInternalServerError
+		}
+	}
+
+	var body RefreshRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&body); err != nil {
+			return fiber.ErrBadRequest
+		}
+	}
+	if body.RefreshToken != "" {
+		token, err := h.TokenRepo.GetRefreshToken(hashToken(body.RefreshToken))
+		if err == nil && token.Username == username {
+			err = h.TokenRepo.RevokeFamily(token.FamilyID)
+		}
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return fiber.ErrInternalServerError
+		}
+	}
+	if c.QueryBool("all") {
+		user, err := h.UserRepo.GetByUsername(username)
+		if err != nil {
+			return fiber.ErrUnauthorized
+		}
+		if err := h.TokenRepo.RevokeUserTokens(user.ID); err != nil {
+			return fiber.ErrInternalServerError
+		}
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RejectRevoked runs after jwtware and turns away access tokens on the
+// denylist, and tokens without a jti, which cannot be revoked.
+func (h *AuthHandler) RejectRevoked() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		claims, err := h.claims(c)
+		if err != nil {
+			return unauthorized(c)
+		}
+		jti, _ := claims["jti"].(string)
+		if jti == "" {
+			return unauthorized(c)
+		}
+		denied, err := h.TokenRepo.IsDenied(jti)
+		if err != nil {
+			return fiber.ErrInternalServerError
+		}
+		if denied {
+			return unauthorized(c)
+		}
+		c.Locals(ClaimsKey, claims)
+		return c.Next()
+	}
+}
+
+// unauthorized answers like the jwtware error handler in main.
+func unauthorized(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+		"error":   "unauthorized",
+		"message": "Token is invalid or expired",
+	})
+}
+
+// claims verifies the bearer token of the request and returns its claims.
+func (h *AuthHandler) claims(c *fiber.Ctx) (jwt.MapClaims, error) {
+	tokenStr, ok := strings.CutPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
+	if !ok {
+		return nil, jwt.ErrTokenMalformed
+	}
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenStr, claims, func(*jwt.Token) (any, error) {
+		return h.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	return claims, err
+}
+
+// RunCleanup drops expired refresh tokens and denylist entries every
+// interval until the process exits.
+func (h *AuthHandler) RunCleanup(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if err := h.TokenRepo.PruneExpired(time.Now()); err != nil {
+			slog.Error("token cleanup", "err", err)
+		}
+	}
+}
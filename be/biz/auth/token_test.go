@@ -0,0 +1,132 @@
+package authenhandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jwtware "github.com/gofiber/jwt/v3"
+	"my-source/sheet-payment/be/repository"
+	"my-source/sheet-payment/be/repository/memory"
+)
+
+type authFixture struct {
+	t   *testing.T
+	app *fiber.App
+}
+
+// newAuthFixture serves the auth routes as main does, with /ping behind the
+// same middleware as every protected route.
+func newAuthFixture(t *testing.T) *authFixture {
+	s := memory.NewStore()
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	h := NewAuthHandler(memory.NewUserRepository(s), memory.NewTokenRepository(s), secret, time.Minute, time.Hour)
+
+	app := fiber.New()
+	app.Post("/register", h.Register)
+	app.Post("/login", h.Login)
+	app.Post("/auth/refresh", h.Refresh)
+	protected := app.Group("/", jwtware.New(jwtware.Config{SigningKey: secret}))
+	protected.Use(h.RejectRevoked())
+	protected.Post("/auth/logout", h.Logout)
+	protected.Get("/ping", func(c *fiber.Ctx) error { return c.SendString("pong") })
+	protected.Post("/edit", RequireRole(repository.RoleEditor), func(c *fiber.Ctx) error { return c.SendString("ok") })
+	protected.Get("/admin/users", RequireRole(repository.RoleAdmin), h.GetUsers)
+	protected.Put("/admin/users/:username/role", RequireRole(repository.RoleAdmin), h.SetRole)
+
+	f := &authFixture{t: t, app: app}
+	f.expect("POST", "/register", "", map[string]string{"username": "alice", "password": "pw"}, fiber.StatusOK)
+	return f
+}
+
+func (f *authFixture) expect(method, path, token string, body any, status int) []byte {
+	f.t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := f.app.Test(req, -1)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != status {
+		f.t.Fatalf("%s %s = %d %s, want %d", method, path, resp.StatusCode, got, status)
+	}
+	return got
+}
+
+func (f *authFixture) tokens(data []byte) TokenResponse {
+	f.t.Helper()
+	var tokens TokenResponse
+	if err := json.Unmarshal(data, &tokens); err != nil || tokens.Token == "" || tokens.RefreshToken == "" {
+		f.t.Fatalf("tokens %s: %v", data, err)
+	}
+	return tokens
+}
+
+func (f *authFixture) login() TokenResponse {
+	f.t.Helper()
+	return f.loginAs("alice")
+}
+
+func (f *authFixture) loginAs(username string) TokenResponse {
+	f.t.Helper()
+	return f.tokens(f.expect("POST", "/login", "",
+		map[string]string{"username": username, "password": "pw"}, fiber.StatusOK))
+}
+
+func (f *authFixture) refresh(token string, status int) []byte {
+	f.t.Helper()
+	return f.expect("POST", "/auth/refresh", "", RefreshRequest{RefreshToken: token}, status)
+}
+
+func TestRefreshRotates(t *testing.T) {
+	f := newAuthFixture(t)
+	first := f.login()
+	if first.ExpiresIn != 60 {
+		t.Errorf("expires_in = %d, want 60", first.ExpiresIn)
+	}
+
+	second := f.tokens(f.refresh(first.RefreshToken, fiber.StatusOK))
+	if second.RefreshToken == first.RefreshToken || second.Token == first.Token {
+		t.Fatal("refresh returned the same tokens")
+	}
+	f.expect("GET", "/ping", second.Token, nil, fiber.StatusOK)
+
+	// Replaying the first token revokes the family, including the token
+	// that replaced it.
+	f.refresh(first.RefreshToken, fiber.StatusUnauthorized)
+	f.refresh(second.RefreshToken, fiber.StatusUnauthorized)
+
+	// Other logins are not affected.
+	f.tokens(f.refresh(f.login().RefreshToken, fiber.StatusOK))
+	f.refresh("unknown", fiber.StatusUnauthorized)
+}
+
+func TestLogout(t *testing.T) {
+	f := newAuthFixture(t)
+	session := f.login()
+	other := f.login()
+
+	f.expect("GET", "/ping", session.Token, nil, fiber.StatusOK)
+	f.expect("POST", "/auth/logout", session.Token, RefreshRequest{RefreshToken: session.RefreshToken},
+		fiber.StatusNoContent)
+	f.expect("GET", "/ping", session.Token, nil, fiber.StatusUnauthorized)
+	f.refresh(session.RefreshToken, fiber.StatusUnauthorized)
+
+	// The other session lives until it logs out everywhere.
+	f.expect("GET", "/ping", other.Token, nil, fiber.StatusOK)
+	f.expect("POST", "/auth/logout?all=true", other.Token, nil, fiber.StatusNoContent)
+	f.refresh(other.RefreshToken, fiber.StatusUnauthorized)
+}
@@ -1,40 +1,75 @@
 package mainbiz
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
 	"github.com/google/uuid"
+	authenhandler "my-source/sheet-payment/be/biz/auth"
+	grouphandler "my-source/sheet-payment/be/biz/group"
 	"my-source/sheet-payment/be/repository"
-	"sort"
 	"time"
 )
 
+// MainBusiness serves a group's blocks. Every handler runs after
+// grouphandler.Require and only reaches the rows of the group it chose.
 type MainBusiness struct {
+	groupRepo       repository.IGroupRepository
 	memberRepo      repository.IMemberRepository
 	blockRepo       repository.IBlockRepository
 	transactionRepo repository.ITransactionRepository
+	settlementRepo  repository.ISettlementRepository
+	openingRepo     repository.IOpeningBalanceRepository
+	personRepo      repository.IPersonRepository
+	fxRepo          repository.IFXRateRepository
+	uow             repository.IUnitOfWork
+	allocator       repository.Allocator
 }
 
-func NewMainBusiness(mrb repository.IMemberRepository, brp repository.IBlockRepository,
-	trp repository.ITransactionRepository) *MainBusiness {
+func NewMainBusiness(grp repository.IGroupRepository, mrb repository.IMemberRepository,
+	brp repository.IBlockRepository, trp repository.ITransactionRepository, srp repository.ISettlementRepository,
+	obr repository.IOpeningBalanceRepository, prp repository.IPersonRepository, fxr repository.IFXRateRepository,
+	uow repository.IUnitOfWork, alloc repository.Allocator) *MainBusiness {
 	return &MainBusiness{
+		groupRepo:       grp,
 		memberRepo:      mrb,
 		blockRepo:       brp,
 		transactionRepo: trp,
+		settlementRepo:  srp,
+		openingRepo:     obr,
+		personRepo:      prp,
+		fxRepo:          fxr,
+		uow:             uow,
+		allocator:       alloc,
 	}
 }
 
+// GetAllMembers lists every person once, however many blocks they are in.
 func (mb *MainBusiness) GetAllMembers(c *fiber.Ctx) error {
-	members, err := mb.memberRepo.GetAll()
+	people, err := mb.personRepo.GetAll(grouphandler.GroupID(c))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{})
 	}
 
-	return c.JSON(members)
+	return c.JSON(people)
+}
+
+func (mb *MainBusiness) GetPersonMemberships(c *fiber.Ctx) error {
+	person, err := mb.personRepo.GetByID(grouphandler.GroupID(c), c.Params("id"))
+	if err != nil {
+		return fiber.ErrNotFound
+	}
+
+	memberships, err := mb.memberRepo.GetByPersonID(person.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{})
+	}
+
+	return c.JSON(fiber.Map{"person": person, "memberships": memberships})
 }
 
 func (mb *MainBusiness) GetMembersByLockId(c *fiber.Ctx) error {
 	month := c.Params("month")
-	blockID, _, err := mb.blockRepo.GetIDByMonth(month)
+	blockID, _, err := mb.blockRepo.GetIDByMonth(grouphandler.GroupID(c), month)
 	if err != nil {
 		return err
 	}
@@ -47,10 +82,52 @@ func (mb *MainBusiness) GetMembersByLockId(c *fiber.Ctx) error {
 	return c.JSON(members)
 }
 
+// UpdateMemberRatio changes the member's default ratio, used by transactions
+// that omit ratios. Existing transactions keep the ratios they recorded.
+func (mb *MainBusiness) UpdateMemberRatio(c *fiber.Ctx) error {
+	month := c.Params("month")
+	blockID, locked, err := mb.blockRepo.GetIDByMonth(grouphandler.GroupID(c), month)
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		return fiber.NewError(fiber.StatusForbidden, "Page is block")
+	}
+
+	var body struct {
+		Ratio float64 `json:"ratio"`
+	}
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if body.Ratio < 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "ratio must not be negative")
+	}
+
+	members, err := mb.memberRepo.GetByBlockID(blockID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{})
+	}
+	for _, m := range members {
+		if m.ID != c.Params("id") {
+			continue
+		}
+		if err := mb.memberRepo.UpdateRatio(m.ID, body.Ratio); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{})
+		}
+		m.Ratio = body.Ratio
+		return c.JSON(m)
+	}
+
+	return fiber.ErrNotFound
+}
+
 func (mb *MainBusiness) CreateBlock(c *fiber.Ctx) error {
 	type Req struct {
-		Month   string               `json:"month"`
-		Members []*repository.Member `json:"members"`
+		Month        string               `json:"month"`
+		BaseCurrency string               `json:"base_currency"`
+		Members      []*repository.Member `json:"members"`
 	}
 
 	var req Req
@@ -58,15 +135,29 @@ func (mb *MainBusiness) CreateBlock(c *fiber.Ctx) error {
 		return err
 	}
 
+	if req.BaseCurrency == "" {
+		req.BaseCurrency = repository.DefaultCurrency
+	}
+	if !repository.ValidCurrency(req.BaseCurrency) {
+		return fiber.NewError(fiber.StatusBadRequest, "base_currency must be an ISO-4217 code")
+	}
+
 	id := uuid.New().String()
 	block := repository.Block{
-		ID:      id,
-		Month:   req.Month,
-		Locked:  false,
-		Members: req.Members,
+		ID:           id,
+		GroupID:      grouphandler.GroupID(c),
+		Month:        req.Month,
+		Locked:       false,
+		BaseCurrency: req.BaseCurrency,
+		Members:      req.Members,
 	}
 
-	err := mb.blockRepo.Create(block)
+	err := mb.uow.Do(func(r repository.Repositories) error {
+		if err := resolvePeople(r.People, block.GroupID, block.Members); err != nil {
+			return err
+		}
+		return r.Blocks.Create(block)
+	})
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{})
 	}
@@ -74,18 +165,81 @@ func (mb *MainBusiness) CreateBlock(c *fiber.Ctx) error {
 	return c.JSON(block)
 }
 
+// resolvePeople links each new member to a person: the given person_id when
+// the client sent one, otherwise the person with the same name. Either way the
+// person is one of the group's.
+func resolvePeople(people repository.IPersonRepository, groupID string, members []*repository.Member) error {
+	for _, m := range members {
+		var p repository.Person
+		var err error
+		if m.PersonID != "" {
+			p, err = people.GetByID(groupID, m.PersonID)
+		} else {
+			p, err = people.GetOrCreateByName(groupID, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		m.PersonID = p.ID
+		m.Name = p.Name
+	}
+	return nil
+}
+
+// LockBlock locks the month. With ?require_settled=true it refuses to lock
+// while any member still has a non-zero balance.
 func (mb *MainBusiness) LockBlock(c *fiber.Ctx) error {
 	month := c.Params("month")
-	err := mb.blockRepo.Lock(month)
+	groupID := grouphandler.GroupID(c)
+
+	block, err := mb.blockRepo.GetByMonth(groupID, month)
 	if err != nil {
 		return err
 	}
+
+	// A locked block's balances are final and are what a rollover carries,
+	// so a drifted block is refused with the reconcile report unless
+	// ?repair=true brings it back in line first. The repair, the settled
+	// check and the lock share one unit of work, so a refused lock leaves
+	// the balances as they were.
+	repair := c.QueryBool("repair")
+	report := ReconcileReport{RanAt: time.Now(), Repaired: repair, Discrepancies: []Discrepancy{}}
+	err = mb.uow.Do(func(r repository.Repositories) error {
+		if err := reconcileBlock(r, block, repair, &report); err != nil {
+			return err
+		}
+		if len(report.Discrepancies) > 0 && !repair {
+			return errDrifted
+		}
+
+		if c.QueryBool("require_settled") {
+			members, err := r.Members.GetByBlockID(block.ID)
+			if err != nil {
+				return err
+			}
+			for _, m := range members {
+				if !m.Debt.IsZero() {
+					return fiber.NewError(fiber.StatusConflict, "block has unsettled balances")
+				}
+			}
+		}
+
+		return r.Blocks.Lock(groupID, month)
+	})
+	if errors.Is(err, errDrifted) {
+		logDiscrepancies(report)
+		return c.Status(fiber.StatusConflict).JSON(report)
+	}
+	if err != nil {
+		return err
+	}
+	logDiscrepancies(report)
 	return c.SendString("locked")
 }
 
 func (mb *MainBusiness) UnlockBlock(c *fiber.Ctx) error {
 	month := c.Params("month")
-	err := mb.blockRepo.Unlock(month)
+	err := mb.blockRepo.Unlock(grouphandler.GroupID(c), month)
 	if err != nil {
 		return err
 	}
@@ -94,74 +248,81 @@ func (mb *MainBusiness) UnlockBlock(c *fiber.Ctx) error {
 
 func (mb *MainBusiness) AddTransaction(c *fiber.Ctx) error {
 	month := c.Params("month")
-	blockId, isLock, err := mb.blockRepo.GetIDByMonth(month)
+	block, err := mb.blockRepo.GetByMonth(grouphandler.GroupID(c), month)
 	if err != nil {
 		return err
 	}
+	blockId := block.ID
 
-	if isLock {
+	if block.Locked {
 		return fiber.NewError(fiber.StatusForbidden, "Page is block")
 	}
 
-	type Req struct {
-		Amount      float64            `json:"amount"`
-		Description string             `json:"description"`
-		Payer       string             `json:"payer"`
-		Ratios      map[string]float64 `json:"ratios"`
-	}
-
-	var req Req
+	var req TransactionRequest
 	if err := c.BodyParser(&req); err != nil {
 		return err
 	}
-
-	err = mb.ValidateMemberInMonth(month, req.Ratios, req.Payer)
-	if err != nil {
+	if err := resolveCurrency(&req, block.BaseCurrency); err != nil {
 		return err
 	}
 
-	totalWeight := 0.0
-	for _, w := range req.Ratios {
-		totalWeight += w
-	}
-	if totalWeight == 0 {
-		return fiber.NewError(fiber.StatusBadRequest, "participants weight must be > 0")
-	}
-
-	txID := uuid.New().String()
-	created := time.Now()
-	tx := repository.Transaction{
-		ID:          txID,
-		BlockID:     blockId,
-		Description: req.Description,
-		Amount:      req.Amount,
-		Payer:       req.Payer,
-		Ratios:      req.Ratios,
-		CreatedAt:   created,
+	if err := mb.applyDefaultRatios(blockId, &req); err != nil {
+		return err
 	}
 
-	if err := mb.transactionRepo.Add(tx); err != nil {
+	if err := ValidateSplit(&req); err != nil {
 		return err
 	}
 
 	// Prepare details
-	details := make(map[string]float64)
-	for memberID, weight := range req.Ratios {
-		share := req.Amount * (weight / totalWeight)
-		details[memberID] = share
+	details, ratios, split, err := mb.splitShares(&req)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
 	}
 
-	if err := mb.transactionRepo.AddDetails(txID, details); err != nil {
+	err = mb.ValidateMemberInMonth(block.GroupID, month, ratios, req.Payer)
+	if err != nil {
 		return err
 	}
 
-	// Update debts
-	for memberID, share := range details {
-		if memberID == req.Payer {
-			_ = mb.memberRepo.UpdateDebt(memberID, req.Amount-share)
-		} else {
-			_ = mb.memberRepo.UpdateDebt(memberID, -share)
+	created := time.Now()
+	amount, details, rate, err := mb.toBase(&req, details, block.BaseCurrency, created)
+	if err != nil {
+		return err
+	}
+
+	txID := uuid.New().String()
+	tx := repository.Transaction{
+		ID:               txID,
+		BlockID:          blockId,
+		Description:      req.Description,
+		Amount:           amount,
+		Payer:            req.Payer,
+		Ratios:           ratios,
+		SplitMode:        req.SplitMode,
+		Split:            split,
+		CreatedAt:        created,
+		CreatedBy:        authenhandler.Username(c),
+		OriginalAmount:   req.Amount,
+		OriginalCurrency: req.Amount.Currency,
+		FXRate:           rate,
+	}
+
+	err = mb.uow.Do(func(r repository.Repositories) error {
+		if err := r.Transactions.Add(tx); err != nil {
+			return err
 		}
+
+		if err := r.Transactions.AddDetails(txID, details); err != nil {
+			return err
+		}
+
+		// Update debts
+		return r.Ledger.Post(repository.LedgerEntries(blockId, repository.LedgerTransaction, txID,
+			repository.DebtDeltas(amount, req.Payer, details)))
+	})
+	if err != nil {
+		return err
 	}
 
 	return c.JSON(fiber.Map{"id": txID, "block_id": blockId, "created_at": created})
@@ -169,7 +330,7 @@ func (mb *MainBusiness) AddTransaction(c *fiber.Ctx) error {
 
 func (mb *MainBusiness) GetSummary(c *fiber.Ctx) error {
 	month := c.Params("month")
-	blockID, _, err := mb.blockRepo.GetIDByMonth(month)
+	blockID, _, err := mb.blockRepo.GetIDByMonth(grouphandler.GroupID(c), month)
 	if err != nil {
 		return err
 	}
@@ -181,33 +342,20 @@ func (mb *MainBusiness) GetSummary(c *fiber.Ctx) error {
 	return c.JSON(summary)
 }
 
-func (mb *MainBusiness) GetTransactionsByBlock(c *fiber.Ctx) error {
-	month := c.Params("month")
-	blockID, _, err := mb.blockRepo.GetIDByMonth(month)
-	if err != nil {
-		return nil
-	}
-	txs, err := mb.transactionRepo.GetByBlockID(blockID)
-	sort.Slice(txs, func(i, j int) bool {
-		return txs[i].CreatedAt.After(txs[j].CreatedAt)
-	})
-
-	return c.JSON(txs)
-}
-
 func (mb *MainBusiness) DeleteTransaction(c *fiber.Ctx) error {
 	id := c.Params("id")
-	tx, err := mb.transactionRepo.GetByID(id)
+	groupID := grouphandler.GroupID(c)
+	tx, err := mb.transactionRepo.GetByID(groupID, id)
 	if err != nil {
 		return fiber.NewError(fiber.StatusForbidden, "not found tx")
 	}
 
-	_, err = mb.transactionRepo.GetDetails(id)
+	details, err := mb.transactionRepo.GetDetails(id)
 	if err != nil {
 		return fiber.NewError(fiber.StatusForbidden, "not found tx details")
 	}
 
-	_, lock, er := mb.blockRepo.Get(tx.BlockID)
+	_, lock, er := mb.blockRepo.Get(groupID, tx.BlockID)
 	if er != nil {
 		return fiber.NewError(fiber.StatusForbidden, "not found block")
 	}
@@ -216,31 +364,20 @@ func (mb *MainBusiness) DeleteTransaction(c *fiber.Ctx) error {
 		return fiber.NewError(fiber.StatusForbidden, "locked by this block")
 	}
 
-	// Reverse debts
-	totalWeight := 0.0
-	for _, w := range tx.Ratios {
-		totalWeight += w
-	}
-
-	for memberID, weight := range tx.Ratios {
-		share := tx.Amount * (weight / totalWeight)
-		if memberID == tx.Payer {
-			// Payer previously gained (credit), now subtract it back
-			err = mb.memberRepo.UpdateDebt(memberID, -(tx.Amount - share))
-		} else {
-			// Participant paid less before, now cancel the minus
-			err = mb.memberRepo.UpdateDebt(memberID, share)
-		}
-		if err != nil {
+	// Reverse debts using the stored shares, so the exact amounts posted
+	// when the transaction was added are taken back.
+	return mb.uow.Do(func(r repository.Repositories) error {
+		reversal := reverseDeltas(repository.DebtDeltas(tx.Amount, tx.Payer, details))
+		if err := r.Ledger.Post(repository.LedgerEntries(tx.BlockID, repository.LedgerTransaction, id, reversal)); err != nil {
 			return fiber.NewError(fiber.StatusInternalServerError, err.Error())
 		}
-	}
 
-	return mb.transactionRepo.Delete(id)
+		return r.Transactions.Delete(id)
+	})
 }
 
 func (mb *MainBusiness) GetAllBlocks(c *fiber.Ctx) error {
-	blocks, err := mb.blockRepo.GetAllBlocks()
+	blocks, err := mb.blockRepo.GetAllBlocks(grouphandler.GroupID(c))
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to get blocks",
@@ -251,7 +388,10 @@ func (mb *MainBusiness) GetAllBlocks(c *fiber.Ctx) error {
 
 func (mb *MainBusiness) DeleteBlock(c *fiber.Ctx) error {
 	blockID := c.Params("blockID")
-	err := mb.blockRepo.DeleteBlock(blockID)
+	groupID := grouphandler.GroupID(c)
+	err := mb.uow.Do(func(r repository.Repositories) error {
+		return r.Blocks.DeleteBlock(groupID, blockID)
+	})
 	if err != nil {
 		return fiber.NewError(fiber.StatusForbidden, err.Error())
 	}
@@ -261,28 +401,96 @@ func (mb *MainBusiness) DeleteBlock(c *fiber.Ctx) error {
 
 func (mb *MainBusiness) UpdateTransaction(c *fiber.Ctx) error {
 	id := c.Params("id")
-	var body struct {
-		Description string             `json:"description"`
-		Amount      float64            `json:"amount"`
-		Payer       string             `json:"payer"`
-		Ratios      map[string]float64 `json:"ratios"`
-	}
-
+	var body TransactionRequest
 	if err := c.BodyParser(&body); err != nil {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "Invalid input"})
 	}
 
-	payload := repository.UpdateTransactionPayload{
-		ID:          id,
-		Description: body.Description,
-		Amount:      body.Amount,
-		Payer:       body.Payer,
-		Ratios:      body.Ratios,
+	groupID := grouphandler.GroupID(c)
+	current, err := mb.transactionRepo.GetByID(groupID, id)
+	if err != nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "Transaction not found"})
+	}
+	_, locked, err := mb.blockRepo.Get(groupID, current.BlockID)
+	if err != nil {
+		return err
+	}
+	if locked {
+		return fiber.NewError(fiber.StatusForbidden, "locked by this block")
+	}
+
+	// An update that names no currency keeps the one the expense was
+	// entered in; the stored amount is in the block's base currency.
+	currency := current.OriginalCurrency
+	if currency == "" {
+		currency = current.Amount.Currency
+	}
+	if err := resolveCurrency(&body, currency); err != nil {
+		return err
+	}
+
+	if err := mb.applyDefaultRatios(current.BlockID, &body); err != nil {
+		return err
 	}
 
-	if err := mb.transactionRepo.UpdateTransaction(payload); err != nil {
+	if err := ValidateSplit(&body); err != nil {
+		return err
+	}
+
+	details, ratios, split, err := mb.splitShares(&body)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+	if err := mb.ValidateMemberInBlock(current.BlockID, ratios, body.Payer); err != nil {
+		return err
+	}
+
+	// Convert at the rate of the day the expense was first recorded.
+	amount, details, rate, err := mb.toBase(&body, details, current.Amount.Currency, current.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	payload := repository.UpdateTransactionPayload{
+		ID:             id,
+		Description:    body.Description,
+		Amount:         amount,
+		Payer:          body.Payer,
+		Ratios:         ratios,
+		SplitMode:      body.SplitMode,
+		Split:          split,
+		Details:        details,
+		OriginalAmount: body.Amount,
+		FXRate:         rate,
+	}
+
+	// Post a reversal of the stored shares and the new shares, so the ledger
+	// keeps both versions of the transaction.
+	err = mb.uow.Do(func(r repository.Repositories) error {
+		old, err := r.Transactions.GetDetails(id)
+		if err != nil {
+			return err
+		}
+		if err := r.Transactions.UpdateTransaction(payload); err != nil {
+			return err
+		}
+		entries := repository.LedgerEntries(current.BlockID, repository.LedgerTransaction, id,
+			reverseDeltas(repository.DebtDeltas(current.Amount, current.Payer, old)))
+		entries = append(entries, repository.LedgerEntries(current.BlockID, repository.LedgerTransaction, id,
+			repository.DebtDeltas(amount, body.Payer, details))...)
+		return r.Ledger.Post(entries)
+	})
+	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
 	}
 
 	return c.JSON(fiber.Map{"message": "Transaction updated successfully"})
 }
+
+func reverseDeltas(deltas map[string]repository.Money) map[string]repository.Money {
+	reversed := make(map[string]repository.Money, len(deltas))
+	for memberID, delta := range deltas {
+		reversed[memberID] = delta.Neg()
+	}
+	return reversed
+}
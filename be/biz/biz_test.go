@@ -0,0 +1,511 @@
+package mainbiz
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	jwt "github.com/golang-jwt/jwt/v5"
+	authenhandler "my-source/sheet-payment/be/biz/auth"
+	grouphandler "my-source/sheet-payment/be/biz/group"
+	"my-source/sheet-payment/be/repository"
+	"my-source/sheet-payment/be/repository/memory"
+)
+
+const (
+	month = "2024-05"
+	group = "g1"
+)
+
+type fixture struct {
+	t     *testing.T
+	app   *fiber.App
+	store *memory.Store
+	// groupID, when set, is sent in the X-Group-ID header instead of group.
+	groupID string
+	// ids maps member names to their IDs in the month's block.
+	ids map[string]string
+}
+
+// newFixture serves the business layer over the in-memory repositories, with
+// a block for month in group whose members are Alice, Bob and Carol, all at
+// ratio 1.
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	s := memory.NewStore()
+	if err := memory.NewUserRepository(s).Create(&repository.User{ID: "u1", Username: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	groups := memory.NewGroupRepository(s)
+	for _, id := range []string{group, "g2"} {
+		if err := groups.Create(repository.Group{ID: id, Name: id}, "alice"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mb := NewMainBusiness(groups, memory.NewMemberRepository(s), memory.NewBlockRepository(s),
+		memory.NewTransactionRepository(s), memory.NewSettlementRepository(s),
+		memory.NewOpeningBalanceRepository(s), memory.NewPersonRepository(s), memory.NewFXRateRepository(s),
+		memory.NewUnitOfWork(s), repository.NewAllocator(repository.TieBreakPayer))
+
+	app := fiber.New()
+	// Stands in for RejectRevoked and grouphandler.Require: alice is signed
+	// in and works in group.
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals(authenhandler.ClaimsKey, jwt.MapClaims{"username": "alice"})
+		c.Locals(grouphandler.GroupKey, c.Get(grouphandler.HeaderGroupID, group))
+		return c.Next()
+	})
+	app.Post("/blocks", mb.CreateBlock)
+	app.Get("/blocks", mb.GetAllBlocks)
+	app.Post("/blocks/:month/transactions", mb.AddTransaction)
+	app.Get("/blocks/:month/transactions", mb.GetTransactionsByBlock)
+	app.Get("/blocks/:month/summary", mb.GetSummary)
+	app.Get("/blocks/:month/settlements", mb.GetSettlements)
+	app.Post("/blocks/:month/settlements/payments", mb.AddSettlementPayment)
+	app.Post("/blocks/:month/lock", mb.LockBlock)
+	app.Post("/blocks/:month/rollover", mb.RolloverBlock)
+	app.Put("/transactions/:id", mb.UpdateTransaction)
+	app.Delete("/transactions/:id", mb.DeleteTransaction)
+	app.Post("/admin/reconcile", mb.Reconcile)
+	app.Get("/members", mb.GetAllMembers)
+	app.Put("/people/:id/user", mb.LinkPerson)
+	app.Get("/me/balances", mb.GetMyBalances)
+	app.Get("/me/transactions", mb.GetMyTransactions)
+	app.Get("/fx-rates", mb.GetFXRates)
+	app.Post("/fx-rates", mb.AddFXRates)
+	app.Post("/fx-rates/import", mb.ImportFXRates)
+
+	f := &fixture{t: t, app: app, store: s, ids: map[string]string{}}
+	var block repository.Block
+	f.decode(f.expect("POST", "/blocks", map[string]any{
+		"month": month,
+		"members": []map[string]any{
+			{"name": "Alice", "ratio": 1},
+			{"name": "Bob", "ratio": 1},
+			{"name": "Carol", "ratio": 1},
+		},
+	}, fiber.StatusOK), &block)
+	for _, m := range block.Members {
+		f.ids[m.Name] = m.ID
+	}
+	return f
+}
+
+func (f *fixture) do(method, path string, body any) (int, []byte) {
+	f.t.Helper()
+	var r io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			f.t.Fatal(err)
+		}
+		r = bytes.NewReader(data)
+	}
+	req := httptest.NewRequest(method, path, r)
+	req.Header.Set("Content-Type", "application/json")
+	if f.groupID != "" {
+		req.Header.Set(grouphandler.HeaderGroupID, f.groupID)
+	}
+	resp, err := f.app.Test(req, -1)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, data
+}
+
+func (f *fixture) expect(method, path string, body any, status int) []byte {
+	f.t.Helper()
+	got, data := f.do(method, path, body)
+	if got != status {
+		f.t.Fatalf("%s %s = %d %s, want %d", method, path, got, data, status)
+	}
+	return data
+}
+
+func (f *fixture) decode(data []byte, v any) {
+	f.t.Helper()
+	if err := json.Unmarshal(data, v); err != nil {
+		f.t.Fatalf("decode %s: %v", data, err)
+	}
+}
+
+func (f *fixture) summary() map[string]int64 {
+	f.t.Helper()
+	var s map[string]int64
+	f.decode(f.expect("GET", "/blocks/"+month+"/summary", nil, fiber.StatusOK), &s)
+	return s
+}
+
+// weights keys a name→value map by member ID.
+func (f *fixture) weights(byName map[string]float64) map[string]float64 {
+	w := map[string]float64{}
+	for name, v := range byName {
+		w[f.ids[name]] = v
+	}
+	return w
+}
+
+func (f *fixture) amounts(byName map[string]int64) map[string]int64 {
+	a := map[string]int64{}
+	for name, v := range byName {
+		a[f.ids[name]] = v
+	}
+	return a
+}
+
+func assertSummary(t *testing.T, got, want map[string]int64) {
+	t.Helper()
+	for name, v := range want {
+		if got[name] != v {
+			t.Errorf("balance of %s = %d, want %d (summary %v)", name, got[name], v, got)
+		}
+	}
+	var total int64
+	for _, v := range got {
+		total += v
+	}
+	if total != 0 {
+		t.Errorf("balances sum to %d, want 0 (summary %v)", total, got)
+	}
+}
+
+func TestAddTransaction(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       func(f *fixture) map[string]any
+		lock       bool
+		wantStatus int
+		want       map[string]int64
+	}{
+		{
+			name: "equal split",
+			body: func(f *fixture) map[string]any {
+				return map[string]any{"amount": 300, "payer": f.ids["Alice"], "split_mode": "equal",
+					"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1, "Carol": 1})}
+			},
+			wantStatus: fiber.StatusOK,
+			want:       map[string]int64{"Alice": 200, "Bob": -100, "Carol": -100},
+		},
+		{
+			name: "leftover unit goes to the payer",
+			body: func(f *fixture) map[string]any {
+				return map[string]any{"amount": 100, "payer": f.ids["Bob"], "split_mode": "equal",
+					"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1, "Carol": 1})}
+			},
+			wantStatus: fiber.StatusOK,
+			want:       map[string]int64{"Alice": -33, "Bob": 66, "Carol": -33},
+		},
+		{
+			name: "shares",
+			body: func(f *fixture) map[string]any {
+				return map[string]any{"amount": 1000, "payer": f.ids["Alice"], "split_mode": "shares",
+					"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 3})}
+			},
+			wantStatus: fiber.StatusOK,
+			want:       map[string]int64{"Alice": 750, "Bob": -750, "Carol": 0},
+		},
+		{
+			name: "percent",
+			body: func(f *fixture) map[string]any {
+				return map[string]any{"amount": 1000, "payer": f.ids["Carol"], "split_mode": "percent",
+					"ratios": f.weights(map[string]float64{"Alice": 50, "Bob": 30, "Carol": 20})}
+			},
+			wantStatus: fiber.StatusOK,
+			want:       map[string]int64{"Alice": -500, "Bob": -300, "Carol": 800},
+		},
+		{
+			name: "exact",
+			body: func(f *fixture) map[string]any {
+				return map[string]any{"amount": 500, "payer": f.ids["Bob"], "split_mode": "exact",
+					"exact": f.amounts(map[string]int64{"Alice": 120, "Bob": 380})}
+			},
+			wantStatus: fiber.StatusOK,
+			want:       map[string]int64{"Alice": -120, "Bob": 120, "Carol": 0},
+		},
+		{
+			name: "default ratios when none are given",
+			body: func(f *fixture) map[string]any {
+				return map[string]any{"amount": 90, "payer": f.ids["Carol"]}
+			},
+			wantStatus: fiber.StatusOK,
+			want:       map[string]int64{"Alice": -30, "Bob": -30, "Carol": 60},
+		},
+		{
+			name: "percent defaults to the ratios' percentages",
+			body: func(f *fixture) map[string]any {
+				return map[string]any{"amount": 90, "payer": f.ids["Carol"], "split_mode": "percent"}
+			},
+			wantStatus: fiber.StatusOK,
+			want:       map[string]int64{"Alice": -30, "Bob": -30, "Carol": 60},
+		},
+		{
+			name: "exact shares must add up to the amount",
+			body: func(f *fixture) map[string]any {
+				return map[string]any{"amount": 500, "payer": f.ids["Bob"], "split_mode": "exact",
+					"exact": f.amounts(map[string]int64{"Alice": 100, "Bob": 100})}
+			},
+			wantStatus: fiber.StatusBadRequest,
+			want:       map[string]int64{"Alice": 0, "Bob": 0, "Carol": 0},
+		},
+		{
+			name: "payer paying for the others",
+			body: func(f *fixture) map[string]any {
+				return map[string]any{"amount": 500, "payer": f.ids["Carol"], "split_mode": "exact",
+					"exact": f.amounts(map[string]int64{"Alice": 120, "Bob": 380})}
+			},
+			wantStatus: fiber.StatusOK,
+			want:       map[string]int64{"Alice": -120, "Bob": -380, "Carol": 500},
+		},
+		{
+			name: "payer outside the block",
+			body: func(f *fixture) map[string]any {
+				return map[string]any{"amount": 100, "payer": "stranger",
+					"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1})}
+			},
+			wantStatus: fiber.StatusForbidden,
+			want:       map[string]int64{"Alice": 0, "Bob": 0, "Carol": 0},
+		},
+		{
+			name: "participant outside the block",
+			body: func(f *fixture) map[string]any {
+				return map[string]any{"amount": 100, "payer": f.ids["Alice"],
+					"ratios": map[string]float64{f.ids["Alice"]: 1, "stranger": 1}}
+			},
+			wantStatus: fiber.StatusNotFound,
+			want:       map[string]int64{"Alice": 0, "Bob": 0, "Carol": 0},
+		},
+		{
+			name: "locked block",
+			body: func(f *fixture) map[string]any {
+				return map[string]any{"amount": 100, "payer": f.ids["Alice"],
+					"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1})}
+			},
+			lock:       true,
+			wantStatus: fiber.StatusForbidden,
+			want:       map[string]int64{"Alice": 0, "Bob": 0, "Carol": 0},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			if tt.lock {
+				f.expect("POST", "/blocks/"+month+"/lock", nil, fiber.StatusOK)
+			}
+			status, data := f.do("POST", "/blocks/"+month+"/transactions", tt.body(f))
+			if status != tt.wantStatus {
+				t.Fatalf("status = %d %s, want %d", status, data, tt.wantStatus)
+			}
+			assertSummary(t, f.summary(), tt.want)
+		})
+	}
+}
+
+func TestUpdateAndDeleteTransaction(t *testing.T) {
+	tests := []struct {
+		name string
+		// change is applied to the transaction Alice paid, 300 split equally
+		// between the three members.
+		change func(f *fixture, id string)
+		want   map[string]int64
+	}{
+		{
+			name: "update amount and participants",
+			change: func(f *fixture, id string) {
+				f.expect("PUT", "/transactions/"+id, map[string]any{"amount": 400, "payer": f.ids["Alice"],
+					"split_mode": "equal", "ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1})},
+					fiber.StatusOK)
+			},
+			want: map[string]int64{"Alice": 200, "Bob": -200, "Carol": 0},
+		},
+		{
+			name: "update payer",
+			change: func(f *fixture, id string) {
+				f.expect("PUT", "/transactions/"+id, map[string]any{"amount": 300, "payer": f.ids["Carol"],
+					"split_mode": "equal", "ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1, "Carol": 1})},
+					fiber.StatusOK)
+			},
+			want: map[string]int64{"Alice": -100, "Bob": -100, "Carol": 200},
+		},
+		{
+			name: "delete",
+			change: func(f *fixture, id string) {
+				f.expect("DELETE", "/transactions/"+id, nil, fiber.StatusOK)
+			},
+			want: map[string]int64{"Alice": 0, "Bob": 0, "Carol": 0},
+		},
+		{
+			name: "delete in a locked block",
+			change: func(f *fixture, id string) {
+				f.expect("POST", "/blocks/"+month+"/lock", nil, fiber.StatusOK)
+				f.expect("DELETE", "/transactions/"+id, nil, fiber.StatusForbidden)
+			},
+			want: map[string]int64{"Alice": 200, "Bob": -100, "Carol": -100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			var created struct {
+				ID string `json:"id"`
+			}
+			f.decode(f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+				"amount": 300, "payer": f.ids["Alice"], "split_mode": "equal",
+				"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1, "Carol": 1}),
+			}, fiber.StatusOK), &created)
+
+			tt.change(f, created.ID)
+			assertSummary(t, f.summary(), tt.want)
+		})
+	}
+}
+
+func TestSettlements(t *testing.T) {
+	tests := []struct {
+		mode          string
+		wantTransfers int
+	}{
+		{mode: "greedy", wantTransfers: 2},
+		{mode: "exact", wantTransfers: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			f := newFixture(t)
+			f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+				"amount": 300, "payer": f.ids["Alice"], "split_mode": "equal",
+				"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1, "Carol": 1}),
+			}, fiber.StatusOK)
+
+			var transfers []Transfer
+			f.decode(f.expect("GET", "/blocks/"+month+"/settlements?mode="+tt.mode, nil, fiber.StatusOK), &transfers)
+			if len(transfers) != tt.wantTransfers {
+				t.Fatalf("got %d transfers %+v, want %d", len(transfers), transfers, tt.wantTransfers)
+			}
+
+			// Paying the plan settles every balance.
+			for _, tr := range transfers {
+				f.expect("POST", "/blocks/"+month+"/settlements/payments", map[string]any{
+					"payer": tr.Payer, "payee": tr.Payee, "amount": tr.Amount.Amount,
+				}, fiber.StatusOK)
+			}
+			assertSummary(t, f.summary(), map[string]int64{"Alice": 0, "Bob": 0, "Carol": 0})
+
+			// A settled block has an empty plan, not null.
+			if got := string(f.expect("GET", "/blocks/"+month+"/settlements?mode="+tt.mode, nil,
+				fiber.StatusOK)); got != "[]" {
+				t.Errorf("settled plan = %s, want []", got)
+			}
+		})
+	}
+}
+
+func TestLockBlockRequireSettled(t *testing.T) {
+	tests := []struct {
+		name       string
+		unsettled  bool
+		query      string
+		wantStatus int
+	}{
+		{name: "settled", query: "?require_settled=true", wantStatus: fiber.StatusOK},
+		{name: "unsettled", unsettled: true, query: "?require_settled=true", wantStatus: fiber.StatusConflict},
+		{name: "unsettled without the check", unsettled: true, wantStatus: fiber.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			if tt.unsettled {
+				f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+					"amount": 100, "payer": f.ids["Alice"],
+					"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1}),
+				}, fiber.StatusOK)
+			}
+			f.expect("POST", "/blocks/"+month+"/lock"+tt.query, nil, tt.wantStatus)
+		})
+	}
+}
+
+func TestRolloverBlock(t *testing.T) {
+	f := newFixture(t)
+	f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+		"amount": 300, "payer": f.ids["Alice"], "split_mode": "equal",
+		"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1, "Carol": 1}),
+	}, fiber.StatusOK)
+	f.expect("POST", "/blocks/"+month+"/rollover", map[string]any{"month": "2024-06"}, fiber.StatusOK)
+
+	assertSummary(t, f.summary(), map[string]int64{"Alice": 0, "Bob": 0, "Carol": 0})
+
+	var next map[string]int64
+	f.decode(f.expect("GET", "/blocks/2024-06/summary", nil, fiber.StatusOK), &next)
+	assertSummary(t, next, map[string]int64{"Alice": 200, "Bob": -100, "Carol": -100})
+
+	// The closed month is locked.
+	f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+		"amount": 100, "payer": f.ids["Alice"], "ratios": f.weights(map[string]float64{"Alice": 1}),
+	}, fiber.StatusForbidden)
+
+	// It is not carried over a second time, nor onto an existing month.
+	f.expect("POST", "/blocks/"+month+"/rollover", map[string]any{"month": "2024-07"}, fiber.StatusConflict)
+	f.expect("GET", "/blocks/2024-07/summary", nil, fiber.StatusNotFound)
+	f.expect("POST", "/blocks/2024-06/rollover", map[string]any{"month": month}, fiber.StatusConflict)
+
+	// Unlocking the month does not let it be carried over again.
+	if err := memory.NewBlockRepository(f.store).Unlock(group, month); err != nil {
+		t.Fatal(err)
+	}
+	f.expect("POST", "/blocks/"+month+"/rollover", map[string]any{"month": "2024-07"}, fiber.StatusConflict)
+	f.expect("GET", "/blocks/2024-07/summary", nil, fiber.StatusNotFound)
+}
+
+func TestGroupsAreIsolated(t *testing.T) {
+	f := newFixture(t)
+	var tx map[string]any
+	f.decode(f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+		"amount": 300, "payer": f.ids["Alice"], "split_mode": "equal",
+		"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1, "Carol": 1}),
+	}, fiber.StatusOK), &tx)
+
+	f.groupID = "g2"
+	var blocks []repository.Block
+	f.decode(f.expect("GET", "/blocks", nil, fiber.StatusOK), &blocks)
+	if len(blocks) != 0 {
+		t.Fatalf("other group sees %d blocks, want 0", len(blocks))
+	}
+	// The other group has a month of its own, with its own Alice.
+	var block repository.Block
+	f.decode(f.expect("POST", "/blocks", map[string]any{
+		"month": month, "members": []map[string]any{{"name": "Alice", "ratio": 1}},
+	}, fiber.StatusOK), &block)
+	if block.Members[0].ID == f.ids["Alice"] || block.Members[0].PersonID == "" {
+		t.Fatalf("other group's member = %+v", block.Members[0])
+	}
+	assertSummary(t, f.summary(), map[string]int64{"Alice": 0})
+	f.expect("DELETE", "/transactions/"+tx["id"].(string), nil, fiber.StatusForbidden)
+	f.expect("PUT", "/transactions/"+tx["id"].(string), map[string]any{
+		"amount": 1, "payer": f.ids["Alice"], "ratios": f.weights(map[string]float64{"Alice": 1}),
+	}, fiber.StatusNotFound)
+
+	// Nor can the transaction be moved onto the other group's members.
+	f.groupID = ""
+	f.expect("PUT", "/transactions/"+tx["id"].(string), map[string]any{
+		"amount": 300, "payer": f.ids["Alice"], "split_mode": "equal",
+		"ratios": map[string]float64{f.ids["Alice"]: 1, block.Members[0].ID: 1},
+	}, fiber.StatusNotFound)
+	f.groupID = "g2"
+	assertSummary(t, f.summary(), map[string]int64{"Alice": 0})
+
+	f.groupID = ""
+	assertSummary(t, f.summary(), map[string]int64{"Alice": 200, "Bob": -100, "Carol": -100})
+	f.expect("POST", "/blocks/"+month+"/lock", nil, fiber.StatusOK)
+	f.expect("PUT", "/transactions/"+tx["id"].(string), map[string]any{
+		"amount": 300, "payer": f.ids["Alice"], "split_mode": "equal",
+		"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1}),
+	}, fiber.StatusForbidden)
+}
@@ -0,0 +1,170 @@
+package mainbiz
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"my-source/sheet-payment/be/repository"
+)
+
+// rateOn returns how many units of to one unit of from is worth on the day,
+// using the latest rate dated on or before it. An inverse rate is used when
+// only to→from is known. A missing rate is the caller's mistake; a failing
+// lookup is not.
+func (mb *MainBusiness) rateOn(from, to string, on time.Time) (*big.Rat, error) {
+	if from == to {
+		return big.NewRat(1, 1), nil
+	}
+
+	rate, err := mb.fxRepo.Find(from, to, on)
+	if err == nil {
+		return parseRate(rate.Rate)
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	rate, err = mb.fxRepo.Find(to, from, on)
+	if err == nil {
+		inv, err := parseRate(rate.Rate)
+		if err != nil {
+			return nil, err
+		}
+		return inv.Inv(inv), nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+	return nil, fiber.NewError(fiber.StatusBadRequest,
+		fmt.Sprintf("no FX rate for %s to %s on %s", from, to, on.Format(time.DateOnly)))
+}
+
+// toBase converts the amount and the shares computed in the entered currency
+// into the block's base currency. The base amount is re-split in proportion
+// to the original shares so the details still add up exactly.
+func (mb *MainBusiness) toBase(req *TransactionRequest, details map[string]repository.Money, base string,
+	on time.Time) (repository.Money, map[string]repository.Money, json.Number, error) {
+	if req.Amount.Currency == base {
+		return req.Amount, details, "1", nil
+	}
+
+	rate, err := mb.rateOn(req.Amount.Currency, base, on)
+	if err != nil {
+		return repository.Money{}, nil, "", err
+	}
+	amount := req.Amount.Convert(base, rate)
+	baseDetails, err := mb.allocator.Split(amount, weightsOf(details), req.Payer)
+	if err != nil {
+		return repository.Money{}, nil, "", fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	return amount, baseDetails, json.Number(rate.FloatString(12)), nil
+}
+
+func parseRate(n json.Number) (*big.Rat, error) {
+	rate, ok := new(big.Rat).SetString(n.String())
+	if !ok || rate.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid FX rate %q", n)
+	}
+	return rate, nil
+}
+
+func validateFXRate(rate *repository.FXRate) error {
+	rate.FromCurrency = strings.ToUpper(strings.TrimSpace(rate.FromCurrency))
+	rate.ToCurrency = strings.ToUpper(strings.TrimSpace(rate.ToCurrency))
+	if !repository.ValidCurrency(rate.FromCurrency) || !repository.ValidCurrency(rate.ToCurrency) {
+		return fmt.Errorf("invalid currency pair %q/%q", rate.FromCurrency, rate.ToCurrency)
+	}
+	if rate.FromCurrency == rate.ToCurrency {
+		return errors.New("from_currency and to_currency must differ")
+	}
+	if _, err := time.Parse(time.DateOnly, rate.Date); err != nil {
+		return fmt.Errorf("date must be YYYY-MM-DD, got %q", rate.Date)
+	}
+	if _, err := parseRate(rate.Rate); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (mb *MainBusiness) GetFXRates(c *fiber.Ctx) error {
+	rates, err := mb.fxRepo.GetAll()
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(rates)
+}
+
+func (mb *MainBusiness) AddFXRates(c *fiber.Ctx) error {
+	var rates []repository.FXRate
+	if err := c.BodyParser(&rates); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	return mb.saveFXRates(c, rates)
+}
+
+// ImportFXRates reads a CSV file uploaded as "file" with the columns
+// date,from_currency,to_currency,rate. A header row is optional.
+func (mb *MainBusiness) ImportFXRates(c *fiber.Ctx) error {
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, "file is required")
+	}
+	f, err := fh.Open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = 4
+	r.TrimLeadingSpace = true
+
+	var rates []repository.FXRate
+	for line := 1; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		if line == 1 && strings.EqualFold(rec[0], "date") {
+			continue
+		}
+		rates = append(rates, repository.FXRate{
+			Date:         rec[0],
+			FromCurrency: rec[1],
+			ToCurrency:   rec[2],
+			Rate:         json.Number(strings.TrimSpace(rec[3])),
+		})
+	}
+
+	return mb.saveFXRates(c, rates)
+}
+
+func (mb *MainBusiness) saveFXRates(c *fiber.Ctx, rates []repository.FXRate) error {
+	for i := range rates {
+		if err := validateFXRate(&rates[i]); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("rate %d: %s", i+1, err))
+		}
+	}
+
+	// A file is imported whole or not at all.
+	err := mb.uow.Do(func(r repository.Repositories) error {
+		return r.FXRates.Upsert(rates)
+	})
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	return c.JSON(fiber.Map{"imported": len(rates)})
+}
@@ -0,0 +1,214 @@
+package mainbiz
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"my-source/sheet-payment/be/repository"
+	"my-source/sheet-payment/be/repository/memory"
+)
+
+// fxBiz is the business layer over an in-memory store holding rates.
+func fxBiz(t *testing.T, rates ...repository.FXRate) *MainBusiness {
+	t.Helper()
+	fx := memory.NewFXRateRepository(memory.NewStore())
+	if err := fx.Upsert(rates); err != nil {
+		t.Fatal(err)
+	}
+	return &MainBusiness{fxRepo: fx, allocator: repository.NewAllocator(repository.TieBreakPayer)}
+}
+
+func day(s string) time.Time {
+	d, _ := time.Parse(time.DateOnly, s)
+	return d
+}
+
+func TestRateOn(t *testing.T) {
+	mb := fxBiz(t,
+		repository.FXRate{Date: "2024-01-01", FromCurrency: "USD", ToCurrency: "VND", Rate: "24000"},
+		repository.FXRate{Date: "2024-03-01", FromCurrency: "USD", ToCurrency: "VND", Rate: "25000"},
+		repository.FXRate{Date: "2024-06-01", FromCurrency: "USD", ToCurrency: "VND", Rate: "26000"},
+		repository.FXRate{Date: "2024-01-01", FromCurrency: "VND", ToCurrency: "EUR", Rate: "0.00004"},
+		repository.FXRate{Date: "2024-01-01", FromCurrency: "VND", ToCurrency: "USD", Rate: "0.0001"},
+	)
+	tests := []struct {
+		name     string
+		from, to string
+		on       string
+		want     string // empty when no rate applies
+	}{
+		{"same currency", "JPY", "JPY", "2024-01-01", "1"},
+		{"rate of the day", "USD", "VND", "2024-03-01", "25000"},
+		{"latest before the day", "USD", "VND", "2024-04-15", "25000"},
+		{"latest of all", "USD", "VND", "2025-01-01", "26000"},
+		{"before any rate", "USD", "VND", "2023-12-31", ""},
+		{"inverse", "EUR", "VND", "2024-02-01", "25000"},
+		{"direct before inverse", "VND", "USD", "2024-02-01", "1/10000"},
+		{"unknown pair", "GBP", "VND", "2024-02-01", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rate, err := mb.rateOn(tt.from, tt.to, day(tt.on))
+			if tt.want == "" {
+				var fe *fiber.Error
+				if !errors.As(err, &fe) || fe.Code != fiber.StatusBadRequest {
+					t.Fatalf("rateOn = %v, %v; want a 400", rate, err)
+				}
+				return
+			}
+			want, _ := new(big.Rat).SetString(tt.want)
+			if err != nil || rate.Cmp(want) != 0 {
+				t.Errorf("rateOn = %v, %v; want %v", rate, err, want)
+			}
+		})
+	}
+}
+
+// failingFX fails every lookup, as a database gone away would.
+type failingFX struct{ repository.IFXRateRepository }
+
+func (failingFX) Find(string, string, time.Time) (repository.FXRate, error) {
+	return repository.FXRate{}, errors.New("connection reset")
+}
+
+func TestRateOnLookupError(t *testing.T) {
+	mb := &MainBusiness{fxRepo: failingFX{}}
+	_, err := mb.rateOn("USD", "VND", day("2024-01-01"))
+	var fe *fiber.Error
+	if err == nil || errors.As(err, &fe) {
+		t.Errorf("rateOn = %v, want the lookup error", err)
+	}
+}
+
+func TestToBase(t *testing.T) {
+	mb := fxBiz(t,
+		repository.FXRate{Date: "2024-01-01", FromCurrency: "USD", ToCurrency: "VND", Rate: "150"},
+		repository.FXRate{Date: "2024-01-01", FromCurrency: "JPY", ToCurrency: "USD", Rate: "0.0067"},
+	)
+	tests := []struct {
+		name     string
+		amount   repository.Money
+		details  map[string]int64
+		base     string
+		want     int64
+		wantRate string
+		// wantDetails are the base shares, which add up to want.
+		wantDetails map[string]int64
+	}{
+		{"base currency untouched", repository.NewMoney(1000, "VND"), map[string]int64{"a": 600, "b": 400},
+			"VND", 1000, "1", map[string]int64{"a": 600, "b": 400}},
+		{"half a dong rounds up", repository.NewMoney(1, "USD"), map[string]int64{"a": 1},
+			"VND", 2, "150.000000000000", map[string]int64{"a": 2}},
+		{"below half rounds down", repository.NewMoney(1003, "JPY"), map[string]int64{"a": 1003},
+			"USD", 672, "0.006700000000", map[string]int64{"a": 672}},
+		{"shares scaled in proportion", repository.NewMoney(1000, "USD"), map[string]int64{"a": 500, "b": 300, "c": 200},
+			"VND", 1500, "150.000000000000", map[string]int64{"a": 750, "b": 450, "c": 300}},
+		{"leftover goes to the payer", repository.NewMoney(2, "USD"), map[string]int64{"a": 1, "b": 1},
+			"VND", 3, "150.000000000000", map[string]int64{"a": 2, "b": 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			details := map[string]repository.Money{}
+			for id, v := range tt.details {
+				details[id] = repository.NewMoney(v, tt.amount.Currency)
+			}
+			req := &TransactionRequest{Amount: tt.amount, Payer: "a"}
+			amount, got, rate, err := mb.toBase(req, details, tt.base, day("2024-05-01"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if amount != repository.NewMoney(tt.want, tt.base) || rate != json.Number(tt.wantRate) {
+				t.Errorf("toBase = %v at %s, want %d %s at %s", amount, rate, tt.want, tt.base, tt.wantRate)
+			}
+			for id, v := range tt.wantDetails {
+				if got[id] != repository.NewMoney(v, tt.base) {
+					t.Errorf("share of %s = %v, want %d %s", id, got[id], v, tt.base)
+				}
+			}
+		})
+	}
+}
+
+// importCSV uploads body as the rates file.
+func (f *fixture) importCSV(body string) (int, []byte) {
+	f.t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	part, err := w.CreateFormFile("file", "rates.csv")
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	part.Write([]byte(body))
+	w.Close()
+
+	req := httptest.NewRequest("POST", "/fx-rates/import", &buf)
+	req.Header.Set("Content-Type", w.FormDataContentType())
+	resp, err := f.app.Test(req, -1)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var data bytes.Buffer
+	data.ReadFrom(resp.Body)
+	return resp.StatusCode, data.Bytes()
+}
+
+func TestImportFXRates(t *testing.T) {
+	tests := []struct {
+		name       string
+		csv        string
+		wantStatus int
+		wantRates  int
+	}{
+		{"with header", "date,from_currency,to_currency,rate\n2024-01-01,USD,VND,25000\n2024-01-02,usd, vnd,25100\n",
+			fiber.StatusOK, 2},
+		{"without header", "2024-01-01,USD,VND,25000\n", fiber.StatusOK, 1},
+		{"missing column", "2024-01-01,USD,VND,25000\n2024-01-02,USD,VND\n", fiber.StatusBadRequest, 0},
+		{"unknown currency", "2024-01-01,USD,VND,25000\n2024-01-02,USD,XX,25000\n", fiber.StatusBadRequest, 0},
+		{"same currency", "2024-01-01,USD,USD,1\n", fiber.StatusBadRequest, 0},
+		{"bad date", "01/02/2024,USD,VND,25000\n", fiber.StatusBadRequest, 0},
+		{"zero rate", "2024-01-01,USD,VND,0\n", fiber.StatusBadRequest, 0},
+		{"rate not a number", "2024-01-01,USD,VND,abc\n", fiber.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			if status, data := f.importCSV(tt.csv); status != tt.wantStatus {
+				t.Fatalf("import = %d %s, want %d", status, data, tt.wantStatus)
+			}
+			var rates []repository.FXRate
+			f.decode(f.expect("GET", "/fx-rates", nil, fiber.StatusOK), &rates)
+			if len(rates) != tt.wantRates {
+				t.Errorf("stored %d rates, want %d: %+v", len(rates), tt.wantRates, rates)
+			}
+		})
+	}
+}
+
+func TestUpdateTransactionKeepsCurrency(t *testing.T) {
+	f := newFixture(t)
+	f.expect("POST", "/fx-rates", []map[string]any{
+		{"date": "2024-01-01", "from_currency": "USD", "to_currency": "VND", "rate": 25000},
+	}, fiber.StatusOK)
+
+	var tx map[string]any
+	f.decode(f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+		"amount": 1000, "currency": "USD", "payer": f.ids["Alice"],
+		"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1}),
+	}, fiber.StatusOK), &tx)
+	assertSummary(t, f.summary(), map[string]int64{"Alice": 125000, "Bob": -125000, "Carol": 0})
+
+	// $20.00 rather than 2000 VND.
+	f.expect("PUT", "/transactions/"+tx["id"].(string), map[string]any{
+		"amount": 2000, "payer": f.ids["Alice"],
+		"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1}),
+	}, fiber.StatusOK)
+	assertSummary(t, f.summary(), map[string]int64{"Alice": 250000, "Bob": -250000, "Carol": 0})
+}
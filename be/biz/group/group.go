@@ -0,0 +1,177 @@
+// Package grouphandler serves groups, the workspaces that own blocks, and
+// picks the group each block route works in.
+package grouphandler
+
+import (
+	"database/sql"
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	authenhandler "my-source/sheet-payment/be/biz/auth"
+	"my-source/sheet-payment/be/repository"
+)
+
+// HeaderGroupID names the group of a request whose path has no :groupId.
+const HeaderGroupID = "X-Group-ID"
+
+// GroupKey holds the ID of the group the request works in, set by Require.
+const GroupKey = "group"
+
+type GroupHandler struct {
+	GroupRepo repository.IGroupRepository
+}
+
+func NewGroupHandler(grp repository.IGroupRepository) *GroupHandler {
+	return &GroupHandler{GroupRepo: grp}
+}
+
+// GroupID returns the group chosen by Require.
+func GroupID(c *fiber.Ctx) string {
+	id, _ := c.Locals(GroupKey).(string)
+	return id
+}
+
+// Require picks the group of the request and lets it through when the
+// user's role in that group is min or a more privileged one. The group is
+// the :groupId path parameter, else the X-Group-ID header, else the only
+// group the user is a member of. It runs after RejectRevoked.
+func (h *GroupHandler) Require(min string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		username := authenhandler.Username(c)
+		if username == "" {
+			return fiber.ErrUnauthorized
+		}
+
+		// Handlers store the ID, so it must not share the request's buffer.
+		groupID := strings.Clone(c.Params("groupId", c.Get(HeaderGroupID)))
+		var role string
+		if groupID == "" {
+			groups, err := h.GroupRepo.GetByUsername(username)
+			if err != nil {
+				return err
+			}
+			switch len(groups) {
+			case 0:
+				return fiber.NewError(fiber.StatusForbidden, "not a member of any group")
+			case 1:
+				groupID, role = groups[0].ID, groups[0].Role
+			default:
+				return fiber.NewError(fiber.StatusBadRequest, "choose a group with the "+HeaderGroupID+" header")
+			}
+		} else {
+			var err error
+			role, err = h.GroupRepo.GetRole(groupID, username)
+			// Other groups look the same whether they exist or not.
+			if errors.Is(err, sql.ErrNoRows) {
+				return fiber.NewError(fiber.StatusNotFound, "group not found")
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if !authenhandler.RoleAtLeast(role, min) {
+			return fiber.NewError(fiber.StatusForbidden, "requires the "+min+" role in this group")
+		}
+		c.Locals(GroupKey, groupID)
+		return c.Next()
+	}
+}
+
+type CreateGroupRequest struct {
+	Name string `json:"name"`
+}
+
+// GetGroups lists the user's groups with the user's role in each.
+func (h *GroupHandler) GetGroups(c *fiber.Ctx) error {
+	groups, err := h.GroupRepo.GetByUsername(authenhandler.Username(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(groups)
+}
+
+// CreateGroup creates a group with the user as its admin.
+func (h *GroupHandler) CreateGroup(c *fiber.Ctx) error {
+	var body CreateGroupRequest
+	if err := c.BodyParser(&body); err != nil || body.Name == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "name is required")
+	}
+
+	group := repository.Group{ID: uuid.New().String(), Name: body.Name, CreatedAt: time.Now()}
+	if err := h.GroupRepo.Create(group, authenhandler.Username(c)); err != nil {
+		return err
+	}
+	group.Role = repository.RoleAdmin
+	return c.JSON(group)
+}
+
+func (h *GroupHandler) GetMembers(c *fiber.Ctx) error {
+	members, err := h.GroupRepo.GetMembers(GroupID(c))
+	if err != nil {
+		return err
+	}
+	return c.JSON(members)
+}
+
+// SetMember adds the user named in the path to the group, or changes the
+// member's role.
+func (h *GroupHandler) SetMember(c *fiber.Ctx) error {
+	var body authenhandler.RoleRequest
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.ErrBadRequest
+	}
+	if !slices.Contains(repository.Roles, body.Role) {
+		return fiber.NewError(fiber.StatusBadRequest, "unknown role "+body.Role)
+	}
+
+	groupID, username := GroupID(c), strings.Clone(c.Params("username"))
+	if err := h.keepAdmin(groupID, username, body.Role); err != nil {
+		return err
+	}
+	err := h.GroupRepo.SetMember(groupID, username, body.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.NewError(fiber.StatusNotFound, "user not found")
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(repository.GroupMember{GroupID: groupID, Username: username, Role: body.Role})
+}
+
+func (h *GroupHandler) RemoveMember(c *fiber.Ctx) error {
+	groupID, username := GroupID(c), c.Params("username")
+	if err := h.keepAdmin(groupID, username, ""); err != nil {
+		return err
+	}
+	err := h.GroupRepo.RemoveMember(groupID, username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.NewError(fiber.StatusNotFound, "not a member")
+	}
+	if err != nil {
+		return err
+	}
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// keepAdmin refuses to give username the role, "" for none, when that would
+// leave the group without an admin to manage it.
+func (h *GroupHandler) keepAdmin(groupID, username, role string) error {
+	if role == repository.RoleAdmin {
+		return nil
+	}
+	members, err := h.GroupRepo.GetMembers(groupID)
+	if err != nil {
+		return err
+	}
+	for _, m := range members {
+		if m.Role == repository.RoleAdmin && m.Username != username {
+			return nil
+		}
+	}
+	return fiber.NewError(fiber.StatusConflict, "cannot remove the last admin of the group")
+}
@@ -0,0 +1,161 @@
+package grouphandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jwtware "github.com/gofiber/jwt/v3"
+	authenhandler "my-source/sheet-payment/be/biz/auth"
+	"my-source/sheet-payment/be/repository"
+	"my-source/sheet-payment/be/repository/memory"
+)
+
+type groupFixture struct {
+	t   *testing.T
+	app *fiber.App
+	// tokens maps usernames to their access tokens.
+	tokens map[string]string
+}
+
+// newGroupFixture serves the group routes as main does, with /blocks
+// standing in for the block routes. alice administers the instance and bob
+// is a viewer.
+func newGroupFixture(t *testing.T) *groupFixture {
+	s := memory.NewStore()
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	auth := authenhandler.NewAuthHandler(memory.NewUserRepository(s), memory.NewTokenRepository(s), secret,
+		time.Minute, time.Hour)
+	h := NewGroupHandler(memory.NewGroupRepository(s))
+	group := func(c *fiber.Ctx) error { return c.SendString(GroupID(c)) }
+
+	app := fiber.New()
+	app.Post("/register", auth.Register)
+	app.Post("/login", auth.Login)
+	protected := app.Group("/", jwtware.New(jwtware.Config{SigningKey: secret}))
+	protected.Use(auth.RejectRevoked())
+	protected.Get("/blocks", h.Require(repository.RoleViewer), group)
+	protected.Post("/blocks", h.Require(repository.RoleEditor), group)
+	protected.Get("/groups", h.GetGroups)
+	protected.Post("/groups", authenhandler.RequireRole(repository.RoleEditor), h.CreateGroup)
+	protected.Get("/groups/:groupId/members", h.Require(repository.RoleViewer), h.GetMembers)
+	protected.Put("/groups/:groupId/members/:username", h.Require(repository.RoleAdmin), h.SetMember)
+	protected.Delete("/groups/:groupId/members/:username", h.Require(repository.RoleAdmin), h.RemoveMember)
+
+	f := &groupFixture{t: t, app: app, tokens: map[string]string{}}
+	for _, name := range []string{"alice", "bob"} {
+		login := map[string]string{"username": name, "password": "pw"}
+		f.expect("POST", "/register", "", "", login, fiber.StatusOK)
+		var tokens authenhandler.TokenResponse
+		f.decode(f.expect("POST", "/login", "", "", login, fiber.StatusOK), &tokens)
+		f.tokens[name] = tokens.Token
+	}
+	return f
+}
+
+// expect sends the request as user, naming group in the X-Group-ID header
+// when it is set.
+func (f *groupFixture) expect(method, path, user, group string, body any, status int) []byte {
+	f.t.Helper()
+	data, err := json.Marshal(body)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(data))
+	req.Header.Set("Content-Type", "application/json")
+	if user != "" {
+		req.Header.Set("Authorization", "Bearer "+f.tokens[user])
+	}
+	if group != "" {
+		req.Header.Set(HeaderGroupID, group)
+	}
+	resp, err := f.app.Test(req, -1)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	got, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != status {
+		f.t.Fatalf("%s %s as %s = %d %s, want %d", method, path, user, resp.StatusCode, got, status)
+	}
+	return got
+}
+
+func (f *groupFixture) decode(data []byte, v any) {
+	f.t.Helper()
+	if err := json.Unmarshal(data, v); err != nil {
+		f.t.Fatalf("decode %s: %v", data, err)
+	}
+}
+
+func (f *groupFixture) create(user, name string) string {
+	f.t.Helper()
+	var group repository.Group
+	f.decode(f.expect("POST", "/groups", user, "", CreateGroupRequest{Name: name}, fiber.StatusOK), &group)
+	if group.ID == "" || group.Role != repository.RoleAdmin {
+		f.t.Fatalf("created group = %+v", group)
+	}
+	return group.ID
+}
+
+func TestRequire(t *testing.T) {
+	f := newGroupFixture(t)
+	f.expect("GET", "/blocks", "alice", "", nil, fiber.StatusForbidden)
+	f.expect("POST", "/groups", "bob", "", CreateGroupRequest{Name: "Mine"}, fiber.StatusForbidden)
+
+	flat := f.create("alice", "Flat")
+	// With one group the header is optional.
+	if got := string(f.expect("GET", "/blocks", "alice", "", nil, fiber.StatusOK)); got != flat {
+		t.Errorf("group = %q, want %q", got, flat)
+	}
+	f.expect("GET", "/blocks", "bob", flat, nil, fiber.StatusNotFound)
+	f.expect("GET", "/blocks", "alice", "missing", nil, fiber.StatusNotFound)
+
+	f.expect("PUT", "/groups/"+flat+"/members/bob", "alice", "", map[string]string{"role": "viewer"}, fiber.StatusOK)
+	f.expect("GET", "/blocks", "bob", "", nil, fiber.StatusOK)
+	f.expect("POST", "/blocks", "bob", "", nil, fiber.StatusForbidden)
+	f.expect("PUT", "/groups/"+flat+"/members/bob", "bob", "", map[string]string{"role": "admin"},
+		fiber.StatusForbidden)
+
+	trip := f.create("alice", "Trip")
+	f.expect("GET", "/blocks", "alice", "", nil, fiber.StatusBadRequest)
+	if got := string(f.expect("POST", "/blocks", "alice", trip, nil, fiber.StatusOK)); got != trip {
+		t.Errorf("group = %q, want %q", got, trip)
+	}
+	// Bob's only group is still picked for him.
+	if got := string(f.expect("GET", "/blocks", "bob", "", nil, fiber.StatusOK)); got != flat {
+		t.Errorf("group = %q, want %q", got, flat)
+	}
+}
+
+func TestMembers(t *testing.T) {
+	f := newGroupFixture(t)
+	flat := f.create("alice", "Flat")
+	members := "/groups/" + flat + "/members/"
+
+	f.expect("PUT", members+"carol", "alice", "", map[string]string{"role": "viewer"}, fiber.StatusNotFound)
+	f.expect("PUT", members+"bob", "alice", "", map[string]string{"role": "owner"}, fiber.StatusBadRequest)
+
+	// The last admin can neither leave nor step down.
+	f.expect("DELETE", members+"alice", "alice", "", nil, fiber.StatusConflict)
+	f.expect("PUT", members+"alice", "alice", "", map[string]string{"role": "editor"}, fiber.StatusConflict)
+
+	f.expect("PUT", members+"bob", "alice", "", map[string]string{"role": "admin"}, fiber.StatusOK)
+	f.expect("DELETE", members+"alice", "alice", "", nil, fiber.StatusNoContent)
+	f.expect("GET", "/groups/"+flat+"/members", "alice", "", nil, fiber.StatusNotFound)
+
+	var list []repository.GroupMember
+	f.decode(f.expect("GET", "/groups/"+flat+"/members", "bob", "", nil, fiber.StatusOK), &list)
+	if len(list) != 1 || list[0].Username != "bob" || list[0].Role != repository.RoleAdmin {
+		t.Errorf("members = %+v, want bob as admin", list)
+	}
+	var groups []repository.Group
+	f.decode(f.expect("GET", "/groups", "alice", "", nil, fiber.StatusOK), &groups)
+	if len(groups) != 0 {
+		t.Errorf("alice's groups = %+v, want none", groups)
+	}
+}
@@ -0,0 +1,116 @@
+package mainbiz
+
+import (
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	grouphandler "my-source/sheet-payment/be/biz/group"
+	"my-source/sheet-payment/be/repository"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// GetTransactionsByBlock serves one page of a block's transactions, newest
+// first unless ?sort=created_at. Filters: payer and participant (member IDs),
+// min_amount and max_amount (base currency minor units), from and to
+// (YYYY-MM-DD, both inclusive, or RFC 3339) and q (full-text search of the
+// description for every word).
+func (mb *MainBusiness) GetTransactionsByBlock(c *fiber.Ctx) error {
+	month := c.Params("month")
+	blockID, _, err := mb.blockRepo.GetIDByMonth(grouphandler.GroupID(c), month)
+	if err != nil {
+		return err
+	}
+
+	filter, err := transactionFilter(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	filter.BlockID = blockID
+
+	page, err := mb.transactionRepo.List(filter)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(page)
+}
+
+func transactionFilter(c *fiber.Ctx) (repository.TransactionFilter, error) {
+	f := repository.TransactionFilter{
+		Payer:       c.Query("payer"),
+		Participant: c.Query("participant"),
+		Search:      c.Query("q"),
+		Cursor:      c.Query("cursor"),
+		Sort:        c.Query("sort", repository.SortNewest),
+		Limit:       defaultPageSize,
+	}
+	if f.Sort != repository.SortNewest && f.Sort != repository.SortOldest {
+		return f, errors.New("sort must be created_at or -created_at")
+	}
+
+	if v := c.Query("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return f, errors.New("limit must be between 1 and " + strconv.Itoa(maxPageSize))
+		}
+		f.Limit = limit
+	}
+
+	var err error
+	if f.MinAmount, err = queryAmount(c, "min_amount"); err != nil {
+		return f, err
+	}
+	if f.MaxAmount, err = queryAmount(c, "max_amount"); err != nil {
+		return f, err
+	}
+	if f.From, err = queryTime(c, "from", false); err != nil {
+		return f, err
+	}
+	if f.To, err = queryTime(c, "to", true); err != nil {
+		return f, err
+	}
+	return f, nil
+}
+
+func queryAmount(c *fiber.Ctx, key string) (*int64, error) {
+	v := c.Query(key)
+	if v == "" {
+		return nil, nil
+	}
+	amount, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, errors.New(key + " must be an integer")
+	}
+	return &amount, nil
+}
+
+// queryTime parses a date or an RFC 3339 time. A date used as an upper bound
+// covers the whole day.
+func queryTime(c *fiber.Ctx, key string, upper bool) (time.Time, error) {
+	v := c.Query(key)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if day, err := time.ParseInLocation(time.DateOnly, v, time.Local); err == nil {
+		if upper {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day, nil
+	}
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		return time.Time{}, errors.New(key + " must be a date (YYYY-MM-DD) or an RFC 3339 time")
+	}
+	if upper {
+		t = t.Add(time.Nanosecond)
+	}
+	return t, nil
+}
@@ -0,0 +1,74 @@
+package mainbiz
+
+import (
+	"net/url"
+	"slices"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"my-source/sheet-payment/be/repository"
+)
+
+func TestGetTransactionsByBlock(t *testing.T) {
+	f := newFixture(t)
+	for _, tx := range []struct {
+		description string
+		amount      int64
+		payer       string
+	}{
+		{"Rent", 3000, "Alice"},
+		{"Water bill", 90, "Bob"},
+		{"Electricity bill", 600, "Carol"},
+	} {
+		f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+			"description": tx.description, "amount": tx.amount, "payer": f.ids[tx.payer], "split_mode": "equal",
+			"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1, "Carol": 1}),
+		}, fiber.StatusOK)
+	}
+
+	list := func(query url.Values) ([]string, int) {
+		t.Helper()
+		var got []string
+		total := 0
+		for {
+			var page repository.TransactionPage
+			f.decode(f.expect("GET", "/blocks/"+month+"/transactions?"+query.Encode(), nil, fiber.StatusOK), &page)
+			for _, tx := range page.Transactions {
+				got = append(got, tx.Description)
+			}
+			total = page.Total
+			if page.NextCursor == "" {
+				return got, total
+			}
+			query.Set("cursor", page.NextCursor)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  []string
+	}{
+		{"newest first", url.Values{"limit": {"2"}}, []string{"Electricity bill", "Water bill", "Rent"}},
+		{"oldest first", url.Values{"limit": {"1"}, "sort": {"created_at"}},
+			[]string{"Rent", "Water bill", "Electricity bill"}},
+		{"payer", url.Values{"payer": {f.ids["Bob"]}}, []string{"Water bill"}},
+		{"amount range", url.Values{"min_amount": {"100"}, "max_amount": {"3000"}},
+			[]string{"Electricity bill", "Rent"}},
+		{"search", url.Values{"q": {"BILL"}, "sort": {"created_at"}}, []string{"Water bill", "Electricity bill"}},
+		{"to a past day", url.Values{"to": {"2000-01-01"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, total := list(tt.query)
+			if !slices.Equal(got, tt.want) || total != len(tt.want) {
+				t.Errorf("listing = %q (total %d), want %q", got, total, tt.want)
+			}
+		})
+	}
+
+	for _, query := range []string{"sort=amount", "limit=0", "limit=500", "min_amount=abc", "from=yesterday",
+		"cursor=not-a-cursor"} {
+		f.expect("GET", "/blocks/"+month+"/transactions?"+query, nil, fiber.StatusBadRequest)
+	}
+}
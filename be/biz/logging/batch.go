@@ -0,0 +1,98 @@
+package middlewarelogging
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"my-source/sheet-payment/be/repository"
+)
+
+// BatchWriter writes audit log entries in the background, so a request never
+// waits for the database. Entries are flushed when a batch fills up or every
+// flush interval. When the buffer is full new entries are dropped and counted
+// rather than blocking requests.
+type BatchWriter struct {
+	repo      repository.ILogging
+	entries   chan repository.UserLog
+	batchSize int
+	interval  time.Duration
+
+	mu      sync.Mutex
+	dropped int
+
+	done chan struct{}
+	once sync.Once
+}
+
+func NewBatchWriter(repo repository.ILogging, bufferSize, batchSize int, interval time.Duration) *BatchWriter {
+	w := &BatchWriter{
+		repo:      repo,
+		entries:   make(chan repository.UserLog, bufferSize),
+		batchSize: batchSize,
+		interval:  interval,
+		done:      make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Write queues the entry without blocking.
+func (w *BatchWriter) Write(entry repository.UserLog) {
+	select {
+	case w.entries <- entry:
+	default:
+		w.mu.Lock()
+		w.dropped++
+		w.mu.Unlock()
+	}
+}
+
+// Close flushes the queued entries and stops the writer. Write must not be
+// called after Close.
+func (w *BatchWriter) Close() {
+	w.once.Do(func() {
+		close(w.entries)
+		<-w.done
+	})
+}
+
+func (w *BatchWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+
+	batch := make([]repository.UserLog, 0, w.batchSize)
+	flush := func() {
+		w.mu.Lock()
+		dropped := w.dropped
+		w.dropped = 0
+		w.mu.Unlock()
+		if dropped > 0 {
+			slog.Warn("audit log: buffer full", "dropped", dropped)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := w.repo.WriteBatch(batch); err != nil {
+			slog.Error("audit log: write failed", "lost", len(batch), "err", err)
+		}
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case entry, ok := <-w.entries:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, entry)
+			if len(batch) >= w.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
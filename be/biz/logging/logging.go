@@ -1,64 +1,146 @@
 package middlewarelogging
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
 	authenhandler "my-source/sheet-payment/be/biz/auth"
 	"my-source/sheet-payment/be/repository"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
+)
 
-	jwt "github.com/golang-jwt/jwt/v5"
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
 )
 
 type Logger struct {
-	repo repository.ILogging
+	repo   repository.ILogging
+	writer *BatchWriter
 }
 
+// NewLogger writes the audit log through a BatchWriter in batches of up to
+// 100 entries, flushed at least every second, buffering at most 10000.
 func NewLogger(repo repository.ILogging) *Logger {
-	return &Logger{repo: repo}
+	return &Logger{repo: repo, writer: NewBatchWriter(repo, 10000, 100, time.Second)}
+}
+
+// Close flushes the audit entries that are still queued.
+func (lg *Logger) Close() {
+	lg.writer.Close()
 }
 
+// LogUserActivity writes an audit entry for every request, including the
+// sign-ins and the requests turned away for a bad token. Requests are
+// attributed to the user of the token RejectRevoked verified, when it ran.
 func (lg *Logger) LogUserActivity() fiber.Handler {
 	return func(c *fiber.Ctx) error {
 		start := time.Now()
 
-		user := "anonymous"
-		authHeader := c.Get("Authorization")
-		if strings.HasPrefix(authHeader, "Bearer ") {
-			tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
-			token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-				return []byte(authenhandler.JwtSecret), nil
-			})
-			if err == nil && token.Valid {
-				if claims, ok := token.Claims.(jwt.MapClaims); ok {
-					if username, ok := claims["username"].(string); ok {
-						user = username
-					}
-				}
-			}
+		// Run the handler first so the response status can be logged, and
+		// so RejectRevoked, which runs after the logger, has named the user.
+		err := c.Next()
+		user := authenhandler.Username(c)
+		if user == "" {
+			user = "anonymous"
+		}
+		status := c.Response().StatusCode()
+		var fe *fiber.Error
+		if errors.As(err, &fe) {
+			status = fe.Code
+		} else if err != nil {
+			status = fiber.StatusInternalServerError
 		}
 
-		log.Printf("[User: %s] %s %s at %s", user, c.Method(), c.Path(), start.Format(time.RFC3339))
+		duration := time.Since(start)
+
+		// Fiber reuses the request's buffers once the handler returns, so
+		// everything handed to the background writer is copied.
 		lWrite := repository.UserLog{
-			Username: user,
-			Method:   c.Method(),
-			Path:     c.Path(),
+			Username:   user,
+			Method:     strings.Clone(c.Method()),
+			Path:       strings.Clone(c.Path()),
+			IPAddress:  strings.Clone(c.IP()),
+			UserAgent:  strings.Clone(c.Get(fiber.HeaderUserAgent)),
+			Body:       redactBody(c.Get(fiber.HeaderContentType), c.Body()),
+			Status:     status,
+			DurationMs: duration.Milliseconds(),
+			CreatedAt:  start,
 		}
 
-		_ = lg.repo.Write(lWrite)
-		return c.Next()
+		lg.writer.Write(lWrite)
+		return err
 	}
 }
 
+// GetLogs serves one page of the audit log, newest first. Filters: username,
+// method, path (a prefix), status, and from/to (RFC 3339, to exclusive).
 func (lg *Logger) GetLogs(c *fiber.Ctx) error {
-	logs, err := lg.repo.GetAllLogs()
+	filter, err := logFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	page, err := lg.repo.List(filter)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": err.Error()})
+	}
 	if err != nil {
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"error": "failed to fetch logs",
 		})
 	}
 
-	return c.JSON(logs)
+	return c.JSON(page)
+}
+
+func logFilter(c *fiber.Ctx) (repository.LogFilter, error) {
+	f := repository.LogFilter{
+		Username:   c.Query("username"),
+		Method:     c.Query("method"),
+		PathPrefix: c.Query("path"),
+		Cursor:     c.Query("cursor"),
+		Limit:      c.QueryInt("limit", defaultPageSize),
+	}
+	if f.Limit < 1 || f.Limit > maxPageSize {
+		return f, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+	}
+	if v := c.Query("status"); v != "" {
+		status, err := strconv.Atoi(v)
+		if err != nil {
+			return f, errors.New("status must be an HTTP status code")
+		}
+		f.Status = status
+	}
+	for key, t := range map[string]*time.Time{"from": &f.From, "to": &f.To} {
+		if v := c.Query(key); v != "" {
+			parsed, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("%s must be an RFC 3339 time", key)
+			}
+			*t = parsed
+		}
+	}
+	return f, nil
+}
+
+// RunRetention removes log entries older than maxAge now and then every
+// interval, archiving them first when archive is set. It is started by the
+// factory when LOG_RETENTION_DAYS is set.
+func (lg *Logger) RunRetention(maxAge, interval time.Duration, archive bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		n, err := lg.repo.Prune(time.Now().Add(-maxAge), archive)
+		if err != nil {
+			slog.Error("log retention", "err", err)
+		} else if n > 0 {
+			slog.Info("log retention: removed old entries", "count", n, "archived", archive)
+		}
+		<-ticker.C
+	}
 }
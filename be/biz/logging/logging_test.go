@@ -0,0 +1,142 @@
+package middlewarelogging
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	jwt "github.com/golang-jwt/jwt/v5"
+	authenhandler "my-source/sheet-payment/be/biz/auth"
+	"my-source/sheet-payment/be/repository"
+	"my-source/sheet-payment/be/repository/memory"
+)
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+	}{
+		{"empty", "application/json", "", ""},
+		{"json", "application/json", `{"username":"alice","password":"hunter2"}`,
+			`{"password":"[REDACTED]","username":"alice"}`},
+		{"nested json", "application/json; charset=utf-8",
+			`{"auth":{"refresh_token":"abc"},"items":[{"newPassword":"x","n":1}]}`,
+			`{"auth":{"refresh_token":"[REDACTED]"},"items":[{"n":1,"newPassword":"[REDACTED]"}]}`},
+		{"invalid json", "application/json", `{"password":`, "[invalid JSON, 12 bytes]"},
+		{"form", "application/x-www-form-urlencoded", "username=alice&Password=hunter2",
+			"Password=%5BREDACTED%5D&username=alice"},
+		{"other", "text/plain", "password=hunter2", "[16 bytes]"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactBody(tt.contentType, []byte(tt.body)); got != tt.want {
+				t.Errorf("redactBody = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	long := `{"note":"` + strings.Repeat("ễ", maxBodyLen) + `"}`
+	if got := redactBody("application/json", []byte(long)); !strings.HasSuffix(got, "…") ||
+		!strings.HasPrefix(got, `{"note":"ễ`) || len(got) > maxBodyLen+len("…") {
+		t.Errorf("long body kept %d bytes", len(got))
+	}
+}
+
+func TestBatchWriterFlushes(t *testing.T) {
+	repo := memory.NewLogRepository(memory.NewStore())
+	w := NewBatchWriter(repo, 10, 2, time.Hour)
+	for i := 0; i < 3; i++ {
+		w.Write(repository.UserLog{Username: "alice", Method: "GET", Path: "/blocks"})
+	}
+
+	// The first two fill a batch; the third waits for Close.
+	deadline := time.Now().Add(time.Second)
+	for count(t, repo) < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := count(t, repo); n != 2 {
+		t.Fatalf("%d entries written before Close, want 2", n)
+	}
+	w.Close()
+	if n := count(t, repo); n != 3 {
+		t.Fatalf("%d entries written after Close, want 3", n)
+	}
+}
+
+func count(t *testing.T, repo repository.ILogging) int {
+	t.Helper()
+	page, err := repo.List(repository.LogFilter{Limit: 100})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(page.Logs)
+}
+
+func TestLogUserActivity(t *testing.T) {
+	repo := memory.NewLogRepository(memory.NewStore())
+	lg := NewLogger(repo)
+
+	app := fiber.New(fiber.Config{
+		ProxyHeader:             "X-Real-IP",
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          []string{"0.0.0.0/0"},
+	})
+	app.Use(lg.LogUserActivity())
+	// Stands in for RejectRevoked on the routes behind it, which runs after
+	// the logger as in main.
+	app.Use("/blocks", func(c *fiber.Ctx) error {
+		c.Locals(authenhandler.ClaimsKey, jwt.MapClaims{"username": "bob"})
+		return c.Next()
+	})
+	app.Post("/login", func(c *fiber.Ctx) error {
+		return fiber.NewError(fiber.StatusUnauthorized, "wrong password")
+	})
+	app.Get("/blocks", func(c *fiber.Ctx) error { return c.SendString("[]") })
+
+	// A token nobody verified does not name the user.
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"username": "mallory"}).
+		SignedString([]byte("guess"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest("POST", "/login", strings.NewReader(`{"username":"alice","password":"hunter2"}`))
+	req.Header.Set("Authorization", "Bearer "+forged)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("X-Real-IP", "203.0.113.7")
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusUnauthorized {
+		t.Fatalf("status = %d, want 401", resp.StatusCode)
+	}
+	if _, err := app.Test(httptest.NewRequest("GET", "/blocks", nil), -1); err != nil {
+		t.Fatal(err)
+	}
+	lg.Close()
+
+	page, err := repo.List(repository.LogFilter{Limit: 10})
+	if err != nil || len(page.Logs) != 2 {
+		t.Fatalf("logs = %+v, %v; want two entries", page, err)
+	}
+	entries := map[string]repository.UserLog{}
+	for _, l := range page.Logs {
+		entries[l.Path] = l
+	}
+	if got := entries["/blocks"].Username; got != "bob" {
+		t.Errorf("username = %q, want bob from the verified claims", got)
+	}
+	got := entries["/login"]
+	if got.Username != "anonymous" || got.Method != "POST" || got.Path != "/login" ||
+		got.Status != fiber.StatusUnauthorized || got.IPAddress != "203.0.113.7" || got.UserAgent != "test-agent" {
+		t.Errorf("entry = %+v", got)
+	}
+	if strings.Contains(got.Body, "hunter2") || !strings.Contains(got.Body, `"username":"alice"`) {
+		t.Errorf("body = %q, want the password redacted", got.Body)
+	}
+}
@@ -0,0 +1,87 @@
+package middlewarelogging
+
+import (
+	"encoding/json"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxBodyLen caps how much of a request body is kept in the audit log.
+const maxBodyLen = 4096
+
+const redacted = "[REDACTED]"
+
+// sensitiveKeys are matched case-insensitively as substrings of a field
+// name, so refresh_token and newPassword are caught too.
+var sensitiveKeys = []string{"password", "token", "secret", "authorization", "jwt"}
+
+func sensitive(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range sensitiveKeys {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactBody returns the body as it should be stored: JSON and form bodies
+// with their sensitive fields masked, other content types only by size.
+func redactBody(contentType string, body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+
+	var out string
+	switch {
+	case strings.HasPrefix(contentType, "application/json"):
+		var v any
+		if err := json.Unmarshal(body, &v); err != nil {
+			return "[invalid JSON, " + strconv.Itoa(len(body)) + " bytes]"
+		}
+		data, _ := json.Marshal(redactValue(v))
+		out = string(data)
+	case strings.HasPrefix(contentType, "application/x-www-form-urlencoded"):
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return "[invalid form, " + strconv.Itoa(len(body)) + " bytes]"
+		}
+		for key := range form {
+			if sensitive(key) {
+				form[key] = []string{redacted}
+			}
+		}
+		out = form.Encode()
+	default:
+		return "[" + strconv.Itoa(len(body)) + " bytes]"
+	}
+
+	if len(out) > maxBodyLen {
+		n := maxBodyLen
+		for n > 0 && !utf8.RuneStart(out[n]) {
+			n--
+		}
+		out = out[:n] + "…"
+	}
+	return out
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, val := range v {
+			if sensitive(key) {
+				v[key] = redacted
+			} else {
+				v[key] = redactValue(val)
+			}
+		}
+	case []any:
+		for i, val := range v {
+			v[i] = redactValue(val)
+		}
+	}
+	return v
+}
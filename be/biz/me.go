@@ -0,0 +1,114 @@
+package mainbiz
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/gofiber/fiber/v2"
+	authenhandler "my-source/sheet-payment/be/biz/auth"
+	grouphandler "my-source/sheet-payment/be/biz/group"
+	"my-source/sheet-payment/be/repository"
+)
+
+// MyBalances is the user's debt in every block of every group where the
+// user is linked to a person. Totals adds the debts up per currency.
+type MyBalances struct {
+	Balances []repository.Membership `json:"balances"`
+	Totals   map[string]int64        `json:"totals"`
+}
+
+type LinkRequest struct {
+	Username string `json:"username"`
+}
+
+// LinkPerson links the person to the user named in the body, who must be a
+// member of the group, so the person's blocks show in that user's /me views.
+// An empty username unlinks the person.
+func (mb *MainBusiness) LinkPerson(c *fiber.Ctx) error {
+	var body LinkRequest
+	if err := c.BodyParser(&body); err != nil {
+		return fiber.ErrBadRequest
+	}
+
+	groupID := grouphandler.GroupID(c)
+	if body.Username != "" {
+		_, err := mb.groupRepo.GetRole(groupID, body.Username)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fiber.NewError(fiber.StatusBadRequest, body.Username+" is not a member of the group")
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	err := mb.personRepo.Link(groupID, c.Params("id"), body.Username)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fiber.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	person, err := mb.personRepo.GetByID(groupID, c.Params("id"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(person)
+}
+
+// myMemberships returns every block membership of the people linked to the
+// user, newest month first within each group.
+func (mb *MainBusiness) myMemberships(username string) ([]repository.Membership, error) {
+	people, err := mb.personRepo.GetByUsername(username)
+	if err != nil {
+		return nil, err
+	}
+	memberships := []repository.Membership{}
+	for _, p := range people {
+		m, err := mb.memberRepo.GetByPersonID(p.ID)
+		if err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, m...)
+	}
+	return memberships, nil
+}
+
+func (mb *MainBusiness) GetMyBalances(c *fiber.Ctx) error {
+	memberships, err := mb.myMemberships(authenhandler.Username(c))
+	if err != nil {
+		return err
+	}
+	balances := MyBalances{Balances: memberships, Totals: map[string]int64{}}
+	for _, m := range memberships {
+		balances.Totals[m.Debt.Currency] += m.Debt.Amount
+	}
+	return c.JSON(balances)
+}
+
+// GetMyTransactions serves one page of the transactions the user paid or
+// shares, across every block, with the filters of GetTransactionsByBlock.
+// Amounts are in each block's base currency.
+func (mb *MainBusiness) GetMyTransactions(c *fiber.Ctx) error {
+	filter, err := transactionFilter(c)
+	if err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+
+	memberships, err := mb.myMemberships(authenhandler.Username(c))
+	if err != nil {
+		return err
+	}
+	filter.Members = []string{}
+	for _, m := range memberships {
+		filter.Members = append(filter.Members, m.ID)
+	}
+
+	page, err := mb.transactionRepo.List(filter)
+	if errors.Is(err, repository.ErrInvalidCursor) {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	return c.JSON(page)
+}
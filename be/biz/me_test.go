@@ -0,0 +1,72 @@
+package mainbiz
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"my-source/sheet-payment/be/repository"
+)
+
+// link links the group's person with the given name to alice.
+func (f *fixture) link(name string) {
+	f.t.Helper()
+	var people []repository.Person
+	f.decode(f.expect("GET", "/members", nil, fiber.StatusOK), &people)
+	for _, p := range people {
+		if p.Name == name {
+			var linked repository.Person
+			f.decode(f.expect("PUT", "/people/"+p.ID+"/user", LinkRequest{Username: "alice"}, fiber.StatusOK), &linked)
+			if linked.Username != "alice" {
+				f.t.Fatalf("linked person = %+v", linked)
+			}
+			return
+		}
+	}
+	f.t.Fatalf("no person named %s in %+v", name, people)
+}
+
+func TestMe(t *testing.T) {
+	f := newFixture(t)
+	f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+		"amount": 300, "payer": f.ids["Alice"], "split_mode": "equal",
+		"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1, "Carol": 1}),
+	}, fiber.StatusOK)
+
+	var balances MyBalances
+	f.decode(f.expect("GET", "/me/balances", nil, fiber.StatusOK), &balances)
+	if len(balances.Balances) != 0 {
+		t.Fatalf("balances before linking = %+v, want none", balances)
+	}
+	f.expect("PUT", "/people/missing/user", LinkRequest{Username: "alice"}, fiber.StatusNotFound)
+	f.link("Alice")
+
+	// In the other group alice is Alice as well, and owes Dan.
+	f.groupID = "g2"
+	var block repository.Block
+	f.decode(f.expect("POST", "/blocks", map[string]any{
+		"month":   month,
+		"members": []map[string]any{{"name": "Alice", "ratio": 1}, {"name": "Dan", "ratio": 1}},
+	}, fiber.StatusOK), &block)
+	f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+		"amount": 100, "payer": block.Members[1].ID, "split_mode": "equal",
+		"ratios": map[string]float64{block.Members[0].ID: 1, block.Members[1].ID: 1},
+	}, fiber.StatusOK)
+	f.link("Alice")
+	f.groupID = ""
+
+	f.decode(f.expect("GET", "/me/balances", nil, fiber.StatusOK), &balances)
+	if len(balances.Balances) != 2 || balances.Totals[repository.DefaultCurrency] != 150 {
+		t.Errorf("balances = %+v, want two blocks totalling 150", balances)
+	}
+
+	var page repository.TransactionPage
+	f.decode(f.expect("GET", "/me/transactions", nil, fiber.StatusOK), &page)
+	if page.Total != 2 || page.Transactions[0].BlockID != block.ID {
+		t.Fatalf("feed = %+v, want both transactions, newest first", page)
+	}
+	for _, tx := range page.Transactions {
+		if tx.CreatedBy != "alice" {
+			t.Errorf("created_by = %q, want alice", tx.CreatedBy)
+		}
+	}
+}
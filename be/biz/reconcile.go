@@ -0,0 +1,162 @@
+package mainbiz
+
+import (
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"my-source/sheet-payment/be/repository"
+)
+
+// Discrepancy is a member whose ledger balance differs from the debt the
+// block's documents add up to.
+type Discrepancy struct {
+	GroupID  string           `json:"group_id"`
+	BlockID  string           `json:"block_id"`
+	Month    string           `json:"month"`
+	MemberID string           `json:"member_id"`
+	Name     string           `json:"name"`
+	Recorded repository.Money `json:"recorded" swaggertype:"integer"`
+	Expected repository.Money `json:"expected" swaggertype:"integer"`
+}
+
+type ReconcileReport struct {
+	RanAt         time.Time     `json:"ran_at"`
+	Blocks        int           `json:"blocks"`
+	Members       int           `json:"members"`
+	Repaired      bool          `json:"repaired"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// ReconcileBlocks recomputes every member's debt from the block's documents
+// and reports the members whose ledger balance has drifted. With repair an
+// adjustment entry brings the balance back in line. An empty month checks
+// every block of the group, and an empty group every block of every group.
+func (mb *MainBusiness) ReconcileBlocks(groupID, month string, repair bool) (ReconcileReport, error) {
+	report := ReconcileReport{RanAt: time.Now(), Repaired: repair, Discrepancies: []Discrepancy{}}
+
+	groupIDs := []string{groupID}
+	if groupID == "" {
+		groups, err := mb.groupRepo.GetAll()
+		if err != nil {
+			return report, err
+		}
+		groupIDs = groupIDs[:0]
+		for _, g := range groups {
+			groupIDs = append(groupIDs, g.ID)
+		}
+	}
+
+	var blocks []repository.Block
+	for _, groupID := range groupIDs {
+		if month != "" {
+			block, err := mb.blockRepo.GetByMonth(groupID, month)
+			if err != nil {
+				return report, err
+			}
+			blocks = append(blocks, block)
+			continue
+		}
+		all, err := mb.blockRepo.GetAllBlocks(groupID)
+		if err != nil {
+			return report, err
+		}
+		blocks = append(blocks, all...)
+	}
+
+	for _, block := range blocks {
+		// Read and repair each block in one unit of work, so the comparison
+		// is not skewed by a transaction landing in between.
+		err := mb.uow.Do(func(r repository.Repositories) error {
+			return reconcileBlock(r, block, repair, &report)
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	logDiscrepancies(report)
+	return report, nil
+}
+
+// errDrifted aborts the unit of work of a lock or rollover that found
+// drifted balances it was not asked to repair.
+var errDrifted = errors.New("balances drifted")
+
+// reconcileBlock compares the block's recorded debts with its documents
+// inside r and adds the drifted members to report, posting an adjustment
+// for each of them with repair.
+func reconcileBlock(r repository.Repositories, block repository.Block, repair bool, report *ReconcileReport) error {
+	members, err := r.Members.GetByBlockID(block.ID)
+	if err != nil {
+		return err
+	}
+	expected, err := r.Members.ExpectedDebts(block.ID)
+	if err != nil {
+		return err
+	}
+
+	report.Blocks++
+	report.Members += len(members)
+	for _, m := range members {
+		want := expected[m.ID]
+		if m.Debt.Amount == want.Amount {
+			continue
+		}
+		report.Discrepancies = append(report.Discrepancies, Discrepancy{
+			GroupID:  block.GroupID,
+			BlockID:  block.ID,
+			Month:    block.Month,
+			MemberID: m.ID,
+			Name:     m.Name,
+			Recorded: m.Debt,
+			Expected: want,
+		})
+		if repair {
+			adjust, err := want.Sub(m.Debt)
+			if err != nil {
+				return err
+			}
+			entries := repository.LedgerEntries(block.ID, repository.LedgerAdjustment, m.ID,
+				map[string]repository.Money{m.ID: adjust})
+			if err := r.Ledger.Post(entries); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func logDiscrepancies(report ReconcileReport) {
+	for _, d := range report.Discrepancies {
+		slog.Warn("reconcile: balance drifted", "group", d.GroupID, "month", d.Month, "member", d.Name, "member_id", d.MemberID,
+			"recorded", d.Recorded, "ledger", d.Expected, "repaired", report.Repaired)
+	}
+}
+
+// RunReconciler reconciles every block each interval until the process
+// exits. It is started by the factory when RECONCILE_INTERVAL is set.
+func (mb *MainBusiness) RunReconciler(interval time.Duration, repair bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for range ticker.C {
+		if _, err := mb.ReconcileBlocks("", "", repair); err != nil {
+			slog.Error("reconcile", "err", err)
+		}
+	}
+}
+
+// Reconcile serves POST /admin/reconcile. ?group= limits the run to one
+// group and, with ?month=, to one of its blocks; ?repair=true fixes the
+// drifted debts.
+func (mb *MainBusiness) Reconcile(c *fiber.Ctx) error {
+	if c.Query("month") != "" && c.Query("group") == "" {
+		return fiber.NewError(fiber.StatusBadRequest, "month needs a group")
+	}
+	report, err := mb.ReconcileBlocks(c.Query("group"), c.Query("month"), c.QueryBool("repair"))
+	if err != nil {
+		return err
+	}
+	return c.JSON(report)
+}
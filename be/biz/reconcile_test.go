@@ -0,0 +1,154 @@
+package mainbiz
+
+import (
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"my-source/sheet-payment/be/repository"
+	"my-source/sheet-payment/be/repository/memory"
+)
+
+// drift posts a ledger entry that no document accounts for, as a lost or
+// duplicated write would.
+func (f *fixture) drift(name string, delta int64) {
+	f.t.Helper()
+	blockID, _, err := memory.NewBlockRepository(f.store).GetIDByMonth(group, month)
+	if err != nil {
+		f.t.Fatal(err)
+	}
+	entries := repository.LedgerEntries(blockID, repository.LedgerAdjustment, "drift",
+		map[string]repository.Money{f.ids[name]: repository.NewMoney(delta, "")})
+	if err := memory.NewLedgerRepository(f.store).Post(entries); err != nil {
+		f.t.Fatal(err)
+	}
+}
+
+func TestReconcile(t *testing.T) {
+	tests := []struct {
+		name      string
+		drift     map[string]int64
+		query     string
+		wantFound int
+		// want is the summary after the run.
+		want map[string]int64
+	}{
+		{
+			name: "no drift",
+			want: map[string]int64{"Alice": 200, "Bob": -100, "Carol": -100},
+		},
+		{
+			name:      "report only",
+			drift:     map[string]int64{"Bob": 5},
+			wantFound: 1,
+			want:      map[string]int64{"Bob": -95},
+		},
+		{
+			name:      "repair",
+			drift:     map[string]int64{"Bob": 5, "Carol": -3},
+			query:     "?repair=true",
+			wantFound: 2,
+			want:      map[string]int64{"Alice": 200, "Bob": -100, "Carol": -100},
+		},
+		{
+			name:      "repair one month",
+			drift:     map[string]int64{"Alice": 1},
+			query:     "?repair=true&group=" + group + "&month=" + month,
+			wantFound: 1,
+			want:      map[string]int64{"Alice": 200, "Bob": -100, "Carol": -100},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newFixture(t)
+			f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+				"amount": 300, "payer": f.ids["Alice"], "split_mode": "equal",
+				"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1, "Carol": 1}),
+			}, fiber.StatusOK)
+
+			for name, delta := range tt.drift {
+				f.drift(name, delta)
+			}
+
+			var report ReconcileReport
+			f.decode(f.expect("POST", "/admin/reconcile"+tt.query, nil, fiber.StatusOK), &report)
+			if len(report.Discrepancies) != tt.wantFound || report.Members != 3 {
+				t.Fatalf("report = %+v, want %d discrepancies over 3 members", report, tt.wantFound)
+			}
+
+			got := f.summary()
+			for name, v := range tt.want {
+				if got[name] != v {
+					t.Errorf("balance of %s = %d, want %d", name, got[name], v)
+				}
+			}
+		})
+	}
+}
+
+func TestReconcileMonthNeedsGroup(t *testing.T) {
+	f := newFixture(t)
+	f.expect("POST", "/admin/reconcile?month="+month, nil, fiber.StatusBadRequest)
+}
+
+func TestLockBlockDrift(t *testing.T) {
+	f := newFixture(t)
+	f.drift("Bob", 10)
+
+	var report ReconcileReport
+	f.decode(f.expect("POST", "/blocks/"+month+"/lock", nil, fiber.StatusConflict), &report)
+	if len(report.Discrepancies) != 1 || report.Repaired {
+		t.Fatalf("report = %+v, want Bob's drift unrepaired", report)
+	}
+	if got := f.summary()["Bob"]; got != 10 {
+		t.Errorf("balance of Bob = %d, want the drift left alone", got)
+	}
+
+	// The drift alone would make the block look unsettled.
+	f.expect("POST", "/blocks/"+month+"/lock?require_settled=true&repair=true", nil, fiber.StatusOK)
+	assertSummary(t, f.summary(), map[string]int64{"Alice": 0, "Bob": 0, "Carol": 0})
+}
+
+func TestLockBlockRefusedKeepsDrift(t *testing.T) {
+	f := newFixture(t)
+	f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+		"amount": 100, "payer": f.ids["Alice"],
+		"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1}),
+	}, fiber.StatusOK)
+	f.drift("Bob", 10)
+
+	// An unsettled block is refused before the repair is committed.
+	f.expect("POST", "/blocks/"+month+"/lock?require_settled=true&repair=true", nil, fiber.StatusConflict)
+	if got := f.summary()["Bob"]; got != -40 {
+		t.Errorf("balance of Bob = %d, want the drift left alone", got)
+	}
+	var blocks []repository.Block
+	f.decode(f.expect("GET", "/blocks", nil, fiber.StatusOK), &blocks)
+	if blocks[0].Locked {
+		t.Error("block locked, want it left open")
+	}
+}
+
+func TestRolloverBlockDrift(t *testing.T) {
+	f := newFixture(t)
+	f.expect("POST", "/blocks/"+month+"/transactions", map[string]any{
+		"amount": 300, "payer": f.ids["Alice"], "split_mode": "equal",
+		"ratios": f.weights(map[string]float64{"Alice": 1, "Bob": 1, "Carol": 1}),
+	}, fiber.StatusOK)
+	f.drift("Bob", 10)
+
+	var report ReconcileReport
+	f.decode(f.expect("POST", "/blocks/"+month+"/rollover", map[string]any{"month": "2024-06"},
+		fiber.StatusConflict), &report)
+	if len(report.Discrepancies) != 1 || report.Discrepancies[0].Name != "Bob" {
+		t.Fatalf("report = %+v, want Bob's drift", report)
+	}
+	f.expect("GET", "/blocks/2024-06/summary", nil, fiber.StatusNotFound)
+
+	// Repaired, the documents' balances are carried rather than the drift.
+	f.expect("POST", "/blocks/"+month+"/rollover?repair=true", map[string]any{"month": "2024-06"},
+		fiber.StatusOK)
+	var next map[string]int64
+	f.decode(f.expect("GET", "/blocks/2024-06/summary", nil, fiber.StatusOK), &next)
+	assertSummary(t, next, map[string]int64{"Alice": 200, "Bob": -100, "Carol": -100})
+}
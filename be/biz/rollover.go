@@ -0,0 +1,145 @@
+package mainbiz
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	grouphandler "my-source/sheet-payment/be/biz/group"
+	"my-source/sheet-payment/be/repository"
+)
+
+// RolloverBlock closes the month and opens a new block with the same members.
+// Each unsettled balance is carried over as an opening balance that points
+// back to the member and block it came from, and the closed block is locked.
+// A month is rolled over once: a locked month, one whose balances were
+// already carried out or a new month that exists is a conflict, and so is a
+// month whose balances drifted unless ?repair=true.
+func (mb *MainBusiness) RolloverBlock(c *fiber.Ctx) error {
+	month := c.Params("month")
+	groupID := grouphandler.GroupID(c)
+	from, err := mb.blockRepo.GetByMonth(groupID, month)
+	if err != nil {
+		return err
+	}
+	fromBlockID := from.ID
+	if from.Locked {
+		return fiber.NewError(fiber.StatusConflict, "month is locked")
+	}
+	carried, err := mb.openingRepo.GetByFromBlockID(fromBlockID)
+	if err != nil {
+		return err
+	}
+	if len(carried) > 0 {
+		return fiber.NewError(fiber.StatusConflict, "month was already rolled over")
+	}
+
+	var req struct {
+		Month string `json:"month"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	if req.Month == "" || req.Month == month {
+		return fiber.NewError(fiber.StatusBadRequest, "new month is required and must differ")
+	}
+	if _, _, err := mb.blockRepo.GetIDByMonth(groupID, req.Month); err == nil {
+		return fiber.NewError(fiber.StatusConflict, req.Month+" already exists")
+	}
+
+	block := repository.Block{
+		ID:           uuid.New().String(),
+		GroupID:      from.GroupID,
+		Month:        req.Month,
+		Locked:       false,
+		BaseCurrency: from.BaseCurrency,
+	}
+
+	// The carried balances must be the ones the documents add up to, so a
+	// drifted month is refused with the reconcile report unless
+	// ?repair=true brings it back in line first, as when locking.
+	repair := c.QueryBool("repair")
+	report := ReconcileReport{RanAt: time.Now(), Repaired: repair, Discrepancies: []Discrepancy{}}
+	var openings []repository.OpeningBalance
+	err = mb.uow.Do(func(r repository.Repositories) error {
+		if err := reconcileBlock(r, from, repair, &report); err != nil {
+			return err
+		}
+		if len(report.Discrepancies) > 0 && !repair {
+			return errDrifted
+		}
+
+		members, err := r.Members.GetByBlockID(fromBlockID)
+		if err != nil {
+			return err
+		}
+		for _, m := range members {
+			block.Members = append(block.Members, &repository.Member{PersonID: m.PersonID, Name: m.Name, Ratio: m.Ratio})
+		}
+		if err := r.Blocks.Create(block); err != nil {
+			return err
+		}
+
+		// Create assigns the new member IDs in place, in the same order.
+		now := time.Now()
+		for i, m := range members {
+			if m.Debt.IsZero() {
+				continue
+			}
+			openings = append(openings, repository.OpeningBalance{
+				ID:           uuid.New().String(),
+				BlockID:      block.ID,
+				MemberID:     block.Members[i].ID,
+				Amount:       m.Debt,
+				FromBlockID:  fromBlockID,
+				FromMemberID: m.ID,
+				CreatedAt:    now,
+			})
+			block.Members[i].Debt = m.Debt
+		}
+		if err := r.Openings.Create(openings); err != nil {
+			return err
+		}
+
+		// Each opening moves the balance out of the closed block and into
+		// the new one.
+		var entries []repository.LedgerEntry
+		for _, ob := range openings {
+			entries = append(entries, repository.LedgerEntries(ob.BlockID, repository.LedgerOpening, ob.ID,
+				map[string]repository.Money{ob.MemberID: ob.Amount})...)
+			entries = append(entries, repository.LedgerEntries(ob.FromBlockID, repository.LedgerOpening, ob.ID,
+				map[string]repository.Money{ob.FromMemberID: ob.Amount.Neg()})...)
+		}
+		if err := r.Ledger.Post(entries); err != nil {
+			return err
+		}
+
+		return r.Blocks.Lock(from.GroupID, month)
+	})
+	if errors.Is(err, errDrifted) {
+		logDiscrepancies(report)
+		return c.Status(fiber.StatusConflict).JSON(report)
+	}
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	logDiscrepancies(report)
+	return c.JSON(fiber.Map{"block": block, "opening_balances": openings})
+}
+
+func (mb *MainBusiness) GetOpeningBalances(c *fiber.Ctx) error {
+	month := c.Params("month")
+	blockID, _, err := mb.blockRepo.GetIDByMonth(grouphandler.GroupID(c), month)
+	if err != nil {
+		return err
+	}
+
+	openings, err := mb.openingRepo.GetByBlockID(blockID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{})
+	}
+
+	return c.JSON(openings)
+}
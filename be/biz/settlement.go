@@ -0,0 +1,296 @@
+package mainbiz
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	grouphandler "my-source/sheet-payment/be/biz/group"
+	"my-source/sheet-payment/be/repository"
+)
+
+// maxExactMembers bounds the exact mode, which is exponential in the number
+// of members with a non-zero balance.
+const maxExactMembers = 16
+
+type Transfer struct {
+	Payer     string           `json:"payer"`
+	PayerName string           `json:"payer_name"`
+	Payee     string           `json:"payee"`
+	PayeeName string           `json:"payee_name"`
+	Amount    repository.Money `json:"amount" swaggertype:"integer"`
+}
+
+type balance struct {
+	memberID string
+	amount   int64
+}
+
+// greedyTransfers settles the balances by repeatedly matching the largest
+// debtor with the largest creditor. It needs at most n-1 transfers.
+func greedyTransfers(balances []balance) []Transfer {
+	var creditors, debtors []balance
+	for _, b := range balances {
+		switch {
+		case b.amount > 0:
+			creditors = append(creditors, b)
+		case b.amount < 0:
+			debtors = append(debtors, balance{memberID: b.memberID, amount: -b.amount})
+		}
+	}
+	byAmount := func(s []balance) func(i, j int) bool {
+		return func(i, j int) bool {
+			if s[i].amount != s[j].amount {
+				return s[i].amount > s[j].amount
+			}
+			return s[i].memberID < s[j].memberID
+		}
+	}
+	sort.Slice(creditors, byAmount(creditors))
+	sort.Slice(debtors, byAmount(debtors))
+
+	transfers := []Transfer{}
+	i, j := 0, 0
+	for i < len(debtors) && j < len(creditors) {
+		amount := min(debtors[i].amount, creditors[j].amount)
+		transfers = append(transfers, Transfer{
+			Payer:  debtors[i].memberID,
+			Payee:  creditors[j].memberID,
+			Amount: repository.NewMoney(amount, ""),
+		})
+		debtors[i].amount -= amount
+		creditors[j].amount -= amount
+		if debtors[i].amount == 0 {
+			i++
+		}
+		if creditors[j].amount == 0 {
+			j++
+		}
+	}
+	return transfers
+}
+
+// exactTransfers returns a plan with the minimal number of transfers. The
+// minimum is n minus the largest number of disjoint zero-sum groups the
+// balances can be partitioned into; each group is then settled greedily.
+func exactTransfers(balances []balance) ([]Transfer, error) {
+	var nonZero []balance
+	for _, b := range balances {
+		if b.amount != 0 {
+			nonZero = append(nonZero, b)
+		}
+	}
+	n := len(nonZero)
+	if n > maxExactMembers {
+		return nil, fmt.Errorf("exact mode supports at most %d members with a non-zero balance", maxExactMembers)
+	}
+
+	full := 1<<n - 1
+	sums := make([]int64, full+1)
+	groups := make([]int, full+1)
+	for mask := 1; mask <= full; mask++ {
+		low := mask & -mask
+		bit := 0
+		for 1<<bit != low {
+			bit++
+		}
+		sums[mask] = sums[mask^low] + nonZero[bit].amount
+		for i := 0; i < n; i++ {
+			if mask&(1<<i) != 0 && groups[mask^(1<<i)] > groups[mask] {
+				groups[mask] = groups[mask^(1<<i)]
+			}
+		}
+		if sums[mask] == 0 {
+			groups[mask]++
+		}
+	}
+
+	// Walk back from the full set along a best path; consecutive zero-sum
+	// masks on the path differ by exactly one zero-sum group.
+	transfers := []Transfer{}
+	cur, groupStart := full, full
+	for cur != 0 {
+		next := -1
+		for i := 0; i < n; i++ {
+			if cur&(1<<i) == 0 {
+				continue
+			}
+			prev := cur ^ (1 << i)
+			want := groups[cur]
+			if sums[cur] == 0 {
+				want--
+			}
+			if groups[prev] == want {
+				next = prev
+				break
+			}
+		}
+		cur = next
+		if sums[cur] == 0 {
+			var group []balance
+			for i := 0; i < n; i++ {
+				if (groupStart^cur)&(1<<i) != 0 {
+					group = append(group, nonZero[i])
+				}
+			}
+			transfers = append(transfers, greedyTransfers(group)...)
+			groupStart = cur
+		}
+	}
+	return transfers, nil
+}
+
+func (mb *MainBusiness) GetSettlements(c *fiber.Ctx) error {
+	month := c.Params("month")
+	block, err := mb.blockRepo.GetByMonth(grouphandler.GroupID(c), month)
+	if err != nil {
+		return err
+	}
+
+	members, err := mb.memberRepo.GetByBlockID(block.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{})
+	}
+
+	names := map[string]string{}
+	balances := make([]balance, 0, len(members))
+	for _, m := range members {
+		names[m.ID] = m.Name
+		balances = append(balances, balance{memberID: m.ID, amount: m.Debt.Amount})
+	}
+
+	transfers := []Transfer{}
+	switch c.Query("mode", "greedy") {
+	case "greedy":
+		transfers = greedyTransfers(balances)
+	case "exact":
+		if transfers, err = exactTransfers(balances); err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "mode must be greedy or exact")
+	}
+
+	for i := range transfers {
+		transfers[i].PayerName = names[transfers[i].Payer]
+		transfers[i].PayeeName = names[transfers[i].Payee]
+		transfers[i].Amount.Currency = block.BaseCurrency
+	}
+
+	return c.JSON(transfers)
+}
+
+func (mb *MainBusiness) AddSettlementPayment(c *fiber.Ctx) error {
+	month := c.Params("month")
+	block, err := mb.blockRepo.GetByMonth(grouphandler.GroupID(c), month)
+	if err != nil {
+		return err
+	}
+	blockID := block.ID
+
+	if block.Locked {
+		return fiber.NewError(fiber.StatusForbidden, "Page is block")
+	}
+
+	// Payments are recorded in the block's base currency.
+	var req struct {
+		Payer  string           `json:"payer"`
+		Payee  string           `json:"payee"`
+		Amount repository.Money `json:"amount"`
+		Note   string           `json:"note"`
+	}
+	if err := c.BodyParser(&req); err != nil {
+		return fiber.NewError(fiber.StatusBadRequest, err.Error())
+	}
+	req.Amount.Currency = block.BaseCurrency
+
+	if req.Amount.Amount <= 0 {
+		return fiber.NewError(fiber.StatusBadRequest, "amount must be > 0")
+	}
+	if req.Payer == req.Payee {
+		return fiber.NewError(fiber.StatusBadRequest, "payer and payee must differ")
+	}
+
+	members, err := mb.memberRepo.GetByBlockID(blockID)
+	if err != nil {
+		return err
+	}
+	inBlock := map[string]bool{}
+	for _, m := range members {
+		inBlock[m.ID] = true
+	}
+	if !inBlock[req.Payer] || !inBlock[req.Payee] {
+		return fiber.ErrNotFound
+	}
+
+	s := repository.Settlement{
+		ID:        uuid.New().String(),
+		BlockID:   blockID,
+		Payer:     req.Payer,
+		Payee:     req.Payee,
+		Amount:    req.Amount,
+		Note:      req.Note,
+		CreatedAt: time.Now(),
+	}
+
+	// The payer's debt shrinks and the payee's credit shrinks by the amount.
+	err = mb.uow.Do(func(r repository.Repositories) error {
+		if err := r.Settlements.Add(s); err != nil {
+			return err
+		}
+		return r.Ledger.Post(repository.LedgerEntries(blockID, repository.LedgerSettlement, s.ID, settlementDeltas(s)))
+	})
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(s)
+}
+
+func (mb *MainBusiness) GetSettlementPayments(c *fiber.Ctx) error {
+	month := c.Params("month")
+	blockID, _, err := mb.blockRepo.GetIDByMonth(grouphandler.GroupID(c), month)
+	if err != nil {
+		return err
+	}
+
+	settlements, err := mb.settlementRepo.GetByBlockID(blockID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{})
+	}
+
+	return c.JSON(settlements)
+}
+
+func (mb *MainBusiness) DeleteSettlementPayment(c *fiber.Ctx) error {
+	month := c.Params("month")
+	blockID, locked, err := mb.blockRepo.GetIDByMonth(grouphandler.GroupID(c), month)
+	if err != nil {
+		return err
+	}
+
+	if locked {
+		return fiber.NewError(fiber.StatusForbidden, "locked by this block")
+	}
+
+	s, err := mb.settlementRepo.GetByID(c.Params("id"))
+	if err != nil || s.BlockID != blockID {
+		return fiber.NewError(fiber.StatusNotFound, "not found settlement")
+	}
+
+	return mb.uow.Do(func(r repository.Repositories) error {
+		reversal := reverseDeltas(settlementDeltas(s))
+		if err := r.Ledger.Post(repository.LedgerEntries(blockID, repository.LedgerSettlement, s.ID, reversal)); err != nil {
+			return err
+		}
+		return r.Settlements.Delete(s.ID)
+	})
+}
+
+// settlementDeltas moves the payer's debt down and the payee's credit down by
+// the amount paid.
+func settlementDeltas(s repository.Settlement) map[string]repository.Money {
+	return map[string]repository.Money{s.Payer: s.Amount, s.Payee: s.Amount.Neg()}
+}
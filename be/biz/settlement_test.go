@@ -0,0 +1,87 @@
+package mainbiz
+
+import (
+	"fmt"
+	"testing"
+)
+
+// balances names the amounts m0, m1, ... in order.
+func balances(amounts ...int64) []balance {
+	bs := make([]balance, len(amounts))
+	for i, a := range amounts {
+		bs[i] = balance{memberID: fmt.Sprintf("m%d", i), amount: a}
+	}
+	return bs
+}
+
+// assertSettles checks that paying the transfers brings every balance to
+// zero, each transfer a positive amount from a debtor to a creditor.
+func assertSettles(t *testing.T, bs []balance, transfers []Transfer) {
+	t.Helper()
+	left := map[string]int64{}
+	for _, b := range bs {
+		left[b.memberID] = b.amount
+	}
+	for _, tr := range transfers {
+		if tr.Amount.Amount <= 0 || left[tr.Payer] >= 0 || left[tr.Payee] <= 0 {
+			t.Fatalf("transfer %+v does not move money from a debtor to a creditor (%v)", tr, left)
+		}
+		left[tr.Payer] += tr.Amount.Amount
+		left[tr.Payee] -= tr.Amount.Amount
+	}
+	for id, amount := range left {
+		if amount != 0 {
+			t.Errorf("balance of %s after the plan = %d, want 0", id, amount)
+		}
+	}
+}
+
+func TestSettlementPlans(t *testing.T) {
+	tests := []struct {
+		name     string
+		balances []balance
+		greedy   int
+		exact    int
+	}{
+		{name: "no members", balances: balances()},
+		{name: "all settled", balances: balances(0, 0, 0)},
+		{name: "one pair", balances: balances(5, -5, 0), greedy: 1, exact: 1},
+		{name: "one creditor", balances: balances(200, -100, -100), greedy: 2, exact: 2},
+		// +4 and -4 settle on their own, and so do +6, -3 and -3, but
+		// greedy pays the largest debt to the largest credit first.
+		{name: "exact beats greedy", balances: balances(6, 4, -4, -3, -3), greedy: 4, exact: 3},
+		{name: "pairs", balances: balances(5, 5, -5, -5, 2, -2), greedy: 3, exact: 3},
+		// Zero balances do not count towards the exact mode's cap.
+		{name: "at the cap", balances: append(balances(1, -1, 1, -1, 1, -1, 1, -1, 1, -1, 1, -1, 1, -1, 1, -1),
+			balance{memberID: "z1"}, balance{memberID: "z2"}), greedy: 8, exact: 8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			greedy := greedyTransfers(tt.balances)
+			if greedy == nil || len(greedy) != tt.greedy {
+				t.Errorf("greedy plan = %+v, want %d transfers", greedy, tt.greedy)
+			}
+			assertSettles(t, tt.balances, greedy)
+
+			exact, err := exactTransfers(tt.balances)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if exact == nil || len(exact) != tt.exact {
+				t.Errorf("exact plan = %+v, want %d transfers", exact, tt.exact)
+			}
+			assertSettles(t, tt.balances, exact)
+		})
+	}
+}
+
+func TestExactTransfersCap(t *testing.T) {
+	amounts := make([]int64, maxExactMembers+1)
+	for i := range amounts {
+		amounts[i] = 1
+	}
+	amounts[0] = -maxExactMembers
+	if _, err := exactTransfers(balances(amounts...)); err == nil {
+		t.Errorf("exact plan for %d members succeeded", len(amounts))
+	}
+}
@@ -0,0 +1,154 @@
+package mainbiz
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"my-source/sheet-payment/be/repository"
+)
+
+// TransactionRequest is the body of the add and update transaction APIs. The
+// fields of repository.Split (exact, items, tax, tip) sit at the top level.
+type TransactionRequest struct {
+	Amount      repository.Money   `json:"amount" swaggertype:"integer"`
+	Description string             `json:"description"`
+	Payer       string             `json:"payer"`
+	Currency    string             `json:"currency"`
+	SplitMode   string             `json:"split_mode"`
+	Ratios      map[string]float64 `json:"ratios"`
+	repository.Split
+}
+
+// resolveCurrency sets the currency of the entered amount, defaulting to the
+// block's base currency.
+func resolveCurrency(req *TransactionRequest, base string) error {
+	req.Currency = strings.ToUpper(strings.TrimSpace(req.Currency))
+	if req.Currency == "" {
+		req.Currency = base
+	}
+	if !repository.ValidCurrency(req.Currency) {
+		return fiber.NewError(fiber.StatusBadRequest, "currency must be an ISO-4217 code")
+	}
+	req.Amount.Currency = req.Currency
+	return nil
+}
+
+// applyDefaultRatios fills empty ratios with the block members' default
+// ratios, for the modes that split by weight. Members whose ratio is zero do
+// not take part. In percent mode the ratios are turned into percentages of
+// their total.
+func (mb *MainBusiness) applyDefaultRatios(blockID string, req *TransactionRequest) error {
+	if len(req.Ratios) > 0 {
+		return nil
+	}
+	switch req.SplitMode {
+	case "", repository.SplitEqual, repository.SplitShares, repository.SplitPercent:
+	default:
+		return nil
+	}
+
+	members, err := mb.memberRepo.GetByBlockID(blockID)
+	if err != nil {
+		return err
+	}
+	req.Ratios = map[string]float64{}
+	total := 0.0
+	for _, m := range members {
+		if m.Ratio > 0 {
+			req.Ratios[m.ID] = m.Ratio
+			total += m.Ratio
+		}
+	}
+	if req.SplitMode == repository.SplitPercent {
+		for memberID, ratio := range req.Ratios {
+			req.Ratios[memberID] = ratio * 100 / total
+		}
+	}
+	return nil
+}
+
+// splitShares resolves a validated request into each member's share, the
+// weights to record in the ratios column and the split input to keep.
+func (mb *MainBusiness) splitShares(req *TransactionRequest) (map[string]repository.Money, map[string]float64,
+	*repository.Split, error) {
+	switch req.SplitMode {
+	case repository.SplitEqual:
+		weights := make(map[string]float64, len(req.Ratios))
+		for memberID := range req.Ratios {
+			weights[memberID] = 1
+		}
+		details, err := mb.allocator.Split(req.Amount, weights, req.Payer)
+		return details, weights, nil, err
+
+	case repository.SplitExact:
+		details := make(map[string]repository.Money, len(req.Exact))
+		for memberID, amount := range req.Exact {
+			details[memberID] = repository.NewMoney(amount.Amount, req.Amount.Currency)
+		}
+		split := req.Split
+		return details, weightsOf(details), &split, nil
+
+	case repository.SplitItemized:
+		details, err := mb.itemizedShares(req)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		split := req.Split
+		return details, weightsOf(details), &split, nil
+	}
+
+	// shares and percent both split by the given weights
+	details, err := mb.allocator.Split(req.Amount, req.Ratios, req.Payer)
+	return details, req.Ratios, nil, err
+}
+
+// itemizedShares splits every item equally among its members, then spreads
+// tax and tip over the members in proportion to their item subtotal.
+func (mb *MainBusiness) itemizedShares(req *TransactionRequest) (map[string]repository.Money, error) {
+	currency := req.Amount.Currency
+	subtotals := map[string]repository.Money{}
+	for _, item := range req.Items {
+		weights := make(map[string]float64, len(item.Members))
+		for _, memberID := range item.Members {
+			weights[memberID] = 1
+		}
+		shares, err := mb.allocator.Split(repository.NewMoney(item.Amount.Amount, currency), weights, req.Payer)
+		if err != nil {
+			return nil, err
+		}
+		for memberID, share := range shares {
+			if subtotals[memberID], err = subtotals[memberID].Add(share); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	extra, err := repository.NewMoney(req.Tax.Amount, currency).Add(req.Tip)
+	if err != nil {
+		return nil, err
+	}
+	if extra.IsZero() {
+		return subtotals, nil
+	}
+
+	extraShares, err := mb.allocator.Split(extra, weightsOf(subtotals), req.Payer)
+	if err != nil {
+		return nil, err
+	}
+	for memberID, share := range extraShares {
+		if subtotals[memberID], err = subtotals[memberID].Add(share); err != nil {
+			return nil, err
+		}
+	}
+	return subtotals, nil
+}
+
+// weightsOf records resolved shares as relative weights, so ratios stays
+// meaningful for exact and itemized transactions too.
+func weightsOf(shares map[string]repository.Money) map[string]float64 {
+	weights := make(map[string]float64, len(shares))
+	for memberID, share := range shares {
+		weights[memberID] = float64(share.Amount)
+	}
+	return weights
+}
@@ -1,11 +1,15 @@
 package mainbiz
 
 import (
+	"fmt"
+	"math"
+
 	"github.com/gofiber/fiber/v2"
+	"my-source/sheet-payment/be/repository"
 )
 
-func (mb *MainBusiness) ValidateMemberInMonth(month string, member map[string]float64, payerId string) error {
-	blockId, locked, err := mb.blockRepo.GetIDByMonth(month)
+func (mb *MainBusiness) ValidateMemberInMonth(groupID, month string, member map[string]float64, payerId string) error {
+	blockId, locked, err := mb.blockRepo.GetIDByMonth(groupID, month)
 	if err != nil {
 		return err
 	}
@@ -13,8 +17,18 @@ func (mb *MainBusiness) ValidateMemberInMonth(month string, member map[string]fl
 	if locked {
 		return fiber.ErrForbidden
 	}
+	return mb.ValidateMemberInBlock(blockId, member, payerId)
+}
 
+// ValidateMemberInBlock checks that the payer and everyone sharing the
+// expense are members of the block, so no other block's balances move. The
+// payer need not share the expense, as with an exact or itemized split of a
+// bill paid for others.
+func (mb *MainBusiness) ValidateMemberInBlock(blockId string, member map[string]float64, payerId string) error {
 	memberInBlock, err := mb.memberRepo.GetByBlockID(blockId)
+	if err != nil {
+		return err
+	}
 	mp := map[string]bool{}
 	for _, m := range memberInBlock {
 		mp[m.ID] = true
@@ -26,9 +40,100 @@ func (mb *MainBusiness) ValidateMemberInMonth(month string, member map[string]fl
 		}
 	}
 
-	if _, ok := member[payerId]; !ok {
+	if !mp[payerId] {
 		return fiber.ErrForbidden
 	}
 
 	return nil
 }
+
+// percentTolerance absorbs float noise in percentages such as 33.33+33.33+33.34.
+const percentTolerance = 1e-6
+
+// ValidateSplit checks the rules of the transaction's split mode. An empty
+// mode means shares, the historical behaviour.
+func ValidateSplit(req *TransactionRequest) error {
+	if req.SplitMode == "" {
+		req.SplitMode = repository.SplitShares
+	}
+
+	switch req.SplitMode {
+	case repository.SplitEqual, repository.SplitShares:
+		if len(req.Ratios) == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "ratios must list the participants")
+		}
+		return validateWeights(req.Ratios)
+
+	case repository.SplitPercent:
+		if err := validateWeights(req.Ratios); err != nil {
+			return err
+		}
+		total := 0.0
+		for _, p := range req.Ratios {
+			total += p
+		}
+		if math.Abs(total-100) > percentTolerance {
+			return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("percentages must total 100, got %g", total))
+		}
+
+	case repository.SplitExact:
+		if len(req.Exact) == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "exact must list each member's amount")
+		}
+		var total repository.Money
+		for memberID, amount := range req.Exact {
+			if amount.Amount < 0 {
+				return fiber.NewError(fiber.StatusBadRequest, "amount of "+memberID+" must not be negative")
+			}
+			var err error
+			if total, err = total.Add(amount); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, err.Error())
+			}
+		}
+		if total.Amount != req.Amount.Amount {
+			return fiber.NewError(fiber.StatusBadRequest,
+				fmt.Sprintf("exact amounts total %d but the transaction amount is %d", total.Amount, req.Amount.Amount))
+		}
+
+	case repository.SplitItemized:
+		if len(req.Items) == 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "items must not be empty")
+		}
+		if req.Tax.Amount < 0 || req.Tip.Amount < 0 {
+			return fiber.NewError(fiber.StatusBadRequest, "tax and tip must not be negative")
+		}
+		total, err := req.Tax.Add(req.Tip)
+		if err != nil {
+			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		}
+		for i, item := range req.Items {
+			if item.Amount.Amount < 0 {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("item %d amount must not be negative", i))
+			}
+			if len(item.Members) == 0 {
+				return fiber.NewError(fiber.StatusBadRequest, fmt.Sprintf("item %d must be assigned to members", i))
+			}
+			if total, err = total.Add(item.Amount); err != nil {
+				return fiber.NewError(fiber.StatusBadRequest, err.Error())
+			}
+		}
+		if total.Amount != req.Amount.Amount {
+			return fiber.NewError(fiber.StatusBadRequest,
+				fmt.Sprintf("items, tax and tip total %d but the transaction amount is %d", total.Amount, req.Amount.Amount))
+		}
+
+	default:
+		return fiber.NewError(fiber.StatusBadRequest, "unknown split_mode "+req.SplitMode)
+	}
+
+	return nil
+}
+
+func validateWeights(weights map[string]float64) error {
+	for memberID, w := range weights {
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return fiber.NewError(fiber.StatusBadRequest, "ratio of "+memberID+" must be a non-negative number")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+// Package config loads the server's settings. Each value comes from, in
+// increasing priority, the defaults, the YAML file named by CONFIG_FILE
+// (config.yaml when it exists), and the environment, which a .env file in
+// the working directory adds to.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v2"
+	"my-source/sheet-payment/be/repository"
+)
+
+// EnvDev is the mode for local development: it runs with the built-in JWT
+// secret and an SQLite database when none is configured.
+const EnvDev = "dev"
+
+const (
+	// devSecret signed every token before the secret was configurable, so a
+	// server using it outside dev mode accepts tokens anyone can forge.
+	devSecret      = "j7akAxU"
+	minSecretBytes = 32
+	devDatabaseURL = "sqlite://expenses.db"
+)
+
+type Config struct {
+	Env         string        `yaml:"env"`
+	Port        int           `yaml:"port"`
+	DatabaseURL string        `yaml:"database_url"`
+	JWTSecret   string        `yaml:"jwt_secret"`
+	TokenTTL    time.Duration `yaml:"token_ttl"`
+	RefreshTTL  time.Duration `yaml:"refresh_token_ttl"`
+	CORSOrigins []string      `yaml:"cors_origins"`
+	LogLevel    string        `yaml:"log_level"`
+
+	// TrustedProxies may set the client address through X-Real-IP.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	SplitTieBreak  string   `yaml:"split_tie_break"`
+
+	// A zero ReconcileInterval turns the periodic reconciliation off, and
+	// zero LogRetentionDays keeps the audit log forever.
+	ReconcileInterval    time.Duration `yaml:"reconcile_interval"`
+	ReconcileRepair      bool          `yaml:"reconcile_repair"`
+	LogRetentionDays     int           `yaml:"log_retention_days"`
+	LogRetentionInterval time.Duration `yaml:"log_retention_interval"`
+	LogRetentionArchive  bool          `yaml:"log_retention_archive"`
+}
+
+func defaults() Config {
+	return Config{
+		Env:                  "production",
+		Port:                 3000,
+		TokenTTL:             15 * time.Minute,
+		RefreshTTL:           30 * 24 * time.Hour,
+		CORSOrigins:          []string{"*"},
+		LogLevel:             "info",
+		LogRetentionInterval: 24 * time.Hour,
+	}
+}
+
+// Load reads and validates the configuration.
+func Load() (Config, error) {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("load .env: %w", err)
+	}
+
+	cfg := defaults()
+	if err := cfg.readFile(os.Getenv("CONFIG_FILE")); err != nil {
+		return cfg, err
+	}
+	if err := cfg.readEnv(os.LookupEnv); err != nil {
+		return cfg, err
+	}
+	if cfg.Dev() {
+		if cfg.JWTSecret == "" {
+			cfg.JWTSecret = devSecret
+		}
+		if cfg.DatabaseURL == "" {
+			cfg.DatabaseURL = devDatabaseURL
+		}
+	}
+	return cfg, cfg.Validate()
+}
+
+// readFile merges the YAML file at path over c. Without a path config.yaml
+// is read if it exists.
+func (c *Config) readFile(path string) error {
+	optional := path == ""
+	if optional {
+		path = "config.yaml"
+	}
+	data, err := os.ReadFile(path)
+	if optional && errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := yaml.UnmarshalStrict(data, c); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// readEnv merges the variables that lookup finds over c.
+func (c *Config) readEnv(lookup func(string) (string, bool)) error {
+	vars := []struct {
+		name string
+		set  func(v string) error
+	}{
+		{"APP_ENV", setString(&c.Env)},
+		{"PORT", setInt(&c.Port)},
+		{"DATABASE_URL", setString(&c.DatabaseURL)},
+		{"JWT_SECRET", setString(&c.JWTSecret)},
+		{"TOKEN_TTL", setDuration(&c.TokenTTL)},
+		{"REFRESH_TOKEN_TTL", setDuration(&c.RefreshTTL)},
+		{"CORS_ORIGINS", setList(&c.CORSOrigins)},
+		{"LOG_LEVEL", setString(&c.LogLevel)},
+		{"TRUSTED_PROXIES", setList(&c.TrustedProxies)},
+		{"SPLIT_TIE_BREAK", setString(&c.SplitTieBreak)},
+		{"RECONCILE_INTERVAL", setDuration(&c.ReconcileInterval)},
+		{"RECONCILE_REPAIR", setBool(&c.ReconcileRepair)},
+		{"LOG_RETENTION_DAYS", setInt(&c.LogRetentionDays)},
+		{"LOG_RETENTION_INTERVAL", setDuration(&c.LogRetentionInterval)},
+		{"LOG_RETENTION_ARCHIVE", setBool(&c.LogRetentionArchive)},
+	}
+	var errs []error
+	for _, v := range vars {
+		if s, ok := lookup(v.name); ok && s != "" {
+			if err := v.set(s); err != nil {
+				errs = append(errs, fmt.Errorf("invalid %s %q", v.name, s))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Validate reports every setting that is out of range.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Port > 0 && c.Port < 65536, "port %d out of range", c.Port)
+	check(c.DatabaseURL != "", "database URL is not set")
+	check(c.TokenTTL > 0, "token TTL must be positive")
+	check(c.RefreshTTL > c.TokenTTL, "refresh token TTL must be longer than the token TTL")
+	check(len(c.CORSOrigins) > 0, "no CORS origins")
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.LogLevel)) == nil, "unknown log level %q", c.LogLevel)
+	_, err := repository.ParseTieBreak(c.SplitTieBreak)
+	check(err == nil, "unknown split tie-break %q", c.SplitTieBreak)
+	check(c.ReconcileInterval >= 0, "reconcile interval must not be negative")
+	check(c.LogRetentionDays >= 0, "log retention days must not be negative")
+	check(c.LogRetentionInterval > 0, "log retention interval must be positive")
+
+	check(c.JWTSecret != "", "JWT secret is not set")
+	if !c.Dev() && c.JWTSecret != "" {
+		check(c.JWTSecret != devSecret, "the built-in JWT secret is only allowed with APP_ENV=%s", EnvDev)
+		check(len(c.JWTSecret) >= minSecretBytes, "JWT secret must be at least %d bytes", minSecretBytes)
+	}
+	return errors.Join(errs...)
+}
+
+func (c Config) Dev() bool {
+	return c.Env == EnvDev
+}
+
+// Level is the minimum level of the server's log. It assumes a validated
+// config and falls back to info.
+func (c Config) Level() slog.Level {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(c.LogLevel))
+	return level
+}
+
+// Addr is the address the server listens on.
+func (c Config) Addr() string {
+	return ":" + strconv.Itoa(c.Port)
+}
+
+func setString(p *string) func(string) error {
+	return func(v string) error {
+		*p = v
+		return nil
+	}
+}
+
+func setInt(p *int) func(string) error {
+	return func(v string) (err error) {
+		*p, err = strconv.Atoi(v)
+		return err
+	}
+}
+
+func setBool(p *bool) func(string) error {
+	return func(v string) (err error) {
+		*p, err = strconv.ParseBool(v)
+		return err
+	}
+}
+
+func setDuration(p *time.Duration) func(string) error {
+	return func(v string) (err error) {
+		*p, err = time.ParseDuration(v)
+		return err
+	}
+}
+
+// setList splits a comma-separated value, dropping empty items.
+func setList(p *[]string) func(string) error {
+	return func(v string) error {
+		*p = nil
+		for _, item := range strings.Split(v, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*p = append(*p, item)
+			}
+		}
+		return nil
+	}
+}
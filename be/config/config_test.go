@@ -0,0 +1,89 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+const secret = "0123456789abcdef0123456789abcdef"
+
+func TestLoad(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("config.yaml", []byte(`
+port: 8080
+token_ttl: 1h
+jwt_secret: `+secret+`
+database_url: postgres://localhost/expenses
+cors_origins: [https://a.example]
+`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(".env", []byte("LOG_LEVEL=debug\nTOKEN_TTL=3h\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	// .env does not override variables that are already set. Setenv
+	// restores LOG_LEVEL after the test.
+	t.Setenv("LOG_LEVEL", "")
+	os.Unsetenv("LOG_LEVEL")
+	for _, name := range []string{"APP_ENV", "PORT", "DATABASE_URL", "JWT_SECRET", "CONFIG_FILE"} {
+		t.Setenv(name, "")
+	}
+	t.Setenv("TOKEN_TTL", "2h")
+	t.Setenv("CORS_ORIGINS", "https://b.example, https://c.example")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Addr() != ":8080" || cfg.TokenTTL != 2*time.Hour || cfg.LogLevel != "debug" ||
+		!slices.Equal(cfg.CORSOrigins, []string{"https://b.example", "https://c.example"}) {
+		t.Errorf("cfg = %+v", cfg)
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+	if _, err := Load(); err == nil {
+		t.Error("Load succeeded with a missing CONFIG_FILE")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want string
+	}{
+		{"dev defaults", map[string]string{"APP_ENV": "dev"}, ""},
+		{"production needs a secret", map[string]string{"DATABASE_URL": "sqlite://x.db"}, "JWT secret is not set"},
+		{"built-in secret outside dev", map[string]string{"DATABASE_URL": "sqlite://x.db", "JWT_SECRET": devSecret},
+			"only allowed with APP_ENV=dev"},
+		{"short secret", map[string]string{"DATABASE_URL": "sqlite://x.db", "JWT_SECRET": "short"}, "at least 32"},
+		{"production needs a database", map[string]string{"JWT_SECRET": secret}, "database URL is not set"},
+		{"production", map[string]string{"DATABASE_URL": "sqlite://x.db", "JWT_SECRET": secret}, ""},
+		{"bad log level", map[string]string{"APP_ENV": "dev", "LOG_LEVEL": "loud"}, "unknown log level"},
+		{"bad duration", map[string]string{"APP_ENV": "dev", "TOKEN_TTL": "1 day"}, "invalid TOKEN_TTL"},
+		{"bad tie-break", map[string]string{"APP_ENV": "dev", "SPLIT_TIE_BREAK": "coin"}, "unknown split tie-break"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			for _, name := range []string{"APP_ENV", "DATABASE_URL", "JWT_SECRET", "LOG_LEVEL", "TOKEN_TTL",
+				"SPLIT_TIE_BREAK", "CONFIG_FILE"} {
+				t.Setenv(name, tt.env[name])
+			}
+			_, err := Load()
+			if tt.want == "" && err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if tt.want != "" && (err == nil || !strings.Contains(err.Error(), tt.want)) {
+				t.Fatalf("Load error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -2,37 +2,81 @@ package factory
 
 import (
 	"github.com/gofiber/fiber/v2"
-	"github.com/joho/godotenv"
 	"log"
+	"log/slog"
 	mainbiz "my-source/sheet-payment/be/biz"
 	authenhandler "my-source/sheet-payment/be/biz/auth"
+	grouphandler "my-source/sheet-payment/be/biz/group"
 	middlewarelogging "my-source/sheet-payment/be/biz/logging"
+	"my-source/sheet-payment/be/config"
 	"my-source/sheet-payment/be/repository"
+	"time"
 )
 
 var (
+	cfg         config.Config
 	app         *fiber.App
 	bizInst     *mainbiz.MainBusiness
 	authInst    *authenhandler.AuthHandler
+	groupInst   *grouphandler.GroupHandler
 	loggingInst *middlewarelogging.Logger
+	auditInst   *mainbiz.Auditor
 )
 
 func Factory() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found or error loading it")
+	var err error
+	if cfg, err = config.Load(); err != nil {
+		log.Fatalf("config: %v", err)
 	}
+	slog.SetLogLoggerLevel(cfg.Level())
 
-	db := repository.InitDB()
-	logRepo := repository.NewLogRepository(db)
+	// The database URL selects the backend: sqlite:... or file:... for
+	// SQLite, anything else for Postgres.
+	db, driver := repository.InitDB(cfg.DatabaseURL)
+	q := repository.Bind(db, driver)
+	logRepo := repository.NewLogRepository(q)
 	loggingInst = middlewarelogging.NewLogger(logRepo)
 
-	memberRepo := repository.NewMemberRepository(db)
-	blockRepo := repository.NewBlockRepository(db)
-	transactionRepo := repository.NewTransactionRepository(db)
-	userRepo := repository.NewUserRepository(db)
-	authInst = authenhandler.NewAuthHandler(userRepo)
-	bizInst = mainbiz.NewMainBusiness(memberRepo, blockRepo, transactionRepo)
-	app = fiber.New()
+	groupRepo := repository.NewGroupRepository(q)
+	groupInst = grouphandler.NewGroupHandler(groupRepo)
+	memberRepo := repository.NewMemberRepository(q)
+	blockRepo := repository.NewBlockRepository(q)
+	transactionRepo := repository.NewTransactionRepository(q)
+	settlementRepo := repository.NewSettlementRepository(q)
+	openingRepo := repository.NewOpeningBalanceRepository(q)
+	personRepo := repository.NewPersonRepository(q)
+	fxRepo := repository.NewFXRateRepository(q)
+	userRepo := repository.NewUserRepository(q)
+	authInst = authenhandler.NewAuthHandler(userRepo, repository.NewTokenRepository(q), []byte(cfg.JWTSecret),
+		cfg.TokenTTL, cfg.RefreshTTL)
+	go authInst.RunCleanup(time.Hour)
+	uow := repository.NewUnitOfWork(db, driver)
+	tieBreak, err := repository.ParseTieBreak(cfg.SplitTieBreak)
+	if err != nil {
+		log.Fatal(err)
+	}
+	bizInst = mainbiz.NewMainBusiness(groupRepo, memberRepo, blockRepo, transactionRepo, settlementRepo, openingRepo, personRepo, fxRepo, uow, repository.NewAllocator(tieBreak))
+	auditInst = mainbiz.NewAuditor(repository.NewLedgerRepository(q), logRepo)
+
+	if cfg.ReconcileInterval > 0 {
+		go bizInst.RunReconciler(cfg.ReconcileInterval, cfg.ReconcileRepair)
+	}
+	if cfg.LogRetentionDays > 0 {
+		go loggingInst.RunRetention(time.Duration(cfg.LogRetentionDays)*24*time.Hour, cfg.LogRetentionInterval,
+			cfg.LogRetentionArchive)
+	}
+
+	// Behind nginx the client address comes from X-Real-IP, which is only
+	// trusted from the configured proxies (e.g. the docker network).
+	app = fiber.New(fiber.Config{
+		ProxyHeader:             "X-Real-IP",
+		EnableTrustedProxyCheck: true,
+		TrustedProxies:          cfg.TrustedProxies,
+	})
+}
+
+func GetConfig() config.Config {
+	return cfg
 }
 
 func GetApp() *fiber.App {
@@ -47,6 +91,14 @@ func GetLogging() *middlewarelogging.Logger {
 	return loggingInst
 }
 
+func GetAuditor() *mainbiz.Auditor {
+	return auditInst
+}
+
 func GetAuth() *authenhandler.AuthHandler {
 	return authInst
 }
+
+func GetGroups() *grouphandler.GroupHandler {
+	return groupInst
+}
@@ -4,10 +4,15 @@ package main
 import (
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/swagger"
-	_ "github.com/lib/pq"
 	"log"
 	authenhandler "my-source/sheet-payment/be/biz/auth"
+	grouphandler "my-source/sheet-payment/be/biz/group"
 	"my-source/sheet-payment/be/factory"
+	"my-source/sheet-payment/be/repository"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	_ "my-source/sheet-payment/be/docs"
 
@@ -32,32 +37,64 @@ import (
 // @in header
 // @name Authorization
 
-// @Summary Get all transactions for a block
+// @Summary List the transactions of a block, one page at a time
 // @Tags transactions
 // @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
 // @Produce json
 // @Param month path string true "Month"
-// @Success 200 {array} repository.Transaction
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, 1 to 200" default(50)
+// @Param sort query string false "created_at or -created_at" default(-created_at)
+// @Param payer query string false "Payer member ID"
+// @Param participant query string false "Member ID sharing the expense"
+// @Param min_amount query int false "Minimum amount in the base currency"
+// @Param max_amount query int false "Maximum amount in the base currency"
+// @Param from query string false "From date (YYYY-MM-DD), inclusive"
+// @Param to query string false "To date (YYYY-MM-DD), inclusive"
+// @Param q query string false "Words the description must contain, matched as whole words by full-text search on Postgres"
+// @Success 200 {object} repository.TransactionPage
+// @Failure 400 {object} map[string]string
 // @Router /blocks/{month}/transactions [get]
 func getTransactionsByBlock(c *fiber.Ctx) error {
 	return factory.GetBiz().GetTransactionsByBlock(c)
 }
 
 // @Summary Get all members
+// @Description Lists every person once, with the stable ID shared by all their block memberships
 // @Tags members
 // @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
 // @Produce json
-// @Success 200 {array} repository.Member
+// @Success 200 {array} repository.Person
 // @Router /members [get]
 func getAllMembers(c *fiber.Ctx) error {
 	return factory.GetBiz().GetAllMembers(c)
 }
 
+// @Summary Get a person's memberships across blocks
+// @Tags members
+// @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
+// @Produce json
+// @Param id path string true "Person ID"
+// @Success 200 {object} map[string]interface{}
+// @Failure 404 {object} map[string]string
+// @Router /people/{id}/memberships [get]
+func getPersonMemberships(c *fiber.Ctx) error {
+	return factory.GetBiz().GetPersonMemberships(c)
+}
+
 // @Summary Lock a block
 // @Tags blocks
 // @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
 // @Param month path string true "Month"
+// @Param require_settled query bool false "Refuse to lock while any balance is non-zero"
+// @Param repair query bool false "Repair drifted balances instead of refusing to lock"
 // @Success 200 {string} string "locked"
+// @Failure 409 {object} mainbiz.ReconcileReport "Balances drifted from the ledger, or unsettled"
+// @Failure 403 {object} map[string]string "Group admin only"
 // @Router /blocks/{month}/lock [post]
 func lockBlock(c *fiber.Ctx) error {
 	return factory.GetBiz().LockBlock(c)
@@ -66,8 +103,10 @@ func lockBlock(c *fiber.Ctx) error {
 // @Summary Unlock a block
 // @Tags blocks
 // @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
 // @Param month path string true "Month"
 // @Success 200 {string} string "unlocked"
+// @Failure 403 {object} map[string]string "Group admin only"
 // @Router /blocks/{month}/unlock [post]
 func unlockBlock(c *fiber.Ctx) error {
 	return factory.GetBiz().UnlockBlock(c)
@@ -76,6 +115,7 @@ func unlockBlock(c *fiber.Ctx) error {
 // @Summary Get summary of member debts in a block
 // @Tags blocks
 // @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
 // @Produce json
 // @Param month path string true "Month"
 // @Success 200 {object} map[string]int
@@ -84,13 +124,71 @@ func getSummary(c *fiber.Ctx) error {
 	return factory.GetBiz().GetSummary(c)
 }
 
+// @Summary Suggest transfers that settle a block
+// @Description Computes who should pay whom from the members' net debts. mode=exact finds the minimal number of transfers for small groups.
+// @Tags blocks
+// @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
+// @Produce json
+// @Param month path string true "Month"
+// @Param mode query string false "greedy (default) or exact"
+// @Success 200 {array} mainbiz.Transfer
+// @Failure 400 {object} map[string]string
+// @Router /blocks/{month}/settlements [get]
+func getSettlements(c *fiber.Ctx) error {
+	return factory.GetBiz().GetSettlements(c)
+}
+
+// @Summary Record a settlement payment
+// @Description Records that one member paid another back; moves both members' debts.
+// @Tags settlements
+// @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
+// @Accept json
+// @Produce json
+// @Param month path string true "Month"
+// @Param body body repository.Settlement true "Payer, payee, amount and note"
+// @Success 200 {object} repository.Settlement
+// @Failure 400 {object} map[string]string
+// @Router /blocks/{month}/settlements/payments [post]
+func addSettlementPayment(c *fiber.Ctx) error {
+	return factory.GetBiz().AddSettlementPayment(c)
+}
+
+// @Summary List settlement payments of a block
+// @Tags settlements
+// @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
+// @Produce json
+// @Param month path string true "Month"
+// @Success 200 {array} repository.Settlement
+// @Router /blocks/{month}/settlements/payments [get]
+func getSettlementPayments(c *fiber.Ctx) error {
+	return factory.GetBiz().GetSettlementPayments(c)
+}
+
+// @Summary Delete a settlement payment
+// @Description Removes the payment and reverts its effect on member debts
+// @Tags settlements
+// @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
+// @Param month path string true "Month"
+// @Param id path string true "Settlement ID"
+// @Success 200 {string} string "OK"
+// @Failure 404 {object} map[string]string
+// @Router /blocks/{month}/settlements/payments/{id} [delete]
+func deleteSettlementPayment(c *fiber.Ctx) error {
+	return factory.GetBiz().DeleteSettlementPayment(c)
+}
+
 // @Summary Add a transaction to a block
 // @Tags transactions
 // @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
 // @Accept json
 // @Produce json
 // @Param month path string true "Month"
-// @Param body body repository.Transaction true "Transaction info"
+// @Param body body mainbiz.TransactionRequest true "Transaction info; split_mode is equal, shares (default), percent, exact or itemized"
 // @Success 200 {object} map[string]interface{}
 // @Router /blocks/{month}/transactions [post]
 func addTransaction(c *fiber.Ctx) error {
@@ -100,6 +198,7 @@ func addTransaction(c *fiber.Ctx) error {
 // @Summary Create a new block
 // @Tags blocks
 // @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
 // @Accept json
 // @Produce json
 // @Param body body repository.CreateBlock true "Month and members"
@@ -109,9 +208,80 @@ func createBlock(c *fiber.Ctx) error {
 	return factory.GetBiz().CreateBlock(c)
 }
 
+// @Summary Roll a block over into a new month
+// @Description Opens a new block with the same members, carries every unsettled balance over as an opening balance and locks the old block.
+// @Tags blocks
+// @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
+// @Accept json
+// @Produce json
+// @Param month path string true "Month to close"
+// @Param body body object true "Object with the new month"
+// @Param repair query bool false "Repair drifted balances instead of refusing to roll over"
+// @Success 200 {object} map[string]interface{}
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string "Group admin only, as rolling over locks the month"
+// @Failure 409 {object} mainbiz.ReconcileReport "Balances drifted from the ledger, the month is locked or already rolled over, or the new month exists"
+// @Router /blocks/{month}/rollover [post]
+func rolloverBlock(c *fiber.Ctx) error {
+	return factory.GetBiz().RolloverBlock(c)
+}
+
+// @Summary Get opening balances carried into a block
+// @Tags blocks
+// @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
+// @Produce json
+// @Param month path string true "Month"
+// @Success 200 {array} repository.OpeningBalance
+// @Router /blocks/{month}/opening-balances [get]
+func getOpeningBalances(c *fiber.Ctx) error {
+	return factory.GetBiz().GetOpeningBalances(c)
+}
+
+// @Summary List FX rates
+// @Tags fx
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} repository.FXRate
+// @Router /fx-rates [get]
+func getFXRates(c *fiber.Ctx) error {
+	return factory.GetBiz().GetFXRates(c)
+}
+
+// @Summary Add or replace FX rates
+// @Tags fx
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body []repository.FXRate true "Rates"
+// @Success 200 {object} map[string]int
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string "Admin only, as every group converts with the rates"
+// @Router /fx-rates [post]
+func addFXRates(c *fiber.Ctx) error {
+	return factory.GetBiz().AddFXRates(c)
+}
+
+// @Summary Import FX rates from CSV
+// @Description CSV columns: date,from_currency,to_currency,rate (header optional)
+// @Tags fx
+// @Security BearerAuth
+// @Accept multipart/form-data
+// @Produce json
+// @Param file formData file true "CSV file"
+// @Success 200 {object} map[string]int
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string "Admin only, as every group converts with the rates"
+// @Router /fx-rates/import [post]
+func importFXRates(c *fiber.Ctx) error {
+	return factory.GetBiz().ImportFXRates(c)
+}
+
 // @Summary Get members of a specific block
 // @Tags members
 // @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
 // @Produce json
 // @Param month path string true "Month"
 // @Success 200 {array} repository.Member
@@ -120,10 +290,28 @@ func getMembersByBlock(c *fiber.Ctx) error {
 	return factory.GetBiz().GetMembersByLockId(c)
 }
 
+// @Summary Update a member's default ratio
+// @Description The default ratio is used by transactions that omit ratios
+// @Tags members
+// @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
+// @Accept json
+// @Produce json
+// @Param month path string true "Month"
+// @Param id path string true "Member ID"
+// @Param body body object true "Object with the new ratio"
+// @Success 200 {object} repository.Member
+// @Failure 404 {object} map[string]string
+// @Router /blocks/{month}/members/{id} [put]
+func updateMemberRatio(c *fiber.Ctx) error {
+	return factory.GetBiz().UpdateMemberRatio(c)
+}
+
 // @Summary Delete a transaction by ID
 // @Description Removes a transaction and updates member debts accordingly
 // @Tags transactions
 // @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
 // @Param id path string true "Transaction ID"
 // @Success 204 {string} string "No Content"
 // @Router /transactions/{id} [delete]
@@ -136,7 +324,7 @@ func deleteTransaction(c *fiber.Ctx) error {
 // @Accept json
 // @Produce json
 // @Param body body authenhandler.LoginRequest true "Credentials"
-// @Success 200 {object} map[string]string
+// @Success 200 {object} authenhandler.TokenResponse
 // @Router /login [post]
 func login(c *fiber.Ctx) error {
 	return factory.GetAuth().Login(c)
@@ -153,24 +341,124 @@ func register(c *fiber.Ctx) error {
 	return factory.GetAuth().Register(c)
 }
 
-// @Summary Get all user logs
-// @Description Retrieve all user logs
+// Refresh godoc
+// @Summary Trade a refresh token for new tokens
+// @Description Returns a new access token and a new refresh token. Each refresh token works once; presenting a used one revokes every token issued from the same login.
+// @Tags auth
+// @Accept json
+// @Produce json
+// @Param body body authenhandler.RefreshRequest true "Refresh token"
+// @Success 200 {object} authenhandler.TokenResponse
+// @Failure 401 {object} map[string]string
+// @Router /auth/refresh [post]
+func refresh(c *fiber.Ctx) error {
+	return factory.GetAuth().Refresh(c)
+}
+
+// Logout godoc
+// @Summary Log out
+// @Description Revokes the access token and, when given, its refresh token
+// @Tags auth
+// @Security BearerAuth
+// @Accept json
+// @Param body body authenhandler.RefreshRequest false "Refresh token to revoke"
+// @Param all query bool false "Revoke every refresh token of the user"
+// @Success 204 {string} string "No Content"
+// @Router /auth/logout [post]
+func logout(c *fiber.Ctx) error {
+	return factory.GetAuth().Logout(c)
+}
+
+// @Summary List user logs, one page at a time
+// @Description Retrieve the user logs newest first, filtered by the query parameters
 // @Tags logs
 // @Security BearerAuth
 // @Accept json
 // @Produce json
 // @Security ApiKeyAuth
-// @Success 200 {array} repository.UserLog
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, 1 to 200" default(50)
+// @Param username query string false "Username"
+// @Param method query string false "HTTP method"
+// @Param path query string false "Path prefix"
+// @Param status query int false "Response status code"
+// @Param from query string false "From time (RFC 3339), inclusive"
+// @Param to query string false "To time (RFC 3339), exclusive"
+// @Success 200 {object} repository.LogPage
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string "Admin only"
 // @Router /logs [get]
 func getLogs(c *fiber.Ctx) error {
 	return factory.GetLogging().GetLogs(c)
 }
 
+// @Summary Reconcile member balances with the ledger
+// @Description Recomputes every member's debt from transactions, settlement payments and carried-over balances and reports the members whose stored debt differs
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Param group query string false "Only reconcile this group"
+// @Param month query string false "Only reconcile this month of the group"
+// @Param repair query bool false "Overwrite drifted debts with the ledger's"
+// @Success 200 {object} mainbiz.ReconcileReport
+// @Failure 400 {object} map[string]string "Month without a group"
+// @Failure 403 {object} map[string]string "Admin only"
+// @Router /admin/reconcile [post]
+func reconcile(c *fiber.Ctx) error {
+	return factory.GetBiz().Reconcile(c)
+}
+
+// VerifyAudit godoc
+// @Summary Verify the ledger and audit log hash chains
+// @Description Walks the hash chains of the ledger and the audit log and reports the first entry of each that was edited or deleted outside the application
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} mainbiz.AuditReport
+// @Failure 403 {object} map[string]string "Admin only"
+// @Router /admin/audit/verify [get]
+func verifyAudit(c *fiber.Ctx) error {
+	return factory.GetAuditor().VerifyChains(c)
+}
+
+// GetUsers godoc
+// @Summary List users and their roles
+// @Description Admin only
+// @Tags admin
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} authenhandler.UserInfo
+// @Failure 403 {object} map[string]string
+// @Router /admin/users [get]
+func getUsers(c *fiber.Ctx) error {
+	return factory.GetAuth().GetUsers(c)
+}
+
+// SetUserRole godoc
+// @Summary Change a user's role
+// @Description Admin only. The role is one of viewer, editor and admin and applies from the user's next token refresh.
+// @Tags admin
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param username path string true "Username"
+// @Param body body authenhandler.RoleRequest true "New role"
+// @Success 200 {object} authenhandler.UserInfo
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Would leave no admin"
+// @Router /admin/users/{username}/role [put]
+func setUserRole(c *fiber.Ctx) error {
+	return factory.GetAuth().SetRole(c)
+}
+
 // GetAllBlocks godoc
 // @Summary Get all blocks
 // @Description Get list of all blocks
 // @Tags blocks
 // @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
 // @Produce json
 // @Success 200 {array} repository.Block
 // @Failure 500 {object} object
@@ -184,9 +472,11 @@ func getBlocks(c *fiber.Ctx) error {
 // @Description  Xóa block theo ID, đồng thời xóa toàn bộ members và transactions liên quan
 // @Tags         blocks
 // @Security BearerAuth
+// @Param        X-Group-ID  header    string  false  "Group ID, optional for members of one group"
 // @Param        blockID   path      string  true  "ID của block"
 // @Success      204       "Xóa thành công"
 // @Failure      400       {object}  map[string]string  "Invalid ID"
+// @Failure      403       {object}  map[string]string  "Group admin only"
 // @Failure      500       {object}  map[string]string  "Internal server error"
 // @Router       /blocks/{blockID} [delete]
 // @Security     ApiKeyAuth
@@ -199,11 +489,12 @@ func deleteBlock(c *fiber.Ctx) error {
 // @Description  Cập nhật mô tả, số tiền, người trả và tỉ lệ chia của một giao dịch
 // @Tags         transactions
 // @Security     BearerAuth
+// @Param        X-Group-ID  header    string  false  "Group ID, optional for members of one group"
 // @Param        id         path      string  true  "ID của giao dịch"
 // @Accept       json
 // @Produce      json
 //
-// @Param body body repository.UpdateTransactionPayload true "Update transaction payload"
+// @Param body body mainbiz.TransactionRequest true "Update transaction payload"
 // @Success      200       {object}  map[string]string  "Transaction updated"
 // @Failure      400       {object}  map[string]string  "Invalid input"
 // @Failure      404       {object}  map[string]string  "Transaction not found"
@@ -213,20 +504,167 @@ func updateTransaction(c *fiber.Ctx) error {
 	return factory.GetBiz().UpdateTransaction(c)
 }
 
+// GetGroups godoc
+// @Summary List the user's groups
+// @Description Lists the groups the user is a member of, with the user's role in each
+// @Tags groups
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {array} repository.Group
+// @Router /groups [get]
+func getGroups(c *fiber.Ctx) error {
+	return factory.GetGroups().GetGroups(c)
+}
+
+// CreateGroup godoc
+// @Summary Create a group
+// @Description Creates a group that owns its own blocks, with the user as its admin. Needs the editor role.
+// @Tags groups
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param body body grouphandler.CreateGroupRequest true "Group name"
+// @Success 200 {object} repository.Group
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Router /groups [post]
+func createGroup(c *fiber.Ctx) error {
+	return factory.GetGroups().CreateGroup(c)
+}
+
+// GetGroupMembers godoc
+// @Summary List the members of a group
+// @Tags groups
+// @Security BearerAuth
+// @Produce json
+// @Param groupId path string true "Group ID"
+// @Success 200 {array} repository.GroupMember
+// @Failure 404 {object} map[string]string
+// @Router /groups/{groupId}/members [get]
+func getGroupMembers(c *fiber.Ctx) error {
+	return factory.GetGroups().GetMembers(c)
+}
+
+// SetGroupMember godoc
+// @Summary Add a user to a group or change their role
+// @Description Group admin only. The role is one of viewer, editor and admin.
+// @Tags groups
+// @Security BearerAuth
+// @Accept json
+// @Produce json
+// @Param groupId path string true "Group ID"
+// @Param username path string true "Username"
+// @Param body body authenhandler.RoleRequest true "Role in the group"
+// @Success 200 {object} repository.GroupMember
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Would leave the group without an admin"
+// @Router /groups/{groupId}/members/{username} [put]
+func setGroupMember(c *fiber.Ctx) error {
+	return factory.GetGroups().SetMember(c)
+}
+
+// RemoveGroupMember godoc
+// @Summary Remove a user from a group
+// @Description Group admin only
+// @Tags groups
+// @Security BearerAuth
+// @Param groupId path string true "Group ID"
+// @Param username path string true "Username"
+// @Success 204 {string} string "No Content"
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Failure 409 {object} map[string]string "Would leave the group without an admin"
+// @Router /groups/{groupId}/members/{username} [delete]
+func removeGroupMember(c *fiber.Ctx) error {
+	return factory.GetGroups().RemoveMember(c)
+}
+
+// LinkPerson godoc
+// @Summary Link a person to a user
+// @Description Group admin only. The user, who must be a member of the group, sees the person's blocks under /me. An empty username unlinks the person.
+// @Tags members
+// @Security BearerAuth
+// @Param X-Group-ID header string false "Group ID, optional for members of one group"
+// @Accept json
+// @Produce json
+// @Param id path string true "Person ID"
+// @Param body body mainbiz.LinkRequest true "Username, empty to unlink"
+// @Success 200 {object} repository.Person
+// @Failure 400 {object} map[string]string
+// @Failure 403 {object} map[string]string
+// @Failure 404 {object} map[string]string
+// @Router /people/{id}/user [put]
+func linkPerson(c *fiber.Ctx) error {
+	return factory.GetBiz().LinkPerson(c)
+}
+
+// GetMyBalances godoc
+// @Summary Get the user's balances
+// @Description Lists the debt of the people linked to the user in every block of every group, with totals per currency
+// @Tags me
+// @Security BearerAuth
+// @Produce json
+// @Success 200 {object} mainbiz.MyBalances
+// @Router /me/balances [get]
+func getMyBalances(c *fiber.Ctx) error {
+	return factory.GetBiz().GetMyBalances(c)
+}
+
+// GetMyTransactions godoc
+// @Summary List the user's transactions, one page at a time
+// @Description Lists the transactions the people linked to the user paid or share, across every block of every group
+// @Tags me
+// @Security BearerAuth
+// @Produce json
+// @Param cursor query string false "next_cursor of the previous page"
+// @Param limit query int false "Page size, 1 to 200" default(50)
+// @Param sort query string false "created_at or -created_at" default(-created_at)
+// @Param payer query string false "Payer member ID"
+// @Param participant query string false "Member ID sharing the expense"
+// @Param min_amount query int false "Minimum amount in the block's base currency"
+// @Param max_amount query int false "Maximum amount in the block's base currency"
+// @Param from query string false "From date (YYYY-MM-DD), inclusive"
+// @Param to query string false "To date (YYYY-MM-DD), inclusive"
+// @Param q query string false "Words the description must contain, matched as whole words by full-text search on Postgres"
+// @Success 200 {object} repository.TransactionPage
+// @Failure 400 {object} map[string]string
+// @Router /me/transactions [get]
+func getMyTransactions(c *fiber.Ctx) error {
+	return factory.GetBiz().GetMyTransactions(c)
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		runAudit(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "user" {
+		runUser(os.Args[2:])
+		return
+	}
+
 	factory.Factory()
 	app := factory.GetApp()
 	app.Use(cors.New(cors.Config{
-		AllowOrigins: "*",
-		AllowHeaders: "Origin, Content-Type, Accept, Authorization",
+		AllowOrigins: strings.Join(factory.GetConfig().CORSOrigins, ","),
+		AllowHeaders: "Origin, Content-Type, Accept, Authorization, " + grouphandler.HeaderGroupID,
 	}))
 
 	app.Get("/swagger/*", swagger.HandlerDefault)
+	// Everything below is audited, sign-ins and rejected tokens included.
+	app.Use(factory.GetLogging().LogUserActivity())
 	app.Post("/login", login)
 	app.Post("/register", register)
+	app.Post("/auth/refresh", refresh)
 
 	protected := app.Group("/", jwtware.New(jwtware.Config{
-		SigningKey: authenhandler.JwtSecret,
+		SigningKey: []byte(factory.GetConfig().JWTSecret),
 		ErrorHandler: func(c *fiber.Ctx, err error) error {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
 				"error":   "unauthorized",
@@ -235,20 +673,71 @@ func main() {
 		},
 	}))
 
-	protected.Use(factory.GetLogging().LogUserActivity())
-	protected.Get("/blocks", getBlocks)
-	protected.Post("/blocks", createBlock)
-	protected.Delete("/blocks/:blockId/", deleteBlock)
-	protected.Post("/blocks/:month/transactions", addTransaction)
-	protected.Get("/blocks/:month/transactions", getTransactionsByBlock)
-	protected.Get("/blocks/:month/summary", getSummary)
-	protected.Get("/members", getAllMembers)
-	protected.Post("/blocks/:month/lock", lockBlock)
-	protected.Post("/blocks/:month/unlock", unlockBlock)
-	protected.Get("/blocks/:month/members", getMembersByBlock)
-	protected.Delete("/transactions/:id", deleteTransaction)
-	protected.Get("/logs", getLogs)
-	protected.Put("/transactions/:id", updateTransaction)
-
-	log.Fatal(app.Listen(":3000"))
+	protected.Use(factory.GetAuth().RejectRevoked())
+	protected.Post("/auth/logout", logout)
+
+	// Block routes work in one group, picked by the X-Group-ID header, and
+	// check the user's role in it: viewers read, editors also record
+	// expenses and payments, and admins also lock, unlock, roll over and
+	// delete blocks and manage the group's members. What every group shares, FX rates,
+	// the audit log and the users, is guarded by the role in the token, and
+	// only instance admins change it.
+	// The /me routes span every group the user is a member of.
+	groups := factory.GetGroups()
+	viewer := groups.Require(repository.RoleViewer)
+	editor := groups.Require(repository.RoleEditor)
+	admin := groups.Require(repository.RoleAdmin)
+	instanceViewer := authenhandler.RequireRole(repository.RoleViewer)
+	instanceEditor := authenhandler.RequireRole(repository.RoleEditor)
+	instanceAdmin := authenhandler.RequireRole(repository.RoleAdmin)
+
+	protected.Get("/groups", getGroups)
+	protected.Post("/groups", instanceEditor, createGroup)
+	protected.Get("/groups/:groupId/members", viewer, getGroupMembers)
+	protected.Put("/groups/:groupId/members/:username", admin, setGroupMember)
+	protected.Delete("/groups/:groupId/members/:username", admin, removeGroupMember)
+	protected.Get("/blocks", viewer, getBlocks)
+	protected.Post("/blocks", editor, createBlock)
+	protected.Post("/blocks/:month/rollover", admin, rolloverBlock)
+	protected.Get("/blocks/:month/opening-balances", viewer, getOpeningBalances)
+	protected.Delete("/blocks/:blockId/", admin, deleteBlock)
+	protected.Post("/blocks/:month/transactions", editor, addTransaction)
+	protected.Get("/blocks/:month/transactions", viewer, getTransactionsByBlock)
+	protected.Get("/blocks/:month/summary", viewer, getSummary)
+	protected.Get("/blocks/:month/settlements", viewer, getSettlements)
+	protected.Post("/blocks/:month/settlements/payments", editor, addSettlementPayment)
+	protected.Get("/blocks/:month/settlements/payments", viewer, getSettlementPayments)
+	protected.Delete("/blocks/:month/settlements/payments/:id", editor, deleteSettlementPayment)
+	protected.Get("/members", viewer, getAllMembers)
+	protected.Get("/people/:id/memberships", viewer, getPersonMemberships)
+	protected.Put("/people/:id/user", admin, linkPerson)
+	protected.Get("/me/balances", getMyBalances)
+	protected.Get("/me/transactions", getMyTransactions)
+	protected.Post("/blocks/:month/lock", admin, lockBlock)
+	protected.Post("/blocks/:month/unlock", admin, unlockBlock)
+	protected.Get("/blocks/:month/members", viewer, getMembersByBlock)
+	protected.Put("/blocks/:month/members/:id", editor, updateMemberRatio)
+	protected.Delete("/transactions/:id", editor, deleteTransaction)
+	protected.Get("/logs", instanceAdmin, getLogs)
+	protected.Get("/fx-rates", instanceViewer, getFXRates)
+	protected.Post("/fx-rates", instanceAdmin, addFXRates)
+	protected.Post("/fx-rates/import", instanceAdmin, importFXRates)
+	protected.Put("/transactions/:id", editor, updateTransaction)
+	protected.Post("/admin/reconcile", instanceAdmin, reconcile)
+	protected.Get("/admin/audit/verify", instanceAdmin, verifyAudit)
+	protected.Get("/admin/users", instanceAdmin, getUsers)
+	protected.Put("/admin/users/:username/role", instanceAdmin, setUserRole)
+
+	// Stop on SIGINT/SIGTERM and flush the queued audit entries on the way out.
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		_ = app.Shutdown()
+	}()
+	err := app.Listen(factory.GetConfig().Addr())
+	factory.GetLogging().Close()
+	if err != nil {
+		log.Fatal(err)
+	}
 }
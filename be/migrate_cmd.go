@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+
+	"my-source/sheet-payment/be/config"
+	"my-source/sheet-payment/be/repository"
+)
+
+const migrateUsage = "usage: migrate up|down|status|redo"
+
+// runMigrate handles `migrate <command>` and exits without starting the server.
+func runMigrate(args []string) {
+	if len(args) != 1 {
+		log.Fatal(migrateUsage)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	db, driver := repository.OpenDB(cfg.DatabaseURL)
+	defer db.Close()
+
+	migrator, err := repository.NewMigrator(db, driver)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	switch args[0] {
+	case "up":
+		n, err := migrator.Up()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("applied %d migration(s)\n", n)
+	case "down":
+		m, err := migrator.Down()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if m == nil {
+			fmt.Println("nothing to roll back")
+			return
+		}
+		fmt.Printf("rolled back %04d_%s\n", m.Version, m.Name)
+	case "redo":
+		m, err := migrator.Redo()
+		if err != nil {
+			log.Fatal(err)
+		}
+		if m == nil {
+			fmt.Println("nothing to redo")
+			return
+		}
+		fmt.Printf("redone %04d_%s\n", m.Version, m.Name)
+	case "status":
+		statuses, err := migrator.Status()
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.AppliedAt != nil {
+				state = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%s\t%s\n", s.Version, s.Name, state)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		os.Exit(2)
+	}
+}
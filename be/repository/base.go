@@ -1,39 +1,112 @@
 package repository
 
+import "time"
+
+// Blocks and people belong to a group. Their repositories take the group
+// of the request and never return or change another group's rows.
+
+type IGroupRepository interface {
+	Create(group Group, owner string) error
+	GetAll() ([]Group, error)
+	GetByUsername(username string) ([]Group, error)
+	GetRole(groupID, username string) (string, error)
+	GetMembers(groupID string) ([]GroupMember, error)
+	SetMember(groupID, username, role string) error
+	RemoveMember(groupID, username string) error
+}
+
 type IBlockRepository interface {
-	GetAllBlocks() ([]Block, error)
-	Get(id string) (string, bool, error)
-	GetIDByMonth(month string) (string, bool, error)
-	Lock(month string) error
-	Unlock(month string) error
+	GetAllBlocks(groupID string) ([]Block, error)
+	Get(groupID, id string) (string, bool, error)
+	GetIDByMonth(groupID, month string) (string, bool, error)
+	GetByMonth(groupID, month string) (Block, error)
+	Lock(groupID, month string) error
+	Unlock(groupID, month string) error
 	Create(block Block) error
-	DeleteBlock(blockID string) error
+	DeleteBlock(groupID, blockID string) error
 }
 
 type IMemberRepository interface {
-	GetAll() ([]Member, error)
+	GetAll(groupID string) ([]Member, error)
 	GetByBlockID(blockID string) ([]Member, error)
+	GetByPersonID(personID string) ([]Membership, error)
 	Create(members []Member) error
-	UpdateDebt(id string, delta float64) error
-	GetDebtsByBlockID(blockID string) (map[string]int, error)
+	UpdateRatio(id string, ratio float64) error
+	GetDebtsByBlockID(blockID string) (map[string]Money, error)
+	ExpectedDebts(blockID string) (map[string]Money, error)
 }
 
 type ITransactionRepository interface {
-	GetByID(id string) (Transaction, error)
-	GetDetails(id string) (map[string]float64, error)
+	GetByID(groupID, id string) (Transaction, error)
+	GetDetails(id string) (map[string]Money, error)
 	GetByBlockID(blockID string) ([]Transaction, error)
+	List(filter TransactionFilter) (TransactionPage, error)
 	Add(tx Transaction) error
-	AddDetails(txID string, details map[string]float64) error
+	AddDetails(txID string, details map[string]Money) error
 	Delete(id string) error
 	UpdateTransaction(payload UpdateTransactionPayload) error
 }
 
+type ILedgerRepository interface {
+	Post(entries []LedgerEntry) error
+	GetByBlockID(blockID string) ([]LedgerEntry, error)
+	Verify() (ChainReport, error)
+}
+
+type IPersonRepository interface {
+	GetAll(groupID string) ([]Person, error)
+	GetByID(groupID, id string) (Person, error)
+	GetOrCreateByName(groupID, name string) (Person, error)
+	Link(groupID, personID, username string) error
+	GetByUsername(username string) ([]Person, error)
+}
+
+type ISettlementRepository interface {
+	Add(s Settlement) error
+	GetByID(id string) (Settlement, error)
+	GetByBlockID(blockID string) ([]Settlement, error)
+	Delete(id string) error
+}
+
+type IOpeningBalanceRepository interface {
+	Create(balances []OpeningBalance) error
+	GetByBlockID(blockID string) ([]OpeningBalance, error)
+	// GetByFromBlockID returns the balances carried out of the block.
+	GetByFromBlockID(blockID string) ([]OpeningBalance, error)
+}
+
+type IFXRateRepository interface {
+	GetAll() ([]FXRate, error)
+	Find(from, to string, on time.Time) (FXRate, error)
+	Upsert(rates []FXRate) error
+}
+
 type IUserRepository interface {
 	GetByUsername(username string) (*User, error)
 	Create(user *User) error
+	GetAll() ([]User, error)
+	SetRole(username, role string) error
+}
+
+type ITokenRepository interface {
+	CreateRefreshToken(t RefreshToken) error
+	GetRefreshToken(hash string) (RefreshToken, error)
+	RotateRefreshToken(oldID string, next RefreshToken) error
+	RevokeFamily(familyID string) error
+	RevokeUserTokens(userID string) error
+	Deny(jti string, expiresAt time.Time) error
+	IsDenied(jti string) (bool, error)
+	PruneExpired(now time.Time) error
+}
+
+type IUnitOfWork interface {
+	Do(fn func(r Repositories) error) error
 }
 
 type ILogging interface {
 	Write(logEntry UserLog) error
-	GetAllLogs() ([]UserLog, error)
+	WriteBatch(entries []UserLog) error
+	List(filter LogFilter) (LogPage, error)
+	Prune(before time.Time, archive bool) (int64, error)
+	Verify() (ChainReport, error)
 }
@@ -1,7 +1,6 @@
 package repository
 
 import (
-	"database/sql"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -9,17 +8,17 @@ import (
 )
 
 type BlockRepository struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func NewBlockRepository(db *sql.DB) *BlockRepository {
+func NewBlockRepository(db DBTX) *BlockRepository {
 	return &BlockRepository{
 		DB: db,
 	}
 }
 
-func (r *BlockRepository) GetIDByMonth(month string) (string, bool, error) {
-	row := r.DB.QueryRow(`SELECT id, locked FROM blocks WHERE month = $1`, month)
+func (r *BlockRepository) GetIDByMonth(groupID, month string) (string, bool, error) {
+	row := r.DB.QueryRow(`SELECT id, locked FROM blocks WHERE group_id = $1 AND month = $2`, groupID, month)
 	var blockID string
 	var locked bool
 	if err := row.Scan(&blockID, &locked); err != nil {
@@ -29,8 +28,20 @@ func (r *BlockRepository) GetIDByMonth(month string) (string, bool, error) {
 	return blockID, locked, nil
 }
 
-func (r *BlockRepository) Get(id string) (string, bool, error) {
-	row := r.DB.QueryRow(`SELECT id, locked FROM blocks WHERE id = $1`, id)
+func (r *BlockRepository) GetByMonth(groupID, month string) (Block, error) {
+	var b Block
+	err := r.DB.QueryRow(`SELECT id, group_id, month, locked, base_currency FROM blocks
+       WHERE group_id = $1 AND month = $2`, groupID, month).
+		Scan(&b.ID, &b.GroupID, &b.Month, &b.Locked, &b.BaseCurrency)
+	if err != nil {
+		return b, fiber.ErrNotFound
+	}
+
+	return b, nil
+}
+
+func (r *BlockRepository) Get(groupID, id string) (string, bool, error) {
+	row := r.DB.QueryRow(`SELECT id, locked FROM blocks WHERE group_id = $1 AND id = $2`, groupID, id)
 	var blockID string
 	var locked bool
 	if err := row.Scan(&blockID, &locked); err != nil {
@@ -40,37 +51,41 @@ func (r *BlockRepository) Get(id string) (string, bool, error) {
 	return blockID, locked, nil
 }
 
-func (r *BlockRepository) Lock(month string) error {
-	_, err := r.DB.Exec(`UPDATE blocks SET locked = true WHERE month = $1`, month)
+func (r *BlockRepository) Lock(groupID, month string) error {
+	_, err := r.DB.Exec(`UPDATE blocks SET locked = true WHERE group_id = $1 AND month = $2`, groupID, month)
 	return err
 }
 
-func (r *BlockRepository) Unlock(month string) error {
-	_, err := r.DB.Exec(`UPDATE blocks SET locked = false WHERE month = $1`, month)
+func (r *BlockRepository) Unlock(groupID, month string) error {
+	_, err := r.DB.Exec(`UPDATE blocks SET locked = false WHERE group_id = $1 AND month = $2`, groupID, month)
 	return err
 }
 
 func (r *BlockRepository) Create(block Block) error {
-	_, err := r.DB.Exec(`INSERT INTO blocks (id, month, locked) VALUES ($1, $2, $3)`, block.ID, block.Month, block.Locked)
+	_, err := r.DB.Exec(`INSERT INTO blocks (id, group_id, month, locked, base_currency) VALUES ($1, $2, $3, $4, $5)`,
+		block.ID, block.GroupID, block.Month, block.Locked, currencyOrDefault(block.BaseCurrency))
 	if err != nil {
 		return err
 	}
-	stmt, err := r.DB.Prepare(`INSERT INTO members (id, block_id, name, ratio, debt) VALUES ($1, $2, $3, $4, $5)`)
+	stmt, err := r.DB.Prepare(`INSERT INTO members (id, block_id, person_id, name, ratio) VALUES ($1, $2, $3, $4, $5)`)
 	if err != nil {
 		return err
 	}
+	defer stmt.Close()
+
 	for _, m := range block.Members {
 		m.ID = uuid.New().String()
 		m.Name = strings.TrimSpace(m.Name)
-		if _, err := stmt.Exec(m.ID, block.ID, m.Name, m.Ratio, m.Debt); err != nil {
+		if _, err := stmt.Exec(m.ID, block.ID, m.PersonID, m.Name, m.Ratio); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (r *BlockRepository) GetAllBlocks() ([]Block, error) {
-	rows, err := r.DB.Query(`SELECT id, month, locked FROM blocks ORDER BY month DESC`)
+func (r *BlockRepository) GetAllBlocks(groupID string) ([]Block, error) {
+	rows, err := r.DB.Query(`SELECT id, group_id, month, locked, base_currency FROM blocks
+       WHERE group_id = $1 ORDER BY month DESC`, groupID)
 	if err != nil {
 		return nil, err
 	}
@@ -79,7 +94,7 @@ func (r *BlockRepository) GetAllBlocks() ([]Block, error) {
 	var blocks []Block
 	for rows.Next() {
 		var b Block
-		if err := rows.Scan(&b.ID, &b.Month, &b.Locked); err != nil {
+		if err := rows.Scan(&b.ID, &b.GroupID, &b.Month, &b.Locked, &b.BaseCurrency); err != nil {
 			return nil, err
 		}
 		blocks = append(blocks, b)
@@ -87,8 +102,8 @@ func (r *BlockRepository) GetAllBlocks() ([]Block, error) {
 	return blocks, nil
 }
 
-func (r *BlockRepository) DeleteBlock(blockID string) error {
-	_, lock, err := r.Get(blockID)
+func (r *BlockRepository) DeleteBlock(groupID, blockID string) error {
+	_, lock, err := r.Get(groupID, blockID)
 	if err != nil {
 		return err
 	}
@@ -97,46 +112,76 @@ func (r *BlockRepository) DeleteBlock(blockID string) error {
 		return fiber.NewError(fiber.StatusConflict, "block locked")
 	}
 
-	tx, err := r.DB.Begin()
-	if err != nil {
-		return err
-	}
-
 	// Xóa chi tiết giao dịch (transaction_details)
-	_, err = tx.Exec(`
+	_, err = r.DB.Exec(`
         DELETE FROM transaction_details 
         WHERE transaction_id IN (
             SELECT id FROM transactions WHERE block_id = $1
         )`, blockID)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
-	// Xoá transactions liên quan
-	_, err = tx.Exec("DELETE FROM transactions WHERE block_id = $1", blockID)
+	// Không xoá block đã được chuyển số dư sang block khác
+	var carried bool
+	err = r.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM opening_balances WHERE from_block_id = $1)`, blockID).Scan(&carried)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
+	if carried {
+		return fiber.NewError(fiber.StatusConflict, "block balances were rolled over into another block")
+	}
 
-	// Xoá members liên quan
-	_, err = tx.Exec("DELETE FROM members WHERE block_id = $1", blockID)
+	// Trả lại số dư đã chuyển sang block này cho block cũ
+	openings, err := NewOpeningBalanceRepository(r.DB).GetByBlockID(blockID)
+	if err != nil {
+		return err
+	}
+	var returned []LedgerEntry
+	for _, ob := range openings {
+		returned = append(returned, LedgerEntries(ob.FromBlockID, LedgerOpening, ob.ID,
+			map[string]Money{ob.FromMemberID: ob.Amount})...)
+	}
+	if err := NewLedgerRepository(r.DB).Post(returned); err != nil {
+		return err
+	}
+	_, err = r.DB.Exec("DELETE FROM opening_balances WHERE block_id = $1", blockID)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
-	// Xoá block
-	_, err = tx.Exec("DELETE FROM blocks WHERE id = $1", blockID)
+	// Xoá các khoản thanh toán nợ (settlements)
+	_, err = r.DB.Exec("DELETE FROM settlements WHERE block_id = $1", blockID)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
-	if err := tx.Commit(); err != nil {
+	// Xoá transactions liên quan
+	_, err = r.DB.Exec("DELETE FROM transactions WHERE block_id = $1", blockID)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	// Sổ cái không được xoá: ghi thêm bút toán đưa số dư của các member về 0
+	members, err := NewMemberRepository(r.DB).GetByBlockID(blockID)
+	if err != nil {
+		return err
+	}
+	closing := map[string]Money{}
+	for _, m := range members {
+		closing[m.ID] = m.Debt.Neg()
+	}
+	if err := NewLedgerRepository(r.DB).Post(LedgerEntries(blockID, LedgerClosing, blockID, closing)); err != nil {
+		return err
+	}
+
+	// Xoá members liên quan
+	_, err = r.DB.Exec("DELETE FROM members WHERE block_id = $1", blockID)
+	if err != nil {
+		return err
+	}
+
+	// Xoá block
+	_, err = r.DB.Exec("DELETE FROM blocks WHERE id = $1", blockID)
+	return err
 }
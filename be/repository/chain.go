@@ -0,0 +1,167 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Names of the hash chains. Every ledger entry and audit log entry stores
+// its position in its chain, the hash of the entry before it and a SHA-256
+// hash over its own content and that previous hash, so editing or deleting
+// an entry breaks the link to the next one. chain_heads keeps the position
+// and hash of the last entry of each chain and, for the audit log, of the
+// last entry pruned.
+const (
+	ChainLedger = "ledger"
+	ChainAudit  = "audit"
+)
+
+// ChainBreak is the first entry of a chain that does not link up.
+type ChainBreak struct {
+	Seq    int64  `json:"seq"`
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+// ChainReport is the result of walking a chain. Head is the hash of the last
+// entry; recording it elsewhere also catches a chain rewritten end to end.
+// Unverified counts the entries written before chaining began, which have no
+// position in the chain and so nothing vouches for.
+type ChainReport struct {
+	Chain      string      `json:"chain"`
+	Entries    int         `json:"entries"`
+	Unverified int         `json:"unverified"`
+	Head       string      `json:"head"`
+	Broken     *ChainBreak `json:"broken,omitempty"`
+}
+
+// ChainVerifier walks the entries of a chain in order and remembers the first
+// one that does not link up.
+type ChainVerifier struct {
+	report ChainReport
+	seq    int64
+	hash   string
+}
+
+// NewChainVerifier starts after the last pruned entry of the chain, given by
+// its position and hash. A chain that was never pruned starts at seq 0 with
+// no hash, so its first entry must be seq 1 and link to nothing.
+func NewChainVerifier(chain string, prunedSeq int64, prunedHash string) *ChainVerifier {
+	return &ChainVerifier{report: ChainReport{Chain: chain}, seq: prunedSeq, hash: prunedHash}
+}
+
+// Check takes the next entry with its stored hashes and the hash recomputed
+// from its content. It returns false once the chain is broken.
+func (v *ChainVerifier) Check(seq int64, id, prevHash, hash, want string) bool {
+	if v.report.Broken != nil {
+		return false
+	}
+	reason := ""
+	switch {
+	case seq != v.seq+1:
+		reason = fmt.Sprintf("entries %d to %d are missing", v.seq+1, seq-1)
+	case prevHash != v.hash && v.seq == 0:
+		reason = "first entry links to an earlier one"
+	case prevHash != v.hash:
+		reason = fmt.Sprintf("previous hash does not match entry %d", v.seq)
+	case hash != want:
+		reason = "content does not match its hash"
+	}
+	if reason != "" {
+		v.report.Broken = &ChainBreak{Seq: seq, ID: id, Reason: reason}
+		return false
+	}
+	v.report.Entries++
+	v.seq, v.hash = seq, hash
+	return true
+}
+
+// Finish compares the last entry checked, or the prune point when there was
+// none, with the chain head and returns the report.
+func (v *ChainVerifier) Finish(headSeq int64, headHash string) ChainReport {
+	switch {
+	case v.report.Broken != nil:
+	case headSeq > v.seq:
+		v.report.Broken = &ChainBreak{Seq: v.seq + 1,
+			Reason: fmt.Sprintf("entries %d to %d are missing", v.seq+1, headSeq)}
+	case headSeq != v.seq || headHash != v.hash:
+		v.report.Broken = &ChainBreak{Seq: v.seq, Reason: "last entry does not match the chain head"}
+	}
+	v.report.Head = headHash
+	return v.report
+}
+
+// chainHash hashes prev and the fields, each prefixed with its length so
+// that moving text from one field to the next changes the hash.
+func chainHash(prev string, fields ...string) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	for _, f := range fields {
+		h.Write([]byte(strconv.Itoa(len(f)) + ":" + f))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// chainTime is the form a time is stored and hashed in: UTC, because a
+// Postgres TIMESTAMP drops the zone, and microseconds, its precision.
+func chainTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
+
+// ComputeHash hashes the entry's content and position with its PrevHash.
+func (e LedgerEntry) ComputeHash() string {
+	return chainHash(e.PrevHash, strconv.FormatInt(e.Seq, 10), e.ID, e.BlockID, e.MemberID,
+		strconv.FormatInt(e.Amount.Amount, 10), e.Amount.Currency, e.Kind, e.RefID,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano))
+}
+
+// ComputeHash hashes the entry's content and position with its PrevHash. The
+// ID is assigned by the database on insert and is not part of it.
+func (l UserLog) ComputeHash() string {
+	return chainHash(l.PrevHash, strconv.FormatInt(l.Seq, 10), l.Username, l.Method, l.Path, l.IPAddress,
+		l.UserAgent, l.Body, strconv.Itoa(l.Status), strconv.FormatInt(l.DurationMs, 10),
+		l.CreatedAt.UTC().Format(time.RFC3339Nano))
+}
+
+// reserveChain claims the next n positions of the chain and returns the first
+// of them with the hash of the entry before it. The update locks the head
+// row until the transaction ends, so appends to a chain run one at a time.
+func reserveChain(q DBTX, chain string, n int) (int64, string, error) {
+	if _, err := q.Exec(`UPDATE chain_heads SET seq = seq + $1 WHERE name = $2`, n, chain); err != nil {
+		return 0, "", err
+	}
+	seq, hash, err := chainHead(q, chain)
+	return seq - int64(n) + 1, hash, err
+}
+
+// advanceChain records hash as the chain's last entry.
+func advanceChain(q DBTX, chain, hash string) error {
+	_, err := q.Exec(`UPDATE chain_heads SET hash = $1 WHERE name = $2`, hash, chain)
+	return err
+}
+
+func chainHead(q DBTX, chain string) (int64, string, error) {
+	var seq int64
+	var hash string
+	err := q.QueryRow(`SELECT seq, hash FROM chain_heads WHERE name = $1`, chain).Scan(&seq, &hash)
+	return seq, hash, err
+}
+
+// chainPruned returns the position and hash of the last entry pruned from
+// the chain, 0 and "" when none was.
+func chainPruned(q DBTX, chain string) (int64, string, error) {
+	var seq int64
+	var hash string
+	err := q.QueryRow(`SELECT pruned_seq, pruned_hash FROM chain_heads WHERE name = $1`, chain).Scan(&seq, &hash)
+	return seq, hash, err
+}
+
+// countUnchained counts the rows of table that predate the hash chain.
+func countUnchained(q DBTX, table string) (int, error) {
+	var n int
+	err := q.QueryRow(`SELECT COUNT(*) FROM ` + table + ` WHERE seq IS NULL`).Scan(&n)
+	return n, err
+}
@@ -3,71 +3,73 @@ package repository
 import (
 	"database/sql"
 	"log"
-	"os"
+	"log/slog"
+	"strings"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
 )
 
-func InitDB() *sql.DB {
-	var err error
-	dsn := os.Getenv("DATABASE_URL")
-	if dsn == "" {
-		dsn = "host=pgdb port=5432 user=postgres password=yourpassword dbname=expenses sslmode=disable"
+// ParseDatabaseURL picks the driver from the scheme of a DATABASE_URL.
+// sqlite:///var/lib/expenses.db, sqlite:expenses.db and file:expenses.db
+// select SQLite; anything else, including key=value DSNs, is Postgres.
+func ParseDatabaseURL(url string) (driver, dsn string) {
+	for _, prefix := range []string{"sqlite://", "sqlite3://", "sqlite:", "sqlite3:"} {
+		if rest, ok := strings.CutPrefix(url, prefix); ok {
+			return DriverSQLite, sqliteDSN(rest)
+		}
+	}
+	if strings.HasPrefix(url, "file:") {
+		return DriverSQLite, sqliteDSN(url)
+	}
+	return DriverPostgres, url
+}
+
+// sqliteDSN turns on foreign keys, waits on locks instead of failing and
+// takes the write lock when a transaction begins, so concurrent requests
+// queue up rather than getting SQLITE_BUSY halfway through.
+func sqliteDSN(path string) string {
+	if !strings.HasPrefix(path, "file:") {
+		path = "file:" + path
 	}
-	db, err := sql.Open("postgres", dsn)
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return path + sep + "_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)&_txlock=immediate"
+}
+
+// OpenDB opens the database at url without touching the schema and returns
+// it with the driver in use.
+func OpenDB(url string) (*sql.DB, string) {
+	driver, dsn := ParseDatabaseURL(url)
+	db, err := sql.Open(driver, dsn)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return db, driver
+}
+
+// InitDB opens the database and applies every pending migration.
+func InitDB(url string) (*sql.DB, string) {
+	db, driver := OpenDB(url)
 
-	queries := []string{
-		`CREATE TABLE IF NOT EXISTS blocks (
-			id TEXT PRIMARY KEY,
-			month TEXT UNIQUE,
-			locked BOOLEAN
-		)`,
-		`CREATE TABLE IF NOT EXISTS members (
-			id TEXT PRIMARY KEY,
-			block_id TEXT,
-			name TEXT,
-			ratio FLOAT,
-			debt FLOAT,
-			FOREIGN KEY (block_id) REFERENCES blocks(id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS transactions (
-			id TEXT PRIMARY KEY,
-			block_id TEXT,
-			payer TEXT,
-			amount FLOAT,
-			description TEXT,
-			created_at TIMESTAMP,
-			ratios JSONB,
-			FOREIGN KEY (block_id) REFERENCES blocks(id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS transaction_details (
-			transaction_id TEXT,
-			member_id TEXT,
-			amount FLOAT,
-			PRIMARY KEY (transaction_id, member_id)
-		)`,
-		`CREATE TABLE IF NOT EXISTS users (
-			id TEXT PRIMARY KEY,
-			username TEXT UNIQUE NOT NULL,
-			password TEXT NOT NULL
-		)`,
-		`CREATE TABLE IF NOT EXISTS user_logs (
-			id SERIAL PRIMARY KEY,
-			username TEXT NOT NULL,
-			method TEXT NOT NULL,
-			path TEXT NOT NULL,
-			ip_address TEXT,
-			user_agent TEXT,
-			body TEXT,
-			created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-		)`,
+	migrator, err := NewMigrator(db, driver)
+	if err != nil {
+		log.Fatal(err)
 	}
-	for _, q := range queries {
-		if _, err := db.Exec(q); err != nil {
-			log.Fatal(err)
-		}
+	n, err := migrator.Up()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if n > 0 {
+		slog.Info("applied migrations", "count", n)
 	}
 
-	return db
+	return db, driver
 }
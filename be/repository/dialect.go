@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"database/sql"
+	"regexp"
+)
+
+// The repositories are written with Postgres $n placeholders. SQLite
+// understands the equivalent ?n, so its handle only has to rewrite them.
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+type sqliteDB struct {
+	db DBTX
+}
+
+func (s sqliteDB) rebind(query string) string {
+	return placeholder.ReplaceAllString(query, "?$1")
+}
+
+func (s sqliteDB) Exec(query string, args ...any) (sql.Result, error) {
+	return s.db.Exec(s.rebind(query), args...)
+}
+
+func (s sqliteDB) Query(query string, args ...any) (*sql.Rows, error) {
+	return s.db.Query(s.rebind(query), args...)
+}
+
+func (s sqliteDB) QueryRow(query string, args ...any) *sql.Row {
+	return s.db.QueryRow(s.rebind(query), args...)
+}
+
+func (s sqliteDB) Prepare(query string) (*sql.Stmt, error) {
+	return s.db.Prepare(s.rebind(query))
+}
+
+// isSQLite reports whether db was bound to SQLite, for the few queries
+// that need Postgres features SQLite lacks.
+func isSQLite(db DBTX) bool {
+	_, ok := db.(sqliteDB)
+	return ok
+}
+
+// Bind adapts db to the SQL dialect of driver.
+func Bind(db DBTX, driver string) DBTX {
+	if driver == DriverSQLite {
+		return sqliteDB{db: db}
+	}
+	return db
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type FXRateRepository struct {
+	DB DBTX
+}
+
+func NewFXRateRepository(db DBTX) *FXRateRepository {
+	return &FXRateRepository{DB: db}
+}
+
+func (r *FXRateRepository) GetAll() ([]FXRate, error) {
+	rows, err := r.DB.Query(`SELECT rate_date, from_currency, to_currency, rate FROM fx_rates
+       ORDER BY rate_date DESC, from_currency, to_currency`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rates []FXRate
+	for rows.Next() {
+		rate, err := scanFXRate(rows)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+	return rates, nil
+}
+
+// Find returns the latest from→to rate dated on or before the given day.
+func (r *FXRateRepository) Find(from, to string, on time.Time) (FXRate, error) {
+	row := r.DB.QueryRow(`SELECT rate_date, from_currency, to_currency, rate FROM fx_rates
+       WHERE from_currency = $1 AND to_currency = $2 AND rate_date <= $3
+       ORDER BY rate_date DESC LIMIT 1`, from, to, on.Format(time.DateOnly))
+	return scanFXRate(row)
+}
+
+func (r *FXRateRepository) Upsert(rates []FXRate) error {
+	stmt, err := r.DB.Prepare(`
+		INSERT INTO fx_rates (rate_date, from_currency, to_currency, rate)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (rate_date, from_currency, to_currency) DO UPDATE SET rate = EXCLUDED.rate
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, rate := range rates {
+		if _, err := stmt.Exec(rate.Date, rate.FromCurrency, rate.ToCurrency, rate.Rate.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func scanFXRate(row interface{ Scan(dest ...any) error }) (FXRate, error) {
+	var rate FXRate
+	var date time.Time
+	var value string
+	if err := row.Scan(&date, &rate.FromCurrency, &rate.ToCurrency, &value); err != nil {
+		return rate, err
+	}
+	rate.Date = date.Format(time.DateOnly)
+	rate.Rate = json.Number(value)
+	return rate, nil
+}
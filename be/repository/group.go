@@ -0,0 +1,121 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+)
+
+type GroupRepository struct {
+	DB DBTX
+}
+
+func NewGroupRepository(db DBTX) *GroupRepository {
+	return &GroupRepository{DB: db}
+}
+
+// Create stores the group with owner as its first admin. It returns
+// sql.ErrNoRows, and stores nothing, when owner is not a user.
+func (r *GroupRepository) Create(group Group, owner string) error {
+	return inTx(r.DB, func(q DBTX) error {
+		createdAt := group.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+		_, err := q.Exec(`INSERT INTO groups (id, name, created_at) VALUES ($1, $2, $3)`,
+			group.ID, group.Name, createdAt)
+		if err != nil {
+			return err
+		}
+		return NewGroupRepository(q).SetMember(group.ID, owner, RoleAdmin)
+	})
+}
+
+func (r *GroupRepository) query(query string, args ...any) ([]Group, error) {
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []Group
+	for rows.Next() {
+		var g Group
+		if err := rows.Scan(&g.ID, &g.Name, &g.CreatedAt, &g.Role); err != nil {
+			return nil, err
+		}
+		groups = append(groups, g)
+	}
+	return groups, rows.Err()
+}
+
+// GetAll returns every group ordered by name, without a role.
+func (r *GroupRepository) GetAll() ([]Group, error) {
+	return r.query(`SELECT id, name, created_at, '' FROM groups ORDER BY name, id`)
+}
+
+// GetByUsername returns the groups the user is a member of, ordered by name,
+// with the user's role in each.
+func (r *GroupRepository) GetByUsername(username string) ([]Group, error) {
+	return r.query(`SELECT g.id, g.name, g.created_at, gm.role FROM groups g
+       JOIN group_members gm ON gm.group_id = g.id
+       JOIN users u ON u.id = gm.user_id
+       WHERE u.username = $1 ORDER BY g.name, g.id`, username)
+}
+
+// GetRole returns the user's role in the group, or sql.ErrNoRows when the
+// user is not a member.
+func (r *GroupRepository) GetRole(groupID, username string) (string, error) {
+	var role string
+	err := r.DB.QueryRow(`SELECT gm.role FROM group_members gm JOIN users u ON u.id = gm.user_id
+       WHERE gm.group_id = $1 AND u.username = $2`, groupID, username).Scan(&role)
+	return role, err
+}
+
+// GetMembers returns the group's members ordered by username.
+func (r *GroupRepository) GetMembers(groupID string) ([]GroupMember, error) {
+	rows, err := r.DB.Query(`SELECT gm.group_id, u.username, gm.role FROM group_members gm
+       JOIN users u ON u.id = gm.user_id
+       WHERE gm.group_id = $1 ORDER BY u.username`, groupID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []GroupMember
+	for rows.Next() {
+		var m GroupMember
+		if err := rows.Scan(&m.GroupID, &m.Username, &m.Role); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// SetMember adds the user to the group with role, or changes the role of a
+// member. It returns sql.ErrNoRows for an unknown user.
+func (r *GroupRepository) SetMember(groupID, username, role string) error {
+	var userID string
+	if err := r.DB.QueryRow(`SELECT id FROM users WHERE username = $1`, username).Scan(&userID); err != nil {
+		return err
+	}
+	_, err := r.DB.Exec(`INSERT INTO group_members (group_id, user_id, role) VALUES ($1, $2, $3)
+       ON CONFLICT (group_id, user_id) DO UPDATE SET role = EXCLUDED.role`, groupID, userID, roleOrDefault(role))
+	return err
+}
+
+// RemoveMember takes the user out of the group. It returns sql.ErrNoRows
+// when the user was not a member.
+func (r *GroupRepository) RemoveMember(groupID, username string) error {
+	res, err := r.DB.Exec(`DELETE FROM group_members
+       WHERE group_id = $1 AND user_id = (SELECT id FROM users WHERE username = $2)`, groupID, username)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
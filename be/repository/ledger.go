@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Kinds of ledger entries, named after the document that posted them.
+// Adjustments are posted by reconciliation to correct a drifted balance, and
+// closing entries zero the balances of a deleted block.
+const (
+	LedgerTransaction = "transaction"
+	LedgerSettlement  = "settlement"
+	LedgerOpening     = "opening"
+	LedgerAdjustment  = "adjustment"
+	LedgerClosing     = "closing"
+)
+
+// LedgerEntry moves one member's balance by Amount. Entries are never
+// updated; a change to a document posts a reversal and new entries, and a
+// member's debt is the sum of their entries. Seq, PrevHash and Hash chain the
+// entry to the one posted before it and are set by Post.
+type LedgerEntry struct {
+	ID        string    `json:"id"`
+	BlockID   string    `json:"block_id"`
+	MemberID  string    `json:"member_id"`
+	Amount    Money     `json:"amount" swaggertype:"integer"`
+	Kind      string    `json:"kind"`
+	RefID     string    `json:"ref_id"`
+	CreatedAt time.Time `json:"created_at"`
+	Seq       int64     `json:"seq"`
+	PrevHash  string    `json:"prev_hash"`
+	Hash      string    `json:"hash"`
+}
+
+// LedgerEntries turns per-member deltas into entries for the document refID,
+// skipping members whose balance does not move.
+func LedgerEntries(blockID, kind, refID string, deltas map[string]Money) []LedgerEntry {
+	now := time.Now()
+	var entries []LedgerEntry
+	for memberID, delta := range deltas {
+		if delta.IsZero() {
+			continue
+		}
+		entries = append(entries, LedgerEntry{
+			ID:        uuid.New().String(),
+			BlockID:   blockID,
+			MemberID:  memberID,
+			Amount:    delta,
+			Kind:      kind,
+			RefID:     refID,
+			CreatedAt: now,
+		})
+	}
+	return entries
+}
+
+type LedgerRepository struct {
+	DB DBTX
+}
+
+func NewLedgerRepository(db DBTX) *LedgerRepository {
+	return &LedgerRepository{DB: db}
+}
+
+// Post appends the entries to the ledger chain.
+func (r *LedgerRepository) Post(entries []LedgerEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return inTx(r.DB, func(q DBTX) error {
+		seq, prev, err := reserveChain(q, ChainLedger, len(entries))
+		if err != nil {
+			return err
+		}
+		stmt, err := q.Prepare(`
+		INSERT INTO ledger_entries (id, block_id, member_id, amount, currency, kind, ref_id, created_at, seq,
+		                            prev_hash, hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+	`)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for _, e := range entries {
+			e.Amount.Currency = currencyOrDefault(e.Amount.Currency)
+			e.CreatedAt = chainTime(e.CreatedAt)
+			e.Seq, e.PrevHash = seq, prev
+			e.Hash = e.ComputeHash()
+			if _, err := stmt.Exec(e.ID, e.BlockID, e.MemberID, e.Amount.Amount, e.Amount.Currency,
+				e.Kind, e.RefID, e.CreatedAt, e.Seq, e.PrevHash, e.Hash); err != nil {
+				return err
+			}
+			seq, prev = seq+1, e.Hash
+		}
+		return advanceChain(q, ChainLedger, prev)
+	})
+}
+
+// GetByBlockID returns the block's entries in the order they were posted.
+func (r *LedgerRepository) GetByBlockID(blockID string) ([]LedgerEntry, error) {
+	var entries []LedgerEntry
+	err := r.each(`WHERE block_id = $1 ORDER BY created_at, id`, func(e LedgerEntry) bool {
+		entries = append(entries, e)
+		return true
+	}, blockID)
+	return entries, err
+}
+
+// Verify walks the ledger chain up to its head. Entries posted before the
+// chain was introduced have no position and are not checked. The ledger is
+// never pruned, so the chain must start at its first entry.
+func (r *LedgerRepository) Verify() (ChainReport, error) {
+	headSeq, headHash, err := chainHead(r.DB, ChainLedger)
+	if err != nil {
+		return ChainReport{}, err
+	}
+	v := NewChainVerifier(ChainLedger, 0, "")
+	err = r.each(`WHERE seq IS NOT NULL AND seq <= $1 ORDER BY seq`, func(e LedgerEntry) bool {
+		return v.Check(e.Seq, e.ID, e.PrevHash, e.Hash, e.ComputeHash())
+	}, headSeq)
+	if err != nil {
+		return ChainReport{}, err
+	}
+	report := v.Finish(headSeq, headHash)
+	report.Unverified, err = countUnchained(r.DB, "ledger_entries")
+	return report, err
+}
+
+// each calls fn with the entries selected by tail until fn returns false.
+func (r *LedgerRepository) each(tail string, fn func(e LedgerEntry) bool, args ...any) error {
+	rows, err := r.DB.Query(`SELECT id, block_id, member_id, amount, currency, kind, ref_id, created_at,
+       COALESCE(seq, 0), COALESCE(prev_hash, ''), COALESCE(hash, '')
+       FROM ledger_entries `+tail, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e LedgerEntry
+		if err := rows.Scan(&e.ID, &e.BlockID, &e.MemberID, &e.Amount.Amount, &e.Amount.Currency, &e.Kind, &e.RefID,
+			&e.CreatedAt, &e.Seq, &e.PrevHash, &e.Hash); err != nil {
+			return err
+		}
+		if !fn(e) {
+			break
+		}
+	}
+	return rows.Err()
+}
@@ -2,42 +2,115 @@ package repository
 
 import (
 	"database/sql"
-	"log"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type LogRepository struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func NewLogRepository(db *sql.DB) *LogRepository {
+func NewLogRepository(db DBTX) *LogRepository {
 	return &LogRepository{DB: db}
 }
 
 func (r *LogRepository) Write(logEntry UserLog) error {
-	_, err := r.DB.Exec(`
-		INSERT INTO user_logs (username, method, path, ip_address, user_agent, body)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, logEntry.Username, logEntry.Method, logEntry.Path, logEntry.IPAddress, logEntry.UserAgent, logEntry.Body)
+	return r.WriteBatch([]UserLog{logEntry})
+}
+
+// WriteBatch appends the entries to the audit chain with a single multi-row
+// INSERT. Times are kept in UTC so that SQLite, which stores them as text,
+// compares them in order.
+func (r *LogRepository) WriteBatch(entries []UserLog) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	err := inTx(r.DB, func(q DBTX) error {
+		seq, prev, err := reserveChain(q, ChainAudit, len(entries))
+		if err != nil {
+			return err
+		}
+		w := &where{}
+		values := make([]string, len(entries))
+		for i, e := range entries {
+			if e.CreatedAt.IsZero() {
+				e.CreatedAt = time.Now()
+			}
+			e.CreatedAt = chainTime(e.CreatedAt)
+			e.Seq, e.PrevHash = seq, prev
+			e.Hash = e.ComputeHash()
+			values[i] = "(" + strings.Join([]string{w.arg(e.Username), w.arg(e.Method), w.arg(e.Path),
+				w.arg(e.IPAddress), w.arg(e.UserAgent), w.arg(e.Body), w.arg(e.Status), w.arg(e.DurationMs),
+				w.arg(e.CreatedAt), w.arg(e.Seq), w.arg(e.PrevHash), w.arg(e.Hash)}, ", ") + ")"
+			seq, prev = seq+1, e.Hash
+		}
+		_, err = q.Exec(`INSERT INTO user_logs
+       (username, method, path, ip_address, user_agent, body, status, duration_ms, created_at, seq, prev_hash, hash)
+       VALUES `+strings.Join(values, ", "), w.args...)
+		if err != nil {
+			return err
+		}
+		return advanceChain(q, ChainAudit, prev)
+	})
 
 	if err != nil {
-		log.Printf("Write user log: %v", err)
+		slog.Error("write user log", "err", err)
 		return err
 	}
 
 	return nil
 }
 
-func (r *LogRepository) GetAllLogs() ([]UserLog, error) {
-	rows, err := r.DB.Query(`SELECT id, username, method, path, ip_address, user_agent, body, 
-       created_at FROM user_logs ORDER BY created_at DESC`)
+// List returns one page of the log matching filter, newest first.
+func (r *LogRepository) List(filter LogFilter) (LogPage, error) {
+	page := LogPage{Logs: []UserLog{}}
+
+	w := &where{}
+	if filter.Username != "" {
+		w.add(`username = ` + w.arg(filter.Username))
+	}
+	if filter.Method != "" {
+		w.add(`method = ` + w.arg(strings.ToUpper(filter.Method)))
+	}
+	if filter.PathPrefix != "" {
+		w.add(`path LIKE ` + w.arg(escapeLike(filter.PathPrefix)+"%") + ` ESCAPE '\'`)
+	}
+	if filter.Status != 0 {
+		w.add(`status = ` + w.arg(filter.Status))
+	}
+	if !filter.From.IsZero() {
+		w.add(`created_at >= ` + w.arg(filter.From.UTC()))
+	}
+	if !filter.To.IsZero() {
+		w.add(`created_at < ` + w.arg(filter.To.UTC()))
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := DecodeCursor(filter.Cursor)
+		if err != nil {
+			return page, err
+		}
+		seq, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return page, ErrInvalidCursor
+		}
+		w.add(`(created_at, id) < (` + w.arg(createdAt.UTC()) + `, ` + w.arg(seq) + `)`)
+	}
+
+	rows, err := r.DB.Query(`SELECT id, username, method, path, ip_address, user_agent, body, status,
+       COALESCE(duration_ms, 0), created_at
+       FROM user_logs `+w.String()+` ORDER BY created_at DESC, id DESC LIMIT `+strconv.Itoa(filter.Limit+1),
+		w.args...)
 	if err != nil {
-		return nil, err
+		return page, err
 	}
 	defer rows.Close()
 
-	var logs []UserLog
 	for rows.Next() {
 		var log UserLog
+		var status *int
 		err := rows.Scan(
 			&log.ID,
 			&log.Username,
@@ -46,13 +119,117 @@ func (r *LogRepository) GetAllLogs() ([]UserLog, error) {
 			&log.IPAddress,
 			&log.UserAgent,
 			&log.Body,
+			&status,
+			&log.DurationMs,
 			&log.CreatedAt,
 		)
 		if err != nil {
-			return nil, err
+			return page, err
+		}
+		if status != nil {
+			log.Status = *status
 		}
-		logs = append(logs, log)
+		page.Logs = append(page.Logs, log)
+	}
+	if err := rows.Err(); err != nil {
+		return page, err
 	}
 
-	return logs, nil
+	// One row past the page tells whether another page follows.
+	if len(page.Logs) > filter.Limit {
+		page.Logs = page.Logs[:filter.Limit]
+		last := page.Logs[len(page.Logs)-1]
+		page.NextCursor = EncodeCursor(last.CreatedAt, last.ID)
+	}
+	return page, nil
+}
+
+// pruneWhere selects the entries written before $1. Entries are stamped when
+// their request starts but chained when it ends, so a chained entry is only
+// removed once no entry that is kept comes before it in the chain.
+const pruneWhere = `WHERE created_at < $1 AND (seq IS NULL OR seq < COALESCE(
+	(SELECT MIN(seq) FROM user_logs WHERE created_at >= $1), seq + 1))`
+
+// Prune removes the entries written before the given time and returns how
+// many there were. With archive they are first copied to user_logs_archive.
+// The last chained entry removed becomes the audit chain's prune point,
+// where Verify starts.
+func (r *LogRepository) Prune(before time.Time, archive bool) (int64, error) {
+	var n int64
+	err := inTx(r.DB, func(q DBTX) error {
+		var seq int64
+		var hash string
+		err := q.QueryRow(`SELECT seq, hash FROM user_logs `+pruneWhere+` AND seq IS NOT NULL
+       ORDER BY seq DESC LIMIT 1`, before.UTC()).Scan(&seq, &hash)
+		switch {
+		case err == nil:
+			_, err = q.Exec(`UPDATE chain_heads SET pruned_seq = $1, pruned_hash = $2 WHERE name = $3`,
+				seq, hash, ChainAudit)
+			if err != nil {
+				return err
+			}
+		case !errors.Is(err, sql.ErrNoRows):
+			return err
+		}
+
+		if archive {
+			_, err := q.Exec(`INSERT INTO user_logs_archive
+       (id, username, method, path, ip_address, user_agent, body, status, duration_ms, created_at, seq, prev_hash,
+        hash)
+       SELECT id, username, method, path, ip_address, user_agent, body, status, duration_ms, created_at, seq,
+        prev_hash, hash
+       FROM user_logs `+pruneWhere, before.UTC())
+			if err != nil {
+				return err
+			}
+		}
+		res, err := q.Exec(`DELETE FROM user_logs `+pruneWhere, before.UTC())
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return n, err
+}
+
+// Verify walks the audit chain from its prune point up to its head. Entries
+// written before the chain was introduced have no position and are not
+// checked.
+func (r *LogRepository) Verify() (ChainReport, error) {
+	headSeq, headHash, err := chainHead(r.DB, ChainAudit)
+	if err != nil {
+		return ChainReport{}, err
+	}
+	prunedSeq, prunedHash, err := chainPruned(r.DB, ChainAudit)
+	if err != nil {
+		return ChainReport{}, err
+	}
+	v := NewChainVerifier(ChainAudit, prunedSeq, prunedHash)
+
+	rows, err := r.DB.Query(`SELECT id, username, method, path, ip_address, user_agent, body, status,
+       duration_ms, created_at, seq, prev_hash, hash
+       FROM user_logs WHERE seq IS NOT NULL AND seq <= $1 ORDER BY seq`, headSeq)
+	if err != nil {
+		return ChainReport{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var l UserLog
+		if err := rows.Scan(&l.ID, &l.Username, &l.Method, &l.Path, &l.IPAddress, &l.UserAgent, &l.Body,
+			&l.Status, &l.DurationMs, &l.CreatedAt, &l.Seq, &l.PrevHash, &l.Hash); err != nil {
+			return ChainReport{}, err
+		}
+		if !v.Check(l.Seq, l.ID, l.PrevHash, l.Hash, l.ComputeHash()) {
+			break
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return ChainReport{}, err
+	}
+	rows.Close()
+	report := v.Finish(headSeq, headHash)
+	report.Unverified, err = countUnchained(r.DB, "user_logs")
+	return report, err
 }
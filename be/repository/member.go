@@ -1,83 +1,127 @@
 package repository
 
-import "database/sql"
-
 type MemberRepository struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func NewMemberRepository(db *sql.DB) *MemberRepository {
+func NewMemberRepository(db DBTX) *MemberRepository {
 	return &MemberRepository{DB: db}
 }
 
-func (r *MemberRepository) GetAll() ([]Member, error) {
-	rows, err := r.DB.Query(`SELECT id, block_id, name, ratio, debt FROM members`)
+// memberSelect reads the debt from the member_balances view, so it is always
+// the sum of the member's ledger entries.
+const memberSelect = `SELECT m.id, m.block_id, m.person_id, p.name, m.ratio, COALESCE(mb.debt, 0), b.base_currency, b.group_id,
+	b.month
+	FROM members m
+	JOIN people p ON p.id = m.person_id
+	JOIN blocks b ON b.id = m.block_id
+	LEFT JOIN member_balances mb ON mb.member_id = m.id`
+
+func (r *MemberRepository) query(where string, args ...any) ([]Membership, error) {
+	rows, err := r.DB.Query(memberSelect+` `+where, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var members []Member
+	var memberships []Membership
 	for rows.Next() {
-		var m Member
-		if err := rows.Scan(&m.ID, &m.BlockID, &m.Name, &m.Ratio, &m.Debt); err != nil {
+		var m Membership
+		if err := rows.Scan(&m.ID, &m.BlockID, &m.PersonID, &m.Name, &m.Ratio, &m.Debt.Amount, &m.Debt.Currency,
+			&m.GroupID, &m.Month); err != nil {
 			return nil, err
 		}
-		members = append(members, m)
+		memberships = append(memberships, m)
 	}
-	return members, nil
+	return memberships, nil
 }
 
-func (r *MemberRepository) GetByBlockID(blockID string) ([]Member, error) {
-	rows, err := r.DB.Query(`SELECT id, block_id, name, ratio, debt FROM members WHERE block_id = $1`, blockID)
+func membersOf(memberships []Membership, err error) ([]Member, error) {
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
 	var members []Member
-	for rows.Next() {
-		var m Member
-		if err := rows.Scan(&m.ID, &m.BlockID, &m.Name, &m.Ratio, &m.Debt); err != nil {
-			return nil, err
-		}
-		members = append(members, m)
+	for _, m := range memberships {
+		members = append(members, m.Member)
 	}
 	return members, nil
 }
 
+func (r *MemberRepository) GetAll(groupID string) ([]Member, error) {
+	return membersOf(r.query(`WHERE b.group_id = $1`, groupID))
+}
+
+func (r *MemberRepository) GetByBlockID(blockID string) ([]Member, error) {
+	return membersOf(r.query(`WHERE m.block_id = $1`, blockID))
+}
+
+// GetByPersonID returns every block membership of the person, newest month
+// first.
+func (r *MemberRepository) GetByPersonID(personID string) ([]Membership, error) {
+	return r.query(`WHERE m.person_id = $1 ORDER BY b.month DESC`, personID)
+}
+
 func (r *MemberRepository) Create(members []Member) error {
-	stmt, err := r.DB.Prepare(`INSERT INTO members (id, block_id, name, ratio, debt) VALUES ($1, $2, $3, $4, $5)`)
+	stmt, err := r.DB.Prepare(`INSERT INTO members (id, block_id, person_id, name, ratio) VALUES ($1, $2, $3, $4, $5)`)
 	if err != nil {
 		return err
 	}
 	defer stmt.Close()
 
 	for _, m := range members {
-		if _, err := stmt.Exec(m.ID, m.BlockID, m.Name, m.Ratio, m.Debt); err != nil {
+		if _, err := stmt.Exec(m.ID, m.BlockID, m.PersonID, m.Name, m.Ratio); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (r *MemberRepository) UpdateDebt(id string, delta float64) error {
-	_, err := r.DB.Exec(`UPDATE members SET debt = debt + $1 WHERE id = $2`, delta, id)
+// ExpectedDebts recomputes each member's debt in the block from the
+// documents themselves (transactions, settlements and carried balances),
+// keyed by member ID. Reconciliation checks the ledger against it.
+func (r *MemberRepository) ExpectedDebts(blockID string) (map[string]Money, error) {
+	rows, err := r.DB.Query(`SELECT m.id, b.base_currency, `+ledgerDebt+`
+       FROM members m
+       JOIN blocks b ON b.id = m.block_id
+       WHERE m.block_id = $1`, blockID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := map[string]Money{}
+	for rows.Next() {
+		var id string
+		var debt Money
+		if err := rows.Scan(&id, &debt.Currency, &debt.Amount); err != nil {
+			return nil, err
+		}
+		result[id] = debt
+	}
+	return result, rows.Err()
+}
+
+func (r *MemberRepository) UpdateRatio(id string, ratio float64) error {
+	_, err := r.DB.Exec(`UPDATE members SET ratio = $1 WHERE id = $2`, ratio, id)
 	return err
 }
 
-func (r *MemberRepository) GetDebtsByBlockID(blockID string) (map[string]int, error) {
-	rows, err := r.DB.Query(`SELECT name, debt FROM members WHERE block_id = $1`, blockID)
+func (r *MemberRepository) GetDebtsByBlockID(blockID string) (map[string]Money, error) {
+	rows, err := r.DB.Query(`SELECT p.name, COALESCE(mb.debt, 0), b.base_currency FROM members m
+       JOIN people p ON p.id = m.person_id
+       JOIN blocks b ON b.id = m.block_id
+       LEFT JOIN member_balances mb ON mb.member_id = m.id
+       WHERE m.block_id = $1`, blockID)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	result := map[string]int{}
+	result := map[string]Money{}
 	for rows.Next() {
 		var name string
-		var debt int
-		if err := rows.Scan(&name, &debt); err != nil {
+		var debt Money
+		if err := rows.Scan(&name, &debt.Amount, &debt.Currency); err != nil {
 			return nil, err
 		}
 		result[name] = debt
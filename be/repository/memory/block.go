@@ -0,0 +1,182 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"my-source/sheet-payment/be/repository"
+)
+
+type BlockRepository struct {
+	Store *Store
+}
+
+func NewBlockRepository(s *Store) *BlockRepository {
+	return &BlockRepository{Store: s}
+}
+
+func (t *tables) blockByMonth(groupID, month string) (repository.Block, bool) {
+	for _, b := range t.blocks {
+		if b.GroupID == groupID && b.Month == month {
+			return b, true
+		}
+	}
+	return repository.Block{}, false
+}
+
+func (r *BlockRepository) GetIDByMonth(groupID, month string) (string, bool, error) {
+	b, err := r.GetByMonth(groupID, month)
+	return b.ID, b.Locked, err
+}
+
+func (r *BlockRepository) GetByMonth(groupID, month string) (repository.Block, error) {
+	var b repository.Block
+	err := r.Store.read(func(t *tables) error {
+		var ok bool
+		if b, ok = t.blockByMonth(groupID, month); !ok {
+			return fiber.ErrNotFound
+		}
+		return nil
+	})
+	return b, err
+}
+
+func (r *BlockRepository) Get(groupID, id string) (string, bool, error) {
+	var b repository.Block
+	err := r.Store.read(func(t *tables) error {
+		var ok bool
+		if b, ok = t.blocks[id]; !ok || b.GroupID != groupID {
+			return fiber.ErrNotFound
+		}
+		return nil
+	})
+	return b.ID, b.Locked, err
+}
+
+func (r *BlockRepository) setLocked(groupID, month string, locked bool) error {
+	return r.Store.write(func(t *tables) error {
+		if b, ok := t.blockByMonth(groupID, month); ok {
+			b.Locked = locked
+			t.blocks[b.ID] = b
+		}
+		return nil
+	})
+}
+
+func (r *BlockRepository) Lock(groupID, month string) error {
+	return r.setLocked(groupID, month, true)
+}
+
+func (r *BlockRepository) Unlock(groupID, month string) error {
+	return r.setLocked(groupID, month, false)
+}
+
+// Create stores the block and its members. Like the SQL repository it
+// assigns the member IDs and trims the names in place.
+func (r *BlockRepository) Create(block repository.Block) error {
+	return r.Store.write(func(t *tables) error {
+		if _, ok := t.blocks[block.ID]; ok {
+			return fiber.NewError(fiber.StatusConflict, "block already exists")
+		}
+		if _, ok := t.groups[block.GroupID]; !ok {
+			return fmt.Errorf("group %s does not exist", block.GroupID)
+		}
+		if _, ok := t.blockByMonth(block.GroupID, block.Month); ok {
+			return fiber.NewError(fiber.StatusConflict, "month already exists")
+		}
+
+		for _, m := range block.Members {
+			m.ID = uuid.New().String()
+			m.Name = strings.TrimSpace(m.Name)
+			if err := t.insertMember(repository.Member{ID: m.ID, BlockID: block.ID, PersonID: m.PersonID,
+				Name: m.Name, Ratio: m.Ratio}); err != nil {
+				return err
+			}
+		}
+		t.blocks[block.ID] = repository.Block{
+			ID:           block.ID,
+			GroupID:      block.GroupID,
+			Month:        block.Month,
+			Locked:       block.Locked,
+			BaseCurrency: currencyOrDefault(block.BaseCurrency),
+		}
+		return nil
+	})
+}
+
+func (r *BlockRepository) GetAllBlocks(groupID string) ([]repository.Block, error) {
+	var blocks []repository.Block
+	err := r.Store.read(func(t *tables) error {
+		for _, b := range t.blocks {
+			if b.GroupID == groupID {
+				blocks = append(blocks, b)
+			}
+		}
+		return nil
+	})
+	sort.Slice(blocks, func(i, j int) bool {
+		return blocks[i].Month > blocks[j].Month
+	})
+	return blocks, err
+}
+
+func (r *BlockRepository) DeleteBlock(groupID, blockID string) error {
+	return r.Store.write(func(t *tables) error {
+		b, ok := t.blocks[blockID]
+		if !ok || b.GroupID != groupID {
+			return fiber.ErrNotFound
+		}
+		if b.Locked {
+			return fiber.NewError(fiber.StatusConflict, "block locked")
+		}
+		for _, ob := range t.openings {
+			if ob.FromBlockID == blockID {
+				return fiber.NewError(fiber.StatusConflict, "block balances were rolled over into another block")
+			}
+		}
+
+		// Give balances carried into this block back to the source members.
+		for id, ob := range t.openings {
+			if ob.BlockID != blockID {
+				continue
+			}
+			t.post(repository.LedgerEntries(ob.FromBlockID, repository.LedgerOpening, ob.ID,
+				map[string]repository.Money{ob.FromMemberID: ob.Amount}))
+			delete(t.openings, id)
+		}
+
+		for id, s := range t.settlements {
+			if s.BlockID == blockID {
+				delete(t.settlements, id)
+			}
+		}
+		for id, tx := range t.transactions {
+			if tx.BlockID == blockID {
+				delete(t.details, id)
+				delete(t.transactions, id)
+			}
+		}
+
+		// The ledger is append-only: zero the members' balances instead.
+		closing := map[string]repository.Money{}
+		for id, m := range t.members {
+			if m.BlockID == blockID {
+				closing[id] = repository.NewMoney(-t.balance(id), b.BaseCurrency)
+				delete(t.members, id)
+			}
+		}
+		t.post(repository.LedgerEntries(blockID, repository.LedgerClosing, blockID, closing))
+		delete(t.blocks, blockID)
+		return nil
+	})
+}
+
+func currencyOrDefault(currency string) string {
+	if currency == "" {
+		return repository.DefaultCurrency
+	}
+	return currency
+}
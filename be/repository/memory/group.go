@@ -0,0 +1,131 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"my-source/sheet-payment/be/repository"
+)
+
+type groupMemberKey struct {
+	group, username string
+}
+
+type GroupRepository struct {
+	Store *Store
+}
+
+func NewGroupRepository(s *Store) *GroupRepository {
+	return &GroupRepository{Store: s}
+}
+
+func (r *GroupRepository) Create(group repository.Group, owner string) error {
+	return r.Store.write(func(t *tables) error {
+		if _, ok := t.groups[group.ID]; ok {
+			return fmt.Errorf("group %s already exists", group.ID)
+		}
+		if _, ok := t.users[owner]; !ok {
+			return sql.ErrNoRows
+		}
+		if group.CreatedAt.IsZero() {
+			group.CreatedAt = time.Now()
+		}
+		group.Role = ""
+		t.groups[group.ID] = group
+		t.groupMembers[groupMemberKey{group.ID, owner}] = repository.RoleAdmin
+		return nil
+	})
+}
+
+func sortGroups(groups []repository.Group) {
+	slices.SortFunc(groups, func(a, b repository.Group) int {
+		if c := strings.Compare(a.Name, b.Name); c != 0 {
+			return c
+		}
+		return strings.Compare(a.ID, b.ID)
+	})
+}
+
+func (r *GroupRepository) GetAll() ([]repository.Group, error) {
+	var groups []repository.Group
+	err := r.Store.read(func(t *tables) error {
+		for _, g := range t.groups {
+			groups = append(groups, g)
+		}
+		return nil
+	})
+	sortGroups(groups)
+	return groups, err
+}
+
+func (r *GroupRepository) GetByUsername(username string) ([]repository.Group, error) {
+	var groups []repository.Group
+	err := r.Store.read(func(t *tables) error {
+		for key, role := range t.groupMembers {
+			if key.username == username {
+				g := t.groups[key.group]
+				g.Role = role
+				groups = append(groups, g)
+			}
+		}
+		return nil
+	})
+	sortGroups(groups)
+	return groups, err
+}
+
+func (r *GroupRepository) GetRole(groupID, username string) (string, error) {
+	var role string
+	err := r.Store.read(func(t *tables) error {
+		var ok bool
+		if role, ok = t.groupMembers[groupMemberKey{groupID, username}]; !ok {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	return role, err
+}
+
+func (r *GroupRepository) GetMembers(groupID string) ([]repository.GroupMember, error) {
+	var members []repository.GroupMember
+	err := r.Store.read(func(t *tables) error {
+		for key, role := range t.groupMembers {
+			if key.group == groupID {
+				members = append(members, repository.GroupMember{GroupID: groupID, Username: key.username, Role: role})
+			}
+		}
+		return nil
+	})
+	slices.SortFunc(members, func(a, b repository.GroupMember) int { return strings.Compare(a.Username, b.Username) })
+	return members, err
+}
+
+func (r *GroupRepository) SetMember(groupID, username, role string) error {
+	return r.Store.write(func(t *tables) error {
+		if _, ok := t.users[username]; !ok {
+			return sql.ErrNoRows
+		}
+		if _, ok := t.groups[groupID]; !ok {
+			return fmt.Errorf("group %s does not exist", groupID)
+		}
+		if role == "" {
+			role = repository.RoleViewer
+		}
+		t.groupMembers[groupMemberKey{groupID, username}] = role
+		return nil
+	})
+}
+
+func (r *GroupRepository) RemoveMember(groupID, username string) error {
+	return r.Store.write(func(t *tables) error {
+		key := groupMemberKey{groupID, username}
+		if _, ok := t.groupMembers[key]; !ok {
+			return sql.ErrNoRows
+		}
+		delete(t.groupMembers, key)
+		return nil
+	})
+}
@@ -0,0 +1,280 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"my-source/sheet-payment/be/repository"
+)
+
+type PersonRepository struct {
+	Store *Store
+}
+
+func NewPersonRepository(s *Store) *PersonRepository {
+	return &PersonRepository{Store: s}
+}
+
+func (r *PersonRepository) GetAll(groupID string) ([]repository.Person, error) {
+	var people []repository.Person
+	err := r.Store.read(func(t *tables) error {
+		for _, p := range t.people {
+			if p.GroupID == groupID {
+				people = append(people, p)
+			}
+		}
+		return nil
+	})
+	sort.Slice(people, func(i, j int) bool {
+		return people[i].Name < people[j].Name
+	})
+	return people, err
+}
+
+func (r *PersonRepository) GetByID(groupID, id string) (repository.Person, error) {
+	var p repository.Person
+	err := r.Store.read(func(t *tables) error {
+		var ok bool
+		if p, ok = t.people[id]; !ok || p.GroupID != groupID {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	return p, err
+}
+
+// GetOrCreateByName returns the group's oldest person with the given name,
+// creating one when nobody in the group has it yet.
+func (r *PersonRepository) GetOrCreateByName(groupID, name string) (repository.Person, error) {
+	p := repository.Person{GroupID: groupID, Name: strings.TrimSpace(name)}
+	err := r.Store.write(func(t *tables) error {
+		if _, ok := t.groups[groupID]; !ok {
+			return fmt.Errorf("group %s does not exist", groupID)
+		}
+		found := false
+		for _, other := range t.people {
+			if other.GroupID == groupID && other.Name == p.Name && (!found || other.CreatedAt.Before(p.CreatedAt)) {
+				p, found = other, true
+			}
+		}
+		if found {
+			return nil
+		}
+
+		p.ID = uuid.New().String()
+		p.CreatedAt = time.Now()
+		p.Username = ""
+		t.people[p.ID] = p
+		return nil
+	})
+	return p, err
+}
+
+// Link makes the person the user's person in its group, taking the link
+// from any other person of the group. An empty username unlinks the person.
+func (r *PersonRepository) Link(groupID, personID, username string) error {
+	return r.Store.write(func(t *tables) error {
+		p, ok := t.people[personID]
+		if !ok || p.GroupID != groupID {
+			return sql.ErrNoRows
+		}
+		if _, ok := t.users[username]; username != "" && !ok {
+			return sql.ErrNoRows
+		}
+		for id, other := range t.people {
+			if username != "" && other.GroupID == groupID && other.Username == username {
+				other.Username = ""
+				t.people[id] = other
+			}
+		}
+		p.Username = username
+		t.people[personID] = p
+		return nil
+	})
+}
+
+// GetByUsername returns the people linked to the user in the groups the
+// user is still a member of, ordered by group.
+func (r *PersonRepository) GetByUsername(username string) ([]repository.Person, error) {
+	var people []repository.Person
+	err := r.Store.read(func(t *tables) error {
+		for _, p := range t.people {
+			if _, member := t.groupMembers[groupMemberKey{p.GroupID, username}]; member && p.Username == username {
+				people = append(people, p)
+			}
+		}
+		return nil
+	})
+	sort.Slice(people, func(i, j int) bool {
+		return people[i].GroupID < people[j].GroupID
+	})
+	return people, err
+}
+
+type SettlementRepository struct {
+	Store *Store
+}
+
+func NewSettlementRepository(s *Store) *SettlementRepository {
+	return &SettlementRepository{Store: s}
+}
+
+func (r *SettlementRepository) Add(s repository.Settlement) error {
+	return r.Store.write(func(t *tables) error {
+		if _, ok := t.settlements[s.ID]; ok {
+			return fmt.Errorf("settlement %s already exists", s.ID)
+		}
+		if _, ok := t.blocks[s.BlockID]; !ok {
+			return fmt.Errorf("block %s does not exist", s.BlockID)
+		}
+		s.Amount.Currency = currencyOrDefault(s.Amount.Currency)
+		t.settlements[s.ID] = s
+		return nil
+	})
+}
+
+func (r *SettlementRepository) GetByID(id string) (repository.Settlement, error) {
+	var s repository.Settlement
+	err := r.Store.read(func(t *tables) error {
+		var ok bool
+		if s, ok = t.settlements[id]; !ok {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	return s, err
+}
+
+func (r *SettlementRepository) GetByBlockID(blockID string) ([]repository.Settlement, error) {
+	var settlements []repository.Settlement
+	err := r.Store.read(func(t *tables) error {
+		for _, s := range t.settlements {
+			if s.BlockID == blockID {
+				settlements = append(settlements, s)
+			}
+		}
+		return nil
+	})
+	sort.Slice(settlements, func(i, j int) bool {
+		return settlements[i].CreatedAt.After(settlements[j].CreatedAt)
+	})
+	return settlements, err
+}
+
+func (r *SettlementRepository) Delete(id string) error {
+	return r.Store.write(func(t *tables) error {
+		delete(t.settlements, id)
+		return nil
+	})
+}
+
+type OpeningBalanceRepository struct {
+	Store *Store
+}
+
+func NewOpeningBalanceRepository(s *Store) *OpeningBalanceRepository {
+	return &OpeningBalanceRepository{Store: s}
+}
+
+func (r *OpeningBalanceRepository) Create(balances []repository.OpeningBalance) error {
+	return r.Store.write(func(t *tables) error {
+		for _, ob := range balances {
+			if _, ok := t.openings[ob.ID]; ok {
+				return fmt.Errorf("opening balance %s already exists", ob.ID)
+			}
+			if _, ok := t.blocks[ob.BlockID]; !ok {
+				return fmt.Errorf("block %s does not exist", ob.BlockID)
+			}
+			if _, ok := t.blocks[ob.FromBlockID]; !ok {
+				return fmt.Errorf("block %s does not exist", ob.FromBlockID)
+			}
+			ob.Amount.Currency = currencyOrDefault(ob.Amount.Currency)
+			t.openings[ob.ID] = ob
+		}
+		return nil
+	})
+}
+
+func (r *OpeningBalanceRepository) GetByBlockID(blockID string) ([]repository.OpeningBalance, error) {
+	return r.filter(func(ob repository.OpeningBalance) bool { return ob.BlockID == blockID })
+}
+
+func (r *OpeningBalanceRepository) GetByFromBlockID(blockID string) ([]repository.OpeningBalance, error) {
+	return r.filter(func(ob repository.OpeningBalance) bool { return ob.FromBlockID == blockID })
+}
+
+func (r *OpeningBalanceRepository) filter(keep func(ob repository.OpeningBalance) bool) ([]repository.OpeningBalance, error) {
+	var balances []repository.OpeningBalance
+	err := r.Store.read(func(t *tables) error {
+		for _, ob := range t.openings {
+			if keep(ob) {
+				balances = append(balances, ob)
+			}
+		}
+		return nil
+	})
+	sort.Slice(balances, func(i, j int) bool {
+		return balances[i].ID < balances[j].ID
+	})
+	return balances, err
+}
+
+type FXRateRepository struct {
+	Store *Store
+}
+
+func NewFXRateRepository(s *Store) *FXRateRepository {
+	return &FXRateRepository{Store: s}
+}
+
+func (r *FXRateRepository) GetAll() ([]repository.FXRate, error) {
+	var rates []repository.FXRate
+	err := r.Store.read(func(t *tables) error {
+		for _, rate := range t.fxRates {
+			rates = append(rates, rate)
+		}
+		return nil
+	})
+	sort.Slice(rates, func(i, j int) bool {
+		x, y := rates[i], rates[j]
+		if x.Date != y.Date {
+			return x.Date > y.Date
+		}
+		if x.FromCurrency != y.FromCurrency {
+			return x.FromCurrency < y.FromCurrency
+		}
+		return x.ToCurrency < y.ToCurrency
+	})
+	return rates, err
+}
+
+// Find returns the latest from→to rate dated on or before the given day.
+func (r *FXRateRepository) Find(from, to string, on time.Time) (repository.FXRate, error) {
+	day := on.Format(time.DateOnly)
+	var best repository.FXRate
+	err := r.Store.read(func(t *tables) error {
+		for k, rate := range t.fxRates {
+			if k.from == from && k.to == to && k.date <= day && k.date > best.Date {
+				best = rate
+			}
+		}
+		if best.Date == "" {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	return best, err
+}
+
+func (r *FXRateRepository) Upsert(rates []repository.FXRate) error {
+	return r.Store.write(func(t *tables) error {
+		for _, rate := range rates {
+			t.fxRates[fxKey{date: rate.Date, from: rate.FromCurrency, to: rate.ToCurrency}] = rate
+		}
+		return nil
+	})
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"fmt"
+
+	"my-source/sheet-payment/be/repository"
+)
+
+type LedgerRepository struct {
+	Store *Store
+}
+
+func NewLedgerRepository(s *Store) *LedgerRepository {
+	return &LedgerRepository{Store: s}
+}
+
+// balance sums the member's ledger entries, as the member_balances view does.
+func (t *tables) balance(memberID string) int64 {
+	var debt int64
+	for _, e := range t.ledger {
+		if e.MemberID == memberID {
+			debt += e.Amount.Amount
+		}
+	}
+	return debt
+}
+
+// chainHead is the position and hash of the last entry of a chain and of
+// the last entry pruned from it.
+type chainHead struct {
+	seq        int64
+	hash       string
+	prunedSeq  int64
+	prunedHash string
+}
+
+// post appends the entries to the ledger chain.
+func (t *tables) post(entries []repository.LedgerEntry) {
+	head := t.heads[repository.ChainLedger]
+	for _, e := range entries {
+		e.Amount.Currency = currencyOrDefault(e.Amount.Currency)
+		head.seq++
+		e.Seq, e.PrevHash = head.seq, head.hash
+		e.Hash = e.ComputeHash()
+		head.hash = e.Hash
+		t.ledger = append(t.ledger, e)
+	}
+	t.heads[repository.ChainLedger] = head
+}
+
+func (r *LedgerRepository) Post(entries []repository.LedgerEntry) error {
+	return r.Store.write(func(t *tables) error {
+		for _, e := range entries {
+			if _, ok := t.blocks[e.BlockID]; !ok {
+				return fmt.Errorf("block %s does not exist", e.BlockID)
+			}
+		}
+		t.post(entries)
+		return nil
+	})
+}
+
+func (r *LedgerRepository) GetByBlockID(blockID string) ([]repository.LedgerEntry, error) {
+	var entries []repository.LedgerEntry
+	err := r.Store.read(func(t *tables) error {
+		for _, e := range t.ledger {
+			if e.BlockID == blockID {
+				entries = append(entries, e)
+			}
+		}
+		return nil
+	})
+	return entries, err
+}
+
+func (r *LedgerRepository) Verify() (repository.ChainReport, error) {
+	var report repository.ChainReport
+	err := r.Store.read(func(t *tables) error {
+		v := repository.NewChainVerifier(repository.ChainLedger, 0, "")
+		for _, e := range t.ledger {
+			if !v.Check(e.Seq, e.ID, e.PrevHash, e.Hash, e.ComputeHash()) {
+				break
+			}
+		}
+		head := t.heads[repository.ChainLedger]
+		report = v.Finish(head.seq, head.hash)
+		return nil
+	})
+	return report, err
+}
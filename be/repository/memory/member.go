@@ -0,0 +1,143 @@
+package memory
+
+import (
+	"fmt"
+	"sort"
+
+	"my-source/sheet-payment/be/repository"
+)
+
+type MemberRepository struct {
+	Store *Store
+}
+
+func NewMemberRepository(s *Store) *MemberRepository {
+	return &MemberRepository{Store: s}
+}
+
+// insertMember enforces the same constraints as the members table: the block
+// and person must exist and a person joins a block at most once.
+func (t *tables) insertMember(m repository.Member) error {
+	if _, ok := t.members[m.ID]; ok {
+		return fmt.Errorf("member %s already exists", m.ID)
+	}
+	if _, ok := t.people[m.PersonID]; !ok {
+		return fmt.Errorf("person %s does not exist", m.PersonID)
+	}
+	for _, other := range t.members {
+		if other.BlockID == m.BlockID && other.PersonID == m.PersonID {
+			return fmt.Errorf("person %s is already a member of block %s", m.PersonID, m.BlockID)
+		}
+	}
+	m.Debt = repository.Money{}
+	t.members[m.ID] = m
+	return nil
+}
+
+// membership joins a member row with its person and block, as the SQL
+// repository does.
+func (t *tables) membership(m repository.Member) repository.Membership {
+	b := t.blocks[m.BlockID]
+	if p, ok := t.people[m.PersonID]; ok {
+		m.Name = p.Name
+	}
+	m.Debt = repository.NewMoney(t.balance(m.ID), b.BaseCurrency)
+	return repository.Membership{Member: m, GroupID: b.GroupID, Month: b.Month}
+}
+
+func (r *MemberRepository) query(match func(m repository.Member) bool) []repository.Membership {
+	var memberships []repository.Membership
+	_ = r.Store.read(func(t *tables) error {
+		for _, m := range t.members {
+			if match(m) {
+				memberships = append(memberships, t.membership(m))
+			}
+		}
+		return nil
+	})
+	sort.Slice(memberships, func(i, j int) bool {
+		return memberships[i].ID < memberships[j].ID
+	})
+	return memberships
+}
+
+func membersOf(memberships []repository.Membership) []repository.Member {
+	var members []repository.Member
+	for _, m := range memberships {
+		members = append(members, m.Member)
+	}
+	return members
+}
+
+func (r *MemberRepository) GetAll(groupID string) ([]repository.Member, error) {
+	var inGroup map[string]bool
+	_ = r.Store.read(func(t *tables) error {
+		inGroup = map[string]bool{}
+		for id, b := range t.blocks {
+			inGroup[id] = b.GroupID == groupID
+		}
+		return nil
+	})
+	return membersOf(r.query(func(m repository.Member) bool { return inGroup[m.BlockID] })), nil
+}
+
+func (r *MemberRepository) GetByBlockID(blockID string) ([]repository.Member, error) {
+	return membersOf(r.query(func(m repository.Member) bool { return m.BlockID == blockID })), nil
+}
+
+// GetByPersonID returns every block membership of the person, newest month
+// first.
+func (r *MemberRepository) GetByPersonID(personID string) ([]repository.Membership, error) {
+	memberships := r.query(func(m repository.Member) bool { return m.PersonID == personID })
+	sort.SliceStable(memberships, func(i, j int) bool {
+		return memberships[i].Month > memberships[j].Month
+	})
+	return memberships, nil
+}
+
+func (r *MemberRepository) Create(members []repository.Member) error {
+	return r.Store.write(func(t *tables) error {
+		for _, m := range members {
+			if err := t.insertMember(m); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *MemberRepository) update(id string, fn func(m *repository.Member)) error {
+	return r.Store.write(func(t *tables) error {
+		if m, ok := t.members[id]; ok {
+			fn(&m)
+			t.members[id] = m
+		}
+		return nil
+	})
+}
+
+func (r *MemberRepository) UpdateRatio(id string, ratio float64) error {
+	return r.update(id, func(m *repository.Member) { m.Ratio = ratio })
+}
+
+func (r *MemberRepository) ExpectedDebts(blockID string) (map[string]repository.Money, error) {
+	result := map[string]repository.Money{}
+	err := r.Store.read(func(t *tables) error {
+		debts := t.documentDebts(blockID)
+		for id, m := range t.members {
+			if m.BlockID == blockID {
+				result[id] = repository.NewMoney(debts[id], t.blocks[blockID].BaseCurrency)
+			}
+		}
+		return nil
+	})
+	return result, err
+}
+
+func (r *MemberRepository) GetDebtsByBlockID(blockID string) (map[string]repository.Money, error) {
+	result := map[string]repository.Money{}
+	for _, m := range r.query(func(m repository.Member) bool { return m.BlockID == blockID }) {
+		result[m.Name] = m.Debt
+	}
+	return result, nil
+}
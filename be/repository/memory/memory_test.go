@@ -0,0 +1,75 @@
+package memory
+
+import (
+	"sync"
+	"testing"
+
+	"my-source/sheet-payment/be/repository"
+	"my-source/sheet-payment/be/repository/repositorytest"
+)
+
+func backend(s *Store) repositorytest.Backend {
+	return repositorytest.Backend{
+		Groups:       NewGroupRepository(s),
+		Blocks:       NewBlockRepository(s),
+		Members:      NewMemberRepository(s),
+		Transactions: NewTransactionRepository(s),
+		People:       NewPersonRepository(s),
+		Settlements:  NewSettlementRepository(s),
+		Openings:     NewOpeningBalanceRepository(s),
+		Ledger:       NewLedgerRepository(s),
+		FXRates:      NewFXRateRepository(s),
+		Users:        NewUserRepository(s),
+		Logs:         NewLogRepository(s),
+		Tokens:       NewTokenRepository(s),
+		UnitOfWork:   NewUnitOfWork(s),
+	}
+}
+
+func TestContract(t *testing.T) {
+	repositorytest.Check(t, backend(NewStore()))
+}
+
+func TestConcurrentLedgerPosts(t *testing.T) {
+	s := NewStore()
+	group, err := repositorytest.NewGroup(backend(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPersonRepository(s).GetOrCreateByName(group, "Alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := repository.Block{ID: "b1", GroupID: group, Month: "2099-01", Members: []*repository.Member{{PersonID: p.ID}}}
+	if err := NewBlockRepository(s).Create(block); err != nil {
+		t.Fatal(err)
+	}
+
+	members := NewMemberRepository(s)
+	ledger := NewLedgerRepository(s)
+	uow := NewUnitOfWork(s)
+	post := func(amount int64) []repository.LedgerEntry {
+		return repository.LedgerEntries(block.ID, repository.LedgerAdjustment, "test",
+			map[string]repository.Money{block.Members[0].ID: repository.NewMoney(amount, "")})
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_ = ledger.Post(post(1))
+		}()
+		go func() {
+			defer wg.Done()
+			_ = uow.Do(func(r repository.Repositories) error {
+				return r.Ledger.Post(post(2))
+			})
+		}()
+	}
+	wg.Wait()
+
+	got, err := members.GetByBlockID(block.ID)
+	if err != nil || len(got) != 1 || got[0].Debt.Amount != 150 {
+		t.Fatalf("debt after concurrent posts = %+v, %v; want 150", got, err)
+	}
+}
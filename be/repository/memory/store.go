@@ -0,0 +1,164 @@
+// Package memory keeps every repository in process memory. It implements all
+// the interfaces of the repository package and is safe for concurrent use;
+// tests use it to run the business layer without a database.
+package memory
+
+import (
+	"maps"
+	"sync"
+	"time"
+
+	"my-source/sheet-payment/be/repository"
+)
+
+// tables holds the rows of every repository. Rows are stored by value and
+// replaced, never mutated in place, so a shallow copy is a consistent
+// snapshot.
+type tables struct {
+	groups       map[string]repository.Group
+	groupMembers map[groupMemberKey]string
+	blocks       map[string]repository.Block
+	people       map[string]repository.Person
+	members      map[string]repository.Member
+	transactions map[string]repository.Transaction
+	details      map[string]map[string]int64
+	settlements  map[string]repository.Settlement
+	openings     map[string]repository.OpeningBalance
+	ledger       []repository.LedgerEntry
+	heads        map[string]chainHead
+	fxRates      map[fxKey]repository.FXRate
+	users        map[string]repository.User
+	tokens       map[string]repository.RefreshToken
+	denied       map[string]time.Time
+	logs         []repository.UserLog
+	archivedLogs []repository.UserLog
+}
+
+type fxKey struct {
+	date, from, to string
+}
+
+func newTables() *tables {
+	return &tables{
+		groups:       map[string]repository.Group{},
+		groupMembers: map[groupMemberKey]string{},
+		blocks:       map[string]repository.Block{},
+		people:       map[string]repository.Person{},
+		members:      map[string]repository.Member{},
+		transactions: map[string]repository.Transaction{},
+		details:      map[string]map[string]int64{},
+		settlements:  map[string]repository.Settlement{},
+		openings:     map[string]repository.OpeningBalance{},
+		heads:        map[string]chainHead{},
+		fxRates:      map[fxKey]repository.FXRate{},
+		users:        map[string]repository.User{},
+		tokens:       map[string]repository.RefreshToken{},
+		denied:       map[string]time.Time{},
+	}
+}
+
+func (t *tables) clone() *tables {
+	return &tables{
+		groups:       maps.Clone(t.groups),
+		groupMembers: maps.Clone(t.groupMembers),
+		blocks:       maps.Clone(t.blocks),
+		people:       maps.Clone(t.people),
+		members:      maps.Clone(t.members),
+		transactions: maps.Clone(t.transactions),
+		details:      maps.Clone(t.details),
+		settlements:  maps.Clone(t.settlements),
+		openings:     maps.Clone(t.openings),
+		ledger:       append([]repository.LedgerEntry(nil), t.ledger...),
+		heads:        maps.Clone(t.heads),
+		fxRates:      maps.Clone(t.fxRates),
+		users:        maps.Clone(t.users),
+		tokens:       maps.Clone(t.tokens),
+		denied:       maps.Clone(t.denied),
+		logs:         append([]repository.UserLog(nil), t.logs...),
+		archivedLogs: append([]repository.UserLog(nil), t.archivedLogs...),
+	}
+}
+
+// Store is the shared state behind the repositories. Inside a unit of work
+// the repositories see a private copy that the store's lock already guards.
+type Store struct {
+	mu     *sync.RWMutex
+	data   *tables
+	inTx   bool
+	nextID *int64
+}
+
+func NewStore() *Store {
+	var id int64
+	return &Store{mu: &sync.RWMutex{}, data: newTables(), nextID: &id}
+}
+
+func (s *Store) read(fn func(t *tables) error) error {
+	if !s.inTx {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	}
+	return fn(s.data)
+}
+
+func (s *Store) write(fn func(t *tables) error) error {
+	if !s.inTx {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+	return fn(s.data)
+}
+
+// Repositories returns a full set of repositories over the store.
+func (s *Store) Repositories() repository.Repositories {
+	return repository.Repositories{
+		Blocks:       NewBlockRepository(s),
+		Members:      NewMemberRepository(s),
+		Transactions: NewTransactionRepository(s),
+		Settlements:  NewSettlementRepository(s),
+		Openings:     NewOpeningBalanceRepository(s),
+		People:       NewPersonRepository(s),
+		Ledger:       NewLedgerRepository(s),
+		FXRates:      NewFXRateRepository(s),
+	}
+}
+
+type UnitOfWork struct {
+	Store *Store
+}
+
+func NewUnitOfWork(s *Store) *UnitOfWork {
+	return &UnitOfWork{Store: s}
+}
+
+// Do runs fn against a copy of the store while holding its write lock. The
+// copy replaces the store's state when fn returns nil and is dropped
+// otherwise, like a rolled back transaction.
+func (u *UnitOfWork) Do(fn func(r repository.Repositories) error) error {
+	s := u.Store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &Store{mu: s.mu, data: s.data.clone(), inTx: true, nextID: s.nextID}
+	if err := fn(tx.Repositories()); err != nil {
+		return err
+	}
+	s.data = tx.data
+	return nil
+}
+
+var (
+	_ repository.IGroupRepository          = (*GroupRepository)(nil)
+	_ repository.IBlockRepository          = (*BlockRepository)(nil)
+	_ repository.IMemberRepository         = (*MemberRepository)(nil)
+	_ repository.ITransactionRepository    = (*TransactionRepository)(nil)
+	_ repository.IPersonRepository         = (*PersonRepository)(nil)
+	_ repository.ISettlementRepository     = (*SettlementRepository)(nil)
+	_ repository.IOpeningBalanceRepository = (*OpeningBalanceRepository)(nil)
+	_ repository.ILedgerRepository         = (*LedgerRepository)(nil)
+	_ repository.IFXRateRepository         = (*FXRateRepository)(nil)
+	_ repository.IUserRepository           = (*UserRepository)(nil)
+	_ repository.IUnitOfWork               = (*UnitOfWork)(nil)
+	_ repository.ILogging                  = (*LogRepository)(nil)
+	_ repository.ITokenRepository          = (*TokenRepository)(nil)
+)
@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"my-source/sheet-payment/be/repository"
+)
+
+type TokenRepository struct {
+	Store *Store
+}
+
+func NewTokenRepository(s *Store) *TokenRepository {
+	return &TokenRepository{Store: s}
+}
+
+func (t *tables) userByID(id string) (repository.User, bool) {
+	for _, u := range t.users {
+		if u.ID == id {
+			return u, true
+		}
+	}
+	return repository.User{}, false
+}
+
+func (r *TokenRepository) CreateRefreshToken(token repository.RefreshToken) error {
+	return r.Store.write(func(t *tables) error {
+		return t.createRefreshToken(token)
+	})
+}
+
+func (t *tables) createRefreshToken(token repository.RefreshToken) error {
+	if _, ok := t.userByID(token.UserID); !ok {
+		return fmt.Errorf("user %s does not exist", token.UserID)
+	}
+	for _, other := range t.tokens {
+		if other.TokenHash == token.TokenHash {
+			return fmt.Errorf("refresh token %s already exists", token.ID)
+		}
+	}
+	token.Username = ""
+	t.tokens[token.ID] = token
+	return nil
+}
+
+func (r *TokenRepository) GetRefreshToken(hash string) (repository.RefreshToken, error) {
+	var found repository.RefreshToken
+	err := r.Store.read(func(t *tables) error {
+		for _, token := range t.tokens {
+			if token.TokenHash == hash {
+				u, _ := t.userByID(token.UserID)
+				found = token
+				found.Username = u.Username
+				return nil
+			}
+		}
+		return sql.ErrNoRows
+	})
+	return found, err
+}
+
+func (r *TokenRepository) RotateRefreshToken(oldID string, next repository.RefreshToken) error {
+	return r.Store.write(func(t *tables) error {
+		old, ok := t.tokens[oldID]
+		if !ok || old.RevokedAt != nil {
+			return repository.ErrTokenReused
+		}
+		if err := t.createRefreshToken(next); err != nil {
+			return err
+		}
+		now := time.Now()
+		old.RevokedAt = &now
+		t.tokens[oldID] = old
+		return nil
+	})
+}
+
+// revoke revokes the tokens that match and are still live.
+func (r *TokenRepository) revoke(match func(token repository.RefreshToken) bool) error {
+	return r.Store.write(func(t *tables) error {
+		now := time.Now()
+		for id, token := range t.tokens {
+			if token.RevokedAt == nil && match(token) {
+				token.RevokedAt = &now
+				t.tokens[id] = token
+			}
+		}
+		return nil
+	})
+}
+
+func (r *TokenRepository) RevokeFamily(familyID string) error {
+	return r.revoke(func(token repository.RefreshToken) bool { return token.FamilyID == familyID })
+}
+
+func (r *TokenRepository) RevokeUserTokens(userID string) error {
+	return r.revoke(func(token repository.RefreshToken) bool { return token.UserID == userID })
+}
+
+func (r *TokenRepository) Deny(jti string, expiresAt time.Time) error {
+	return r.Store.write(func(t *tables) error {
+		if _, ok := t.denied[jti]; !ok {
+			t.denied[jti] = expiresAt
+		}
+		return nil
+	})
+}
+
+func (r *TokenRepository) IsDenied(jti string) (bool, error) {
+	var denied bool
+	err := r.Store.read(func(t *tables) error {
+		_, denied = t.denied[jti]
+		return nil
+	})
+	return denied, err
+}
+
+func (r *TokenRepository) PruneExpired(now time.Time) error {
+	return r.Store.write(func(t *tables) error {
+		for id, token := range t.tokens {
+			if token.ExpiresAt.Before(now) {
+				delete(t.tokens, id)
+			}
+		}
+		for jti, expiresAt := range t.denied {
+			if expiresAt.Before(now) {
+				delete(t.denied, jti)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,287 @@
+package memory
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+
+	"my-source/sheet-payment/be/repository"
+)
+
+type TransactionRepository struct {
+	Store *Store
+}
+
+func NewTransactionRepository(s *Store) *TransactionRepository {
+	return &TransactionRepository{Store: s}
+}
+
+// transaction returns a copy of the stored row with its details, so callers
+// cannot change the store through its maps.
+func (t *tables) transaction(id string) (repository.Transaction, bool) {
+	tx, ok := t.transactions[id]
+	if !ok {
+		return tx, false
+	}
+	tx.Ratios = maps.Clone(tx.Ratios)
+	if tx.Ratios == nil {
+		tx.Ratios = map[string]float64{}
+	}
+	tx.Details = map[string]repository.Money{}
+	for memberID, amount := range t.details[id] {
+		tx.Details[memberID] = repository.NewMoney(amount, tx.Amount.Currency)
+	}
+	return tx, true
+}
+
+func (r *TransactionRepository) GetByBlockID(blockID string) ([]repository.Transaction, error) {
+	return r.all(blockID)
+}
+
+// all returns the block's transactions oldest first, or those of every
+// block for an empty blockID.
+func (r *TransactionRepository) all(blockID string) ([]repository.Transaction, error) {
+	var txs []repository.Transaction
+	err := r.Store.read(func(t *tables) error {
+		for id, tx := range t.transactions {
+			if blockID == "" || tx.BlockID == blockID {
+				tx, _ = t.transaction(id)
+				txs = append(txs, tx)
+			}
+		}
+		return nil
+	})
+	sort.Slice(txs, func(i, j int) bool {
+		if !txs[i].CreatedAt.Equal(txs[j].CreatedAt) {
+			return txs[i].CreatedAt.Before(txs[j].CreatedAt)
+		}
+		return txs[i].ID < txs[j].ID
+	})
+	return txs, err
+}
+
+func (r *TransactionRepository) List(filter repository.TransactionFilter) (repository.TransactionPage, error) {
+	page := repository.TransactionPage{Transactions: []repository.Transaction{}}
+
+	var after func(tx repository.Transaction) bool
+	if filter.Cursor != "" {
+		createdAt, id, err := repository.DecodeCursor(filter.Cursor)
+		if err != nil {
+			return page, err
+		}
+		after = func(tx repository.Transaction) bool {
+			c := tx.CreatedAt.Compare(createdAt)
+			if c == 0 {
+				c = strings.Compare(tx.ID, id)
+			}
+			if filter.Sort == repository.SortOldest {
+				return c > 0
+			}
+			return c < 0
+		}
+	}
+
+	all, err := r.all(filter.BlockID)
+	if err != nil {
+		return page, err
+	}
+	if filter.Sort != repository.SortOldest {
+		slices.Reverse(all)
+	}
+	for _, tx := range all {
+		if !matches(tx, filter) {
+			continue
+		}
+		page.Total++
+		if after != nil && !after(tx) {
+			continue
+		}
+		if len(page.Transactions) == filter.Limit {
+			last := page.Transactions[len(page.Transactions)-1]
+			page.NextCursor = repository.EncodeCursor(last.CreatedAt, last.ID)
+			continue
+		}
+		page.Transactions = append(page.Transactions, tx)
+	}
+	return page, nil
+}
+
+// matches applies the filters of a listing, apart from its cursor.
+func matches(tx repository.Transaction, f repository.TransactionFilter) bool {
+	if f.Members != nil && !slices.ContainsFunc(f.Members, func(id string) bool {
+		_, shares := tx.Details[id]
+		return tx.Payer == id || shares
+	}) {
+		return false
+	}
+	if f.Payer != "" && tx.Payer != f.Payer {
+		return false
+	}
+	if _, ok := tx.Details[f.Participant]; f.Participant != "" && !ok {
+		return false
+	}
+	if f.MinAmount != nil && tx.Amount.Amount < *f.MinAmount {
+		return false
+	}
+	if f.MaxAmount != nil && tx.Amount.Amount > *f.MaxAmount {
+		return false
+	}
+	if !f.From.IsZero() && tx.CreatedAt.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && !tx.CreatedAt.Before(f.To) {
+		return false
+	}
+	description := strings.ToLower(tx.Description)
+	for _, word := range strings.Fields(f.Search) {
+		if !strings.Contains(description, strings.ToLower(word)) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *TransactionRepository) Add(tx repository.Transaction) error {
+	return r.Store.write(func(t *tables) error {
+		if _, ok := t.transactions[tx.ID]; ok {
+			return fmt.Errorf("transaction %s already exists", tx.ID)
+		}
+		if _, ok := t.blocks[tx.BlockID]; !ok {
+			return fmt.Errorf("block %s does not exist", tx.BlockID)
+		}
+		tx.Amount.Currency = currencyOrDefault(tx.Amount.Currency)
+		tx.OriginalAmount.Currency = currencyOrDefault(tx.OriginalAmount.Currency)
+		tx.OriginalCurrency = tx.OriginalAmount.Currency
+		tx.SplitMode = splitModeOrDefault(tx.SplitMode)
+		tx.FXRate = rateOrOne(tx.FXRate)
+		tx.Ratios = maps.Clone(tx.Ratios)
+		tx.Details = nil
+		t.transactions[tx.ID] = tx
+		return nil
+	})
+}
+
+func (r *TransactionRepository) AddDetails(txID string, details map[string]repository.Money) error {
+	return r.Store.write(func(t *tables) error {
+		rows := maps.Clone(t.details[txID])
+		if rows == nil {
+			rows = map[string]int64{}
+		}
+		for memberID, amount := range details {
+			if _, ok := rows[memberID]; ok {
+				return fmt.Errorf("transaction %s already has a share for %s", txID, memberID)
+			}
+			rows[memberID] = amount.Amount
+		}
+		t.details[txID] = rows
+		return nil
+	})
+}
+
+func (r *TransactionRepository) GetByID(groupID, id string) (repository.Transaction, error) {
+	var tx repository.Transaction
+	err := r.Store.read(func(t *tables) error {
+		var ok bool
+		if tx, ok = t.transaction(id); !ok || t.blocks[tx.BlockID].GroupID != groupID {
+			return sql.ErrNoRows
+		}
+		tx.Details = nil
+		return nil
+	})
+	return tx, err
+}
+
+func (r *TransactionRepository) GetDetails(id string) (map[string]repository.Money, error) {
+	details := map[string]repository.Money{}
+	err := r.Store.read(func(t *tables) error {
+		if tx, ok := t.transaction(id); ok {
+			details = tx.Details
+		}
+		return nil
+	})
+	return details, err
+}
+
+func (r *TransactionRepository) Delete(id string) error {
+	return r.Store.write(func(t *tables) error {
+		delete(t.details, id)
+		delete(t.transactions, id)
+		return nil
+	})
+}
+
+func (r *TransactionRepository) UpdateTransaction(payload repository.UpdateTransactionPayload) error {
+	return r.Store.write(func(t *tables) error {
+		tx, ok := t.transactions[payload.ID]
+		if !ok {
+			return fmt.Errorf("failed to get block_id: %w", sql.ErrNoRows)
+		}
+		if b, ok := t.blocks[tx.BlockID]; !ok || b.Locked {
+			return errors.New("failed to get block or block is locking")
+		}
+
+		tx.Description = payload.Description
+		tx.Amount.Amount = payload.Amount.Amount
+		tx.Payer = payload.Payer
+		tx.Ratios = maps.Clone(payload.Ratios)
+		tx.SplitMode = splitModeOrDefault(payload.SplitMode)
+		tx.Split = payload.Split
+		tx.OriginalAmount = repository.NewMoney(payload.OriginalAmount.Amount,
+			currencyOrDefault(payload.OriginalAmount.Currency))
+		tx.OriginalCurrency = tx.OriginalAmount.Currency
+		tx.FXRate = rateOrOne(payload.FXRate)
+		t.transactions[tx.ID] = tx
+
+		rows := map[string]int64{}
+		for memberID, amount := range payload.Details {
+			rows[memberID] = amount.Amount
+		}
+		t.details[tx.ID] = rows
+		return nil
+	})
+}
+
+// documentDebts returns the debts the documents imply, keyed by member ID.
+// Members of other blocks may appear through carried-over balances.
+func (t *tables) documentDebts(blockID string) map[string]int64 {
+	debts := map[string]int64{}
+	for id, tx := range t.transactions {
+		if tx.BlockID != blockID {
+			continue
+		}
+		debts[tx.Payer] += tx.Amount.Amount
+		for memberID, amount := range t.details[id] {
+			debts[memberID] -= amount
+		}
+	}
+	for _, s := range t.settlements {
+		if s.BlockID == blockID {
+			debts[s.Payer] += s.Amount.Amount
+			debts[s.Payee] -= s.Amount.Amount
+		}
+	}
+	for _, ob := range t.openings {
+		debts[ob.MemberID] += ob.Amount.Amount
+		debts[ob.FromMemberID] -= ob.Amount.Amount
+	}
+	return debts
+}
+
+func rateOrOne(rate json.Number) json.Number {
+	if rate == "" {
+		return "1"
+	}
+	return rate
+}
+
+func splitModeOrDefault(mode string) string {
+	if mode == "" {
+		return repository.SplitShares
+	}
+	return mode
+}
@@ -0,0 +1,203 @@
+package memory
+
+import (
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"my-source/sheet-payment/be/repository"
+)
+
+type UserRepository struct {
+	Store *Store
+}
+
+func NewUserRepository(s *Store) *UserRepository {
+	return &UserRepository{Store: s}
+}
+
+func (r *UserRepository) GetByUsername(username string) (*repository.User, error) {
+	var u repository.User
+	err := r.Store.read(func(t *tables) error {
+		var ok bool
+		if u, ok = t.users[username]; !ok {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &u, nil
+}
+
+func (r *UserRepository) Create(user *repository.User) error {
+	return r.Store.write(func(t *tables) error {
+		if _, ok := t.users[user.Username]; ok {
+			return fmt.Errorf("username %s already exists", user.Username)
+		}
+		u := *user
+		if u.Role == "" {
+			u.Role = repository.RoleViewer
+		}
+		t.users[user.Username] = u
+		return nil
+	})
+}
+
+func (r *UserRepository) GetAll() ([]repository.User, error) {
+	var users []repository.User
+	err := r.Store.read(func(t *tables) error {
+		for _, u := range t.users {
+			users = append(users, u)
+		}
+		return nil
+	})
+	slices.SortFunc(users, func(a, b repository.User) int { return strings.Compare(a.Username, b.Username) })
+	return users, err
+}
+
+func (r *UserRepository) SetRole(username, role string) error {
+	return r.Store.write(func(t *tables) error {
+		u, ok := t.users[username]
+		if !ok {
+			return sql.ErrNoRows
+		}
+		u.Role = role
+		t.users[username] = u
+		return nil
+	})
+}
+
+type LogRepository struct {
+	Store *Store
+}
+
+func NewLogRepository(s *Store) *LogRepository {
+	return &LogRepository{Store: s}
+}
+
+func (r *LogRepository) Write(logEntry repository.UserLog) error {
+	return r.WriteBatch([]repository.UserLog{logEntry})
+}
+
+func (r *LogRepository) WriteBatch(entries []repository.UserLog) error {
+	return r.Store.write(func(t *tables) error {
+		head := t.heads[repository.ChainAudit]
+		for _, logEntry := range entries {
+			*r.Store.nextID++
+			logEntry.ID = strconv.FormatInt(*r.Store.nextID, 10)
+			if logEntry.CreatedAt.IsZero() {
+				logEntry.CreatedAt = time.Now()
+			}
+			head.seq++
+			logEntry.Seq, logEntry.PrevHash = head.seq, head.hash
+			logEntry.Hash = logEntry.ComputeHash()
+			head.hash = logEntry.Hash
+			t.logs = append(t.logs, logEntry)
+		}
+		t.heads[repository.ChainAudit] = head
+		return nil
+	})
+}
+
+// List pages through the log newest first. Entries are appended in time
+// order, so the newest is last.
+func (r *LogRepository) List(filter repository.LogFilter) (repository.LogPage, error) {
+	page := repository.LogPage{Logs: []repository.UserLog{}}
+
+	var beforeCursor func(l repository.UserLog) bool
+	if filter.Cursor != "" {
+		createdAt, id, err := repository.DecodeCursor(filter.Cursor)
+		if err != nil {
+			return page, err
+		}
+		seq, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return page, repository.ErrInvalidCursor
+		}
+		beforeCursor = func(l repository.UserLog) bool {
+			if !l.CreatedAt.Equal(createdAt) {
+				return l.CreatedAt.Before(createdAt)
+			}
+			n, _ := strconv.ParseInt(l.ID, 10, 64)
+			return n < seq
+		}
+	}
+
+	err := r.Store.read(func(t *tables) error {
+		for i := len(t.logs) - 1; i >= 0; i-- {
+			l := t.logs[i]
+			if !logMatches(l, filter) || (beforeCursor != nil && !beforeCursor(l)) {
+				continue
+			}
+			if len(page.Logs) == filter.Limit {
+				last := page.Logs[len(page.Logs)-1]
+				page.NextCursor = repository.EncodeCursor(last.CreatedAt, last.ID)
+				break
+			}
+			page.Logs = append(page.Logs, l)
+		}
+		return nil
+	})
+	return page, err
+}
+
+func logMatches(l repository.UserLog, f repository.LogFilter) bool {
+	switch {
+	case f.Username != "" && l.Username != f.Username,
+		f.Method != "" && l.Method != strings.ToUpper(f.Method),
+		!strings.HasPrefix(l.Path, f.PathPrefix),
+		f.Status != 0 && l.Status != f.Status,
+		!f.From.IsZero() && l.CreatedAt.Before(f.From),
+		!f.To.IsZero() && !l.CreatedAt.Before(f.To):
+		return false
+	}
+	return true
+}
+
+func (r *LogRepository) Prune(before time.Time, archive bool) (int64, error) {
+	var n int64
+	err := r.Store.write(func(t *tables) error {
+		// As in the SQL backend, an entry stays while a kept entry comes
+		// before it in the chain.
+		keepFrom := len(t.logs)
+		for i, l := range t.logs {
+			if !l.CreatedAt.Before(before) {
+				keepFrom = i
+				break
+			}
+		}
+		if keepFrom > 0 {
+			head := t.heads[repository.ChainAudit]
+			head.prunedSeq, head.prunedHash = t.logs[keepFrom-1].Seq, t.logs[keepFrom-1].Hash
+			t.heads[repository.ChainAudit] = head
+		}
+		if archive {
+			t.archivedLogs = append(t.archivedLogs, t.logs[:keepFrom]...)
+		}
+		n = int64(keepFrom)
+		t.logs = append([]repository.UserLog(nil), t.logs[keepFrom:]...)
+		return nil
+	})
+	return n, err
+}
+
+func (r *LogRepository) Verify() (repository.ChainReport, error) {
+	var report repository.ChainReport
+	err := r.Store.read(func(t *tables) error {
+		head := t.heads[repository.ChainAudit]
+		v := repository.NewChainVerifier(repository.ChainAudit, head.prunedSeq, head.prunedHash)
+		for _, l := range t.logs {
+			if !v.Check(l.Seq, l.ID, l.PrevHash, l.Hash, l.ComputeHash()) {
+				break
+			}
+		}
+		report = v.Finish(head.seq, head.hash)
+		return nil
+	})
+	return report, err
+}
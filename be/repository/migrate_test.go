@@ -0,0 +1,178 @@
+package repository_test
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"my-source/sheet-payment/be/repository"
+)
+
+// freshPostgres returns TEST_DATABASE_URL pointed at an empty schema of its
+// own, dropped when the test ends. The test is skipped without a database.
+func freshPostgres(t *testing.T) string {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := sql.Open(repository.DriverPostgres, url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	schema := fmt.Sprintf("migrate_test_%d", time.Now().UnixNano())
+	if _, err := db.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db, err := sql.Open(repository.DriverPostgres, url)
+		if err != nil {
+			return
+		}
+		defer db.Close()
+		db.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+	})
+
+	sep := "?"
+	if strings.Contains(url, "?") {
+		sep = "&"
+	}
+	return url + sep + "search_path=" + schema
+}
+
+// upgrade applies the migrations up to and including version to the empty
+// database at url, runs seed to put data in place as an older release
+// would have, then applies the rest.
+func upgrade(t *testing.T, url string, version int64, seed string) *sql.DB {
+	t.Helper()
+	driver, dsn := repository.ParseDatabaseURL(url)
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrator, err := repository.NewMigrator(db, driver)
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := migrator.Migrations
+	for i, m := range all {
+		if m.Version > version {
+			migrator.Migrations = all[:i]
+			break
+		}
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(seed); err != nil {
+		t.Fatal(err)
+	}
+	migrator.Migrations = all
+	if _, err := migrator.Up(); err != nil {
+		t.Fatalf("upgrade: %v", err)
+	}
+	return db
+}
+
+func TestRolesMigrationAppointsAdmin(t *testing.T) {
+	db := upgrade(t, "sqlite://"+t.TempDir()+"/expenses.db", 7, `
+		INSERT INTO users (id, username, password) VALUES ('u1', 'alice', 'x'), ('u2', 'bob', 'x'), ('u3', 'carol', 'x');
+		INSERT INTO user_logs (username, method, path, created_at) VALUES
+			('carol', 'GET', '/blocks', '2024-02-01 00:00:00'),
+			('bob', 'POST', '/login', '2024-01-01 00:00:00');
+	`)
+
+	want := map[string]string{"alice": repository.RoleEditor, "bob": repository.RoleAdmin,
+		"carol": repository.RoleEditor}
+	for username, role := range want {
+		var got string
+		if err := db.QueryRow(`SELECT role FROM users WHERE username = ?`, username).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != role {
+			t.Errorf("role of %s = %s, want %s", username, got, role)
+		}
+	}
+}
+
+func TestPeopleMigrationSeparatesSpacedNames(t *testing.T) {
+	db := upgrade(t, freshPostgres(t), 4, `
+		INSERT INTO blocks (id, month, locked) VALUES ('b1', '2024-05', false), ('b2', '2024-06', false);
+		INSERT INTO members (id, block_id, name, ratio, debt) VALUES
+			('m1', 'b1', 'Bob', 1, 100),
+			('m2', 'b1', 'bob ', 1, -40),
+			('m3', 'b1', 'Bob ', 1, -60),
+			('m4', 'b2', ' Bob', 1, 0);
+	`)
+
+	rows, err := db.Query(`SELECT m.id, m.name, m.person_id, p.name FROM members m JOIN people p ON p.id = m.person_id`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	type membership struct{ name, personID, person string }
+	got := map[string]membership{}
+	for rows.Next() {
+		var id string
+		var m membership
+		if err := rows.Scan(&id, &m.name, &m.personID, &m.person); err != nil {
+			t.Fatal(err)
+		}
+		got[id] = m
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]string{"m1": "Bob", "m2": "bob", "m3": "Bob (2)", "m4": "Bob"}
+	for id, person := range want {
+		if got[id].person != person {
+			t.Errorf("member %s is %q, want %q (members %v)", id, got[id].person, person, got)
+		}
+	}
+	if got["m1"].personID != got["m4"].personID {
+		t.Errorf("Bob of both blocks are different people: %v", got)
+	}
+	if got["m1"].personID == got["m3"].personID {
+		t.Errorf("Bob is a member of b1 twice: %v", got)
+	}
+}
+
+func TestVerifyCountsEntriesBeforeChaining(t *testing.T) {
+	db := upgrade(t, "sqlite://"+t.TempDir()+"/expenses.db", 1, `
+		INSERT INTO blocks (id, month) VALUES ('b1', '2024-05');
+		INSERT INTO people (id, name) VALUES ('p1', 'Alice'), ('p2', 'Bob');
+		INSERT INTO members (id, block_id, person_id, name, ratio) VALUES ('m1', 'b1', 'p1', 'Alice', 1), ('m2', 'b1', 'p2', 'Bob', 1);
+		INSERT INTO transactions (id, block_id, payer, amount) VALUES ('t1', 'b1', 'm1', 100);
+		INSERT INTO transaction_details (transaction_id, member_id, amount) VALUES ('t1', 'm1', 50), ('t1', 'm2', 50);
+		INSERT INTO user_logs (username, method, path) VALUES ('alice', 'POST', '/blocks/2024-05/transactions');
+	`)
+	q := repository.Bind(db, repository.DriverSQLite)
+	ledger, logs := repository.NewLedgerRepository(q), repository.NewLogRepository(q)
+	if err := ledger.Post(repository.LedgerEntries("b1", repository.LedgerAdjustment, "test",
+		map[string]repository.Money{"m1": repository.NewMoney(5, "")})); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, tt := range map[string]struct {
+		verify     func() (repository.ChainReport, error)
+		entries    int
+		unverified int
+	}{
+		"ledger": {ledger.Verify, 1, 3},
+		"audit":  {logs.Verify, 0, 1},
+	} {
+		report, err := tt.verify()
+		if err != nil || report.Broken != nil || report.Entries != tt.entries || report.Unverified != tt.unverified {
+			t.Errorf("%s Verify = %+v, %v; want %d entries verified and %d not", name, report, err, tt.entries,
+				tt.unverified)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS user_logs;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS transaction_details;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS members;
+DROP TABLE IF EXISTS blocks;
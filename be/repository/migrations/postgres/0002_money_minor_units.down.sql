@@ -0,0 +1,8 @@
+ALTER TABLE transaction_details ALTER COLUMN amount TYPE FLOAT;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS currency;
+ALTER TABLE transactions ALTER COLUMN amount TYPE FLOAT;
+
+ALTER TABLE members ALTER COLUMN debt DROP NOT NULL;
+ALTER TABLE members ALTER COLUMN debt DROP DEFAULT;
+ALTER TABLE members ALTER COLUMN debt TYPE FLOAT;
@@ -0,0 +1,11 @@
+-- Amounts used to be FLOAT major units; store them as integer minor units.
+-- The existing data is VND, whose minor unit is the đồng.
+ALTER TABLE members ALTER COLUMN debt TYPE BIGINT USING ROUND(debt)::BIGINT;
+ALTER TABLE members ALTER COLUMN debt SET DEFAULT 0;
+UPDATE members SET debt = 0 WHERE debt IS NULL;
+ALTER TABLE members ALTER COLUMN debt SET NOT NULL;
+
+ALTER TABLE transactions ALTER COLUMN amount TYPE BIGINT USING ROUND(amount)::BIGINT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS currency CHAR(3) NOT NULL DEFAULT 'VND';
+
+ALTER TABLE transaction_details ALTER COLUMN amount TYPE BIGINT USING ROUND(amount)::BIGINT;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS settlements (
+    id TEXT PRIMARY KEY,
+    block_id TEXT NOT NULL,
+    payer TEXT NOT NULL,
+    payee TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'VND',
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP,
+    FOREIGN KEY (block_id) REFERENCES blocks(id)
+);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS opening_balances (
+    id TEXT PRIMARY KEY,
+    block_id TEXT NOT NULL,
+    member_id TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'VND',
+    from_block_id TEXT NOT NULL,
+    from_member_id TEXT NOT NULL,
+    created_at TIMESTAMP,
+    FOREIGN KEY (block_id) REFERENCES blocks(id),
+    FOREIGN KEY (from_block_id) REFERENCES blocks(id)
+);
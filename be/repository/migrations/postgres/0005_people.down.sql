@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS members_block_person;
+ALTER TABLE members DROP COLUMN IF EXISTS person_id;
+DROP TABLE IF EXISTS people;
@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS people (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Members used to be standalone rows per block; they are now the membership
+-- of a person in a block. Create one person per distinct name and link the
+-- existing rows to it.
+ALTER TABLE members ADD COLUMN IF NOT EXISTS person_id TEXT REFERENCES people(id);
+
+-- Names that only differ by surrounding spaces, "Bob" and "Bob " in one
+-- block, would make the same person a member twice. The first keeps the
+-- name and the others are renamed "Bob (2)", "Bob (3)", ... so each becomes
+-- a person of its own and no balance is merged away.
+UPDATE members m SET name = d.name || ' (' || d.n || ')'
+FROM (
+    SELECT id, TRIM(name) AS name,
+           ROW_NUMBER() OVER (PARTITION BY block_id, TRIM(name) ORDER BY name = TRIM(name) DESC, id) AS n
+    FROM members WHERE person_id IS NULL
+) d
+WHERE m.id = d.id AND d.n > 1;
+
+INSERT INTO people (id, name, created_at)
+SELECT gen_random_uuid()::TEXT, n.name, CURRENT_TIMESTAMP
+FROM (SELECT DISTINCT TRIM(name) AS name FROM members WHERE person_id IS NULL) n
+WHERE NOT EXISTS (SELECT 1 FROM people p WHERE p.name = n.name);
+
+UPDATE members m SET person_id = p.id
+FROM people p
+WHERE m.person_id IS NULL AND p.name = TRIM(m.name);
+
+CREATE UNIQUE INDEX IF NOT EXISTS members_block_person ON members (block_id, person_id);
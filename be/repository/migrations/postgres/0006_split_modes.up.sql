@@ -0,0 +1,2 @@
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS split_mode TEXT NOT NULL DEFAULT 'shares';
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS split JSONB;
@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS fx_rates;
+
+ALTER TABLE transactions DROP COLUMN IF EXISTS fx_rate;
+ALTER TABLE transactions DROP COLUMN IF EXISTS original_currency;
+ALTER TABLE transactions DROP COLUMN IF EXISTS original_amount;
+
+ALTER TABLE blocks DROP COLUMN IF EXISTS base_currency;
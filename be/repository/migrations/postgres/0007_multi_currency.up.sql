@@ -0,0 +1,14 @@
+ALTER TABLE blocks ADD COLUMN IF NOT EXISTS base_currency CHAR(3) NOT NULL DEFAULT 'VND';
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS original_amount BIGINT;
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS original_currency CHAR(3);
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS fx_rate NUMERIC NOT NULL DEFAULT 1;
+UPDATE transactions SET original_amount = amount, original_currency = currency WHERE original_amount IS NULL;
+
+CREATE TABLE IF NOT EXISTS fx_rates (
+    rate_date DATE NOT NULL,
+    from_currency CHAR(3) NOT NULL,
+    to_currency CHAR(3) NOT NULL,
+    rate NUMERIC NOT NULL CHECK (rate > 0),
+    PRIMARY KEY (rate_date, from_currency, to_currency)
+);
@@ -0,0 +1,7 @@
+ALTER TABLE members ADD COLUMN debt BIGINT NOT NULL DEFAULT 0;
+
+UPDATE members
+SET debt = COALESCE((SELECT mb.debt FROM member_balances mb WHERE mb.member_id = members.id), 0);
+
+DROP VIEW member_balances;
+DROP TABLE ledger_entries;
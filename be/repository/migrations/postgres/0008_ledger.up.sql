@@ -0,0 +1,56 @@
+-- Balances are derived from an append-only ledger instead of a running debt
+-- column. Every transaction, settlement payment and carried-over balance
+-- posts one entry per member it moves; edits and deletes post reversals.
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id TEXT PRIMARY KEY,
+    block_id TEXT NOT NULL REFERENCES blocks(id),
+    member_id TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'VND',
+    kind TEXT NOT NULL,
+    ref_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS ledger_entries_member ON ledger_entries (member_id);
+CREATE INDEX IF NOT EXISTS ledger_entries_block ON ledger_entries (block_id);
+
+-- Post the existing documents. The old debt column is not carried over:
+-- where it had drifted from the documents, the documents win.
+INSERT INTO ledger_entries (id, block_id, member_id, amount, currency, kind, ref_id, created_at)
+SELECT gen_random_uuid()::TEXT, t.block_id, t.payer, t.amount, t.currency, 'transaction', t.id,
+       COALESCE(t.created_at, CURRENT_TIMESTAMP)
+FROM transactions t;
+
+INSERT INTO ledger_entries (id, block_id, member_id, amount, currency, kind, ref_id, created_at)
+SELECT gen_random_uuid()::TEXT, t.block_id, td.member_id, -td.amount, t.currency, 'transaction', t.id,
+       COALESCE(t.created_at, CURRENT_TIMESTAMP)
+FROM transaction_details td
+JOIN transactions t ON t.id = td.transaction_id;
+
+INSERT INTO ledger_entries (id, block_id, member_id, amount, currency, kind, ref_id, created_at)
+SELECT gen_random_uuid()::TEXT, s.block_id, s.payer, s.amount, s.currency, 'settlement', s.id,
+       COALESCE(s.created_at, CURRENT_TIMESTAMP)
+FROM settlements s;
+
+INSERT INTO ledger_entries (id, block_id, member_id, amount, currency, kind, ref_id, created_at)
+SELECT gen_random_uuid()::TEXT, s.block_id, s.payee, -s.amount, s.currency, 'settlement', s.id,
+       COALESCE(s.created_at, CURRENT_TIMESTAMP)
+FROM settlements s;
+
+INSERT INTO ledger_entries (id, block_id, member_id, amount, currency, kind, ref_id, created_at)
+SELECT gen_random_uuid()::TEXT, ob.block_id, ob.member_id, ob.amount, ob.currency, 'opening', ob.id,
+       COALESCE(ob.created_at, CURRENT_TIMESTAMP)
+FROM opening_balances ob;
+
+INSERT INTO ledger_entries (id, block_id, member_id, amount, currency, kind, ref_id, created_at)
+SELECT gen_random_uuid()::TEXT, ob.from_block_id, ob.from_member_id, -ob.amount, ob.currency, 'opening', ob.id,
+       COALESCE(ob.created_at, CURRENT_TIMESTAMP)
+FROM opening_balances ob;
+
+CREATE VIEW member_balances AS
+SELECT member_id, CAST(SUM(amount) AS BIGINT) AS debt
+FROM ledger_entries
+GROUP BY member_id;
+
+ALTER TABLE members DROP COLUMN debt;
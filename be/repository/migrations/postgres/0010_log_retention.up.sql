@@ -0,0 +1,17 @@
+ALTER TABLE user_logs ADD COLUMN status INTEGER;
+
+-- The log is paged newest first on (created_at, id) and pruned by age.
+CREATE INDEX IF NOT EXISTS user_logs_created ON user_logs (created_at, id);
+
+-- Entries past the retention period are moved here when archiving is on.
+CREATE TABLE IF NOT EXISTS user_logs_archive (
+    id BIGINT PRIMARY KEY,
+    username TEXT NOT NULL,
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    ip_address TEXT,
+    user_agent TEXT,
+    body TEXT,
+    status INTEGER,
+    created_at TIMESTAMP
+);
@@ -0,0 +1,18 @@
+ALTER TABLE user_logs_archive DROP COLUMN hash;
+ALTER TABLE user_logs_archive DROP COLUMN prev_hash;
+ALTER TABLE user_logs_archive DROP COLUMN seq;
+
+DROP INDEX IF EXISTS user_logs_seq;
+ALTER TABLE user_logs DROP COLUMN hash;
+ALTER TABLE user_logs DROP COLUMN prev_hash;
+ALTER TABLE user_logs DROP COLUMN seq;
+
+DELETE FROM ledger_entries WHERE block_id NOT IN (SELECT id FROM blocks);
+ALTER TABLE ledger_entries ADD CONSTRAINT ledger_entries_block_id_fkey FOREIGN KEY (block_id) REFERENCES blocks(id);
+
+DROP INDEX IF EXISTS ledger_entries_seq;
+ALTER TABLE ledger_entries DROP COLUMN hash;
+ALTER TABLE ledger_entries DROP COLUMN prev_hash;
+ALTER TABLE ledger_entries DROP COLUMN seq;
+
+DROP TABLE IF EXISTS chain_heads;
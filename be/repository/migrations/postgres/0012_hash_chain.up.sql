@@ -0,0 +1,29 @@
+-- Ledger and audit entries are chained: each stores its position, the hash
+-- of the entry before it and a SHA-256 hash over its content and that
+-- previous hash. chain_heads holds the last position and hash of each chain
+-- and serialises appends. Entries written before this migration are left
+-- unchained (seq IS NULL).
+CREATE TABLE IF NOT EXISTS chain_heads (
+    name TEXT PRIMARY KEY,
+    seq BIGINT NOT NULL,
+    hash TEXT NOT NULL
+);
+INSERT INTO chain_heads (name, seq, hash) VALUES ('ledger', 0, ''), ('audit', 0, '');
+
+ALTER TABLE ledger_entries ADD COLUMN seq BIGINT;
+ALTER TABLE ledger_entries ADD COLUMN prev_hash TEXT;
+ALTER TABLE ledger_entries ADD COLUMN hash TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS ledger_entries_seq ON ledger_entries (seq);
+
+-- Deleting a block zeroes its balances with new entries instead of deleting
+-- the old ones, so entries may outlive their block.
+ALTER TABLE ledger_entries DROP CONSTRAINT IF EXISTS ledger_entries_block_id_fkey;
+
+ALTER TABLE user_logs ADD COLUMN seq BIGINT;
+ALTER TABLE user_logs ADD COLUMN prev_hash TEXT;
+ALTER TABLE user_logs ADD COLUMN hash TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS user_logs_seq ON user_logs (seq);
+
+ALTER TABLE user_logs_archive ADD COLUMN seq BIGINT;
+ALTER TABLE user_logs_archive ADD COLUMN prev_hash TEXT;
+ALTER TABLE user_logs_archive ADD COLUMN hash TEXT;
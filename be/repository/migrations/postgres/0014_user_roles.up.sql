@@ -0,0 +1,14 @@
+-- Roles are admin, editor and viewer. Users registered from now on start as
+-- viewers and existing users keep editing. The earliest user, the first one
+-- seen in the audit log or else the first by name, becomes the instance's
+-- admin, who can appoint others; `user role <username> admin` does the same
+-- from the command line.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'viewer';
+UPDATE users SET role = 'editor';
+UPDATE users SET role = 'admin' WHERE id = (
+    SELECT u.id FROM users u
+    LEFT JOIN (SELECT username, MIN(created_at) AS first_seen FROM user_logs GROUP BY username) l
+        ON l.username = u.username
+    ORDER BY l.first_seen IS NULL, l.first_seen, u.username
+    LIMIT 1
+);
@@ -0,0 +1,10 @@
+-- Fails while two groups have a block for the same month.
+DROP INDEX IF EXISTS people_group;
+ALTER TABLE people DROP COLUMN IF EXISTS group_id;
+
+DROP INDEX IF EXISTS blocks_group_month;
+ALTER TABLE blocks DROP COLUMN IF EXISTS group_id;
+ALTER TABLE blocks ADD CONSTRAINT blocks_month_key UNIQUE (month);
+
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS groups;
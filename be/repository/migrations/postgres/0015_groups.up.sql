@@ -0,0 +1,36 @@
+-- Groups (workspaces) own blocks and people, and users reach a group's data
+-- through a membership whose role applies inside that group. Existing data
+-- moves into a "Default" group that every existing user joins with the role
+-- they have.
+CREATE TABLE IF NOT EXISTS groups (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id TEXT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'viewer',
+    PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS group_members_user ON group_members (user_id);
+
+INSERT INTO groups (id, name)
+SELECT 'default', 'Default'
+WHERE EXISTS (SELECT 1 FROM users) OR EXISTS (SELECT 1 FROM blocks) OR EXISTS (SELECT 1 FROM people);
+
+INSERT INTO group_members (group_id, user_id, role)
+SELECT 'default', id, role FROM users;
+
+-- A month is unique within its group only.
+ALTER TABLE blocks ADD COLUMN group_id TEXT REFERENCES groups(id);
+UPDATE blocks SET group_id = 'default';
+ALTER TABLE blocks ALTER COLUMN group_id SET NOT NULL;
+ALTER TABLE blocks DROP CONSTRAINT IF EXISTS blocks_month_key;
+CREATE UNIQUE INDEX IF NOT EXISTS blocks_group_month ON blocks (group_id, month);
+
+ALTER TABLE people ADD COLUMN group_id TEXT REFERENCES groups(id);
+UPDATE people SET group_id = 'default';
+ALTER TABLE people ALTER COLUMN group_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS people_group ON people (group_id);
@@ -0,0 +1,4 @@
+ALTER TABLE transactions DROP COLUMN IF EXISTS created_by;
+
+DROP INDEX IF EXISTS people_group_user;
+ALTER TABLE people DROP COLUMN IF EXISTS user_id;
@@ -0,0 +1,7 @@
+-- A user can be linked to one person of each group, which tells the app
+-- which member of a block the user is. Transactions record the user who
+-- entered them; older ones have no author.
+ALTER TABLE people ADD COLUMN IF NOT EXISTS user_id TEXT REFERENCES users(id) ON DELETE SET NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS people_group_user ON people (group_id, user_id);
+
+ALTER TABLE transactions ADD COLUMN IF NOT EXISTS created_by TEXT NOT NULL DEFAULT '';
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS transactions_description_search;
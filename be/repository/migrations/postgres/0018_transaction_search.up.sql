@@ -0,0 +1,4 @@
+-- Full-text search of transaction descriptions. The expression must match
+-- the one TransactionRepository.List filters on for the index to be used.
+CREATE INDEX IF NOT EXISTS transactions_description_search
+    ON transactions USING GIN (to_tsvector('simple', COALESCE(description, '')));
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS user_logs;
+DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS fx_rates;
+DROP TABLE IF EXISTS opening_balances;
+DROP TABLE IF EXISTS settlements;
+DROP TABLE IF EXISTS transaction_details;
+DROP TABLE IF EXISTS transactions;
+DROP TABLE IF EXISTS members;
+DROP TABLE IF EXISTS people;
+DROP TABLE IF EXISTS blocks;
@@ -0,0 +1,95 @@
+-- SQLite starts from the current schema. Amounts are integer minor units;
+-- exchange rates are kept as TEXT so they round-trip exactly.
+CREATE TABLE IF NOT EXISTS blocks (
+    id TEXT PRIMARY KEY,
+    month TEXT UNIQUE,
+    locked BOOLEAN NOT NULL DEFAULT FALSE,
+    base_currency CHAR(3) NOT NULL DEFAULT 'VND'
+);
+
+CREATE TABLE IF NOT EXISTS people (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS members (
+    id TEXT PRIMARY KEY,
+    block_id TEXT REFERENCES blocks(id),
+    person_id TEXT REFERENCES people(id),
+    name TEXT,
+    ratio FLOAT,
+    debt BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS members_block_person ON members (block_id, person_id);
+
+CREATE TABLE IF NOT EXISTS transactions (
+    id TEXT PRIMARY KEY,
+    block_id TEXT REFERENCES blocks(id),
+    payer TEXT,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'VND',
+    description TEXT,
+    created_at TIMESTAMP,
+    ratios TEXT,
+    split_mode TEXT NOT NULL DEFAULT 'shares',
+    split TEXT,
+    original_amount BIGINT,
+    original_currency CHAR(3),
+    fx_rate TEXT NOT NULL DEFAULT '1'
+);
+
+CREATE TABLE IF NOT EXISTS transaction_details (
+    transaction_id TEXT,
+    member_id TEXT,
+    amount BIGINT NOT NULL,
+    PRIMARY KEY (transaction_id, member_id)
+);
+
+CREATE TABLE IF NOT EXISTS settlements (
+    id TEXT PRIMARY KEY,
+    block_id TEXT NOT NULL REFERENCES blocks(id),
+    payer TEXT NOT NULL,
+    payee TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'VND',
+    note TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS opening_balances (
+    id TEXT PRIMARY KEY,
+    block_id TEXT NOT NULL REFERENCES blocks(id),
+    member_id TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'VND',
+    from_block_id TEXT NOT NULL REFERENCES blocks(id),
+    from_member_id TEXT NOT NULL,
+    created_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS fx_rates (
+    rate_date DATE NOT NULL,
+    from_currency CHAR(3) NOT NULL,
+    to_currency CHAR(3) NOT NULL,
+    rate TEXT NOT NULL CHECK (CAST(rate AS REAL) > 0),
+    PRIMARY KEY (rate_date, from_currency, to_currency)
+);
+
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    username TEXT UNIQUE NOT NULL,
+    password TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_logs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT NOT NULL,
+    method TEXT NOT NULL,
+    path TEXT NOT NULL,
+    ip_address TEXT,
+    user_agent TEXT,
+    body TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS transaction_details_transaction;
+DROP INDEX IF EXISTS transactions_block_created;
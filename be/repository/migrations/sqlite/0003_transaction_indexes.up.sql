@@ -0,0 +1,4 @@
+-- Listing a block reads its transactions in date order and then the details
+-- of all of them.
+CREATE INDEX IF NOT EXISTS transactions_block_created ON transactions (block_id, created_at);
+CREATE INDEX IF NOT EXISTS transaction_details_transaction ON transaction_details (transaction_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS user_logs_archive;
+DROP INDEX IF EXISTS user_logs_created;
+ALTER TABLE user_logs DROP COLUMN status;
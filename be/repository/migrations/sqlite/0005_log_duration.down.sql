@@ -0,0 +1,2 @@
+ALTER TABLE user_logs_archive DROP COLUMN duration_ms;
+ALTER TABLE user_logs DROP COLUMN duration_ms;
@@ -0,0 +1,2 @@
+ALTER TABLE user_logs ADD COLUMN duration_ms BIGINT;
+ALTER TABLE user_logs_archive ADD COLUMN duration_ms BIGINT;
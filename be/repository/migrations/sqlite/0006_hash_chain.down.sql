@@ -0,0 +1,33 @@
+ALTER TABLE user_logs_archive DROP COLUMN hash;
+ALTER TABLE user_logs_archive DROP COLUMN prev_hash;
+ALTER TABLE user_logs_archive DROP COLUMN seq;
+
+DROP INDEX IF EXISTS user_logs_seq;
+ALTER TABLE user_logs DROP COLUMN hash;
+ALTER TABLE user_logs DROP COLUMN prev_hash;
+ALTER TABLE user_logs DROP COLUMN seq;
+
+DROP VIEW member_balances;
+CREATE TABLE ledger_entries_old (
+    id TEXT PRIMARY KEY,
+    block_id TEXT NOT NULL REFERENCES blocks(id),
+    member_id TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'VND',
+    kind TEXT NOT NULL,
+    ref_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO ledger_entries_old (id, block_id, member_id, amount, currency, kind, ref_id, created_at)
+SELECT id, block_id, member_id, amount, currency, kind, ref_id, created_at FROM ledger_entries WHERE block_id IN (SELECT id FROM blocks);
+DROP TABLE ledger_entries;
+ALTER TABLE ledger_entries_old RENAME TO ledger_entries;
+CREATE INDEX IF NOT EXISTS ledger_entries_member ON ledger_entries (member_id);
+CREATE INDEX IF NOT EXISTS ledger_entries_block ON ledger_entries (block_id);
+
+CREATE VIEW member_balances AS
+SELECT member_id, CAST(SUM(amount) AS BIGINT) AS debt
+FROM ledger_entries
+GROUP BY member_id;
+
+DROP TABLE IF EXISTS chain_heads;
@@ -0,0 +1,50 @@
+-- Ledger and audit entries are chained: each stores its position, the hash
+-- of the entry before it and a SHA-256 hash over its content and that
+-- previous hash. chain_heads holds the last position and hash of each chain
+-- and serialises appends. Entries written before this migration are left
+-- unchained (seq IS NULL).
+CREATE TABLE IF NOT EXISTS chain_heads (
+    name TEXT PRIMARY KEY,
+    seq BIGINT NOT NULL,
+    hash TEXT NOT NULL
+);
+INSERT INTO chain_heads (name, seq, hash) VALUES ('ledger', 0, ''), ('audit', 0, '');
+
+-- Deleting a block zeroes its balances with new entries instead of deleting
+-- the old ones, so entries may outlive their block. SQLite cannot drop the
+-- foreign key in place, so the table is rebuilt.
+DROP VIEW member_balances;
+CREATE TABLE ledger_entries_new (
+    id TEXT PRIMARY KEY,
+    block_id TEXT NOT NULL,
+    member_id TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'VND',
+    kind TEXT NOT NULL,
+    ref_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    seq BIGINT,
+    prev_hash TEXT,
+    hash TEXT
+);
+INSERT INTO ledger_entries_new (id, block_id, member_id, amount, currency, kind, ref_id, created_at)
+SELECT id, block_id, member_id, amount, currency, kind, ref_id, created_at FROM ledger_entries;
+DROP TABLE ledger_entries;
+ALTER TABLE ledger_entries_new RENAME TO ledger_entries;
+CREATE INDEX IF NOT EXISTS ledger_entries_member ON ledger_entries (member_id);
+CREATE INDEX IF NOT EXISTS ledger_entries_block ON ledger_entries (block_id);
+CREATE UNIQUE INDEX IF NOT EXISTS ledger_entries_seq ON ledger_entries (seq);
+
+CREATE VIEW member_balances AS
+SELECT member_id, CAST(SUM(amount) AS BIGINT) AS debt
+FROM ledger_entries
+GROUP BY member_id;
+
+ALTER TABLE user_logs ADD COLUMN seq BIGINT;
+ALTER TABLE user_logs ADD COLUMN prev_hash TEXT;
+ALTER TABLE user_logs ADD COLUMN hash TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS user_logs_seq ON user_logs (seq);
+
+ALTER TABLE user_logs_archive ADD COLUMN seq BIGINT;
+ALTER TABLE user_logs_archive ADD COLUMN prev_hash TEXT;
+ALTER TABLE user_logs_archive ADD COLUMN hash TEXT;
@@ -0,0 +1,22 @@
+-- Fails while two groups have a block for the same month.
+CREATE TABLE people_old (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO people_old (id, name, created_at) SELECT id, name, created_at FROM people;
+DROP TABLE people;
+ALTER TABLE people_old RENAME TO people;
+
+CREATE TABLE blocks_old (
+    id TEXT PRIMARY KEY,
+    month TEXT UNIQUE,
+    locked BOOLEAN NOT NULL DEFAULT FALSE,
+    base_currency CHAR(3) NOT NULL DEFAULT 'VND'
+);
+INSERT INTO blocks_old (id, month, locked, base_currency) SELECT id, month, locked, base_currency FROM blocks;
+DROP TABLE blocks;
+ALTER TABLE blocks_old RENAME TO blocks;
+
+DROP TABLE IF EXISTS group_members;
+DROP TABLE IF EXISTS groups;
@@ -0,0 +1,52 @@
+-- Groups (workspaces) own blocks and people, and users reach a group's data
+-- through a membership whose role applies inside that group. Existing data
+-- moves into a "Default" group that every existing user joins with the role
+-- they have.
+CREATE TABLE IF NOT EXISTS groups (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS group_members (
+    group_id TEXT NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    role TEXT NOT NULL DEFAULT 'viewer',
+    PRIMARY KEY (group_id, user_id)
+);
+CREATE INDEX IF NOT EXISTS group_members_user ON group_members (user_id);
+
+INSERT INTO groups (id, name)
+SELECT 'default', 'Default'
+WHERE EXISTS (SELECT 1 FROM users) OR EXISTS (SELECT 1 FROM blocks) OR EXISTS (SELECT 1 FROM people);
+
+INSERT INTO group_members (group_id, user_id, role)
+SELECT 'default', id, role FROM users;
+
+-- A month is unique within its group only. SQLite cannot drop the UNIQUE
+-- constraint on month, so blocks is rebuilt; the migrator turns foreign keys
+-- off meanwhile and checks them before committing.
+CREATE TABLE blocks_new (
+    id TEXT PRIMARY KEY,
+    group_id TEXT NOT NULL REFERENCES groups(id),
+    month TEXT,
+    locked BOOLEAN NOT NULL DEFAULT FALSE,
+    base_currency CHAR(3) NOT NULL DEFAULT 'VND'
+);
+INSERT INTO blocks_new (id, group_id, month, locked, base_currency)
+SELECT id, 'default', month, locked, base_currency FROM blocks;
+DROP TABLE blocks;
+ALTER TABLE blocks_new RENAME TO blocks;
+CREATE UNIQUE INDEX IF NOT EXISTS blocks_group_month ON blocks (group_id, month);
+
+CREATE TABLE people_new (
+    id TEXT PRIMARY KEY,
+    group_id TEXT NOT NULL REFERENCES groups(id),
+    name TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+INSERT INTO people_new (id, group_id, name, created_at)
+SELECT id, 'default', name, created_at FROM people;
+DROP TABLE people;
+ALTER TABLE people_new RENAME TO people;
+CREATE INDEX IF NOT EXISTS people_group ON people (group_id);
@@ -0,0 +1,2 @@
+ALTER TABLE chain_heads DROP COLUMN pruned_hash;
+ALTER TABLE chain_heads DROP COLUMN pruned_seq;
@@ -0,0 +1,11 @@
+-- Pruning the audit log records the position and hash of the last entry it
+-- removed, so verification can tell pruning from deleted entries. Logs
+-- pruned before this migration start the chain at the oldest entry left.
+ALTER TABLE chain_heads ADD COLUMN pruned_seq BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE chain_heads ADD COLUMN pruned_hash TEXT NOT NULL DEFAULT '';
+
+UPDATE chain_heads SET
+    pruned_seq = COALESCE((SELECT MIN(seq) - 1 FROM user_logs WHERE seq IS NOT NULL), seq),
+    pruned_hash = COALESCE((SELECT prev_hash FROM user_logs
+        WHERE seq = (SELECT MIN(seq) FROM user_logs WHERE seq IS NOT NULL)), hash)
+WHERE name = 'audit';
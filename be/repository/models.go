@@ -1,45 +1,208 @@
 package repository
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
+// Group is a workspace, such as a flat or a trip, that owns its blocks and
+// people. Role is the user's role in the group when listed for a user.
+type Group struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	Role      string    `json:"role,omitempty"`
+}
+
+// GroupMember is a user's membership of a group. Inside the group Role takes
+// the place of the user's own role.
+type GroupMember struct {
+	GroupID  string `json:"group_id"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+// Person is someone who takes part in the blocks of a group; the ID stays
+// the same across months.
+type Person struct {
+	ID        string    `json:"id"`
+	GroupID   string    `json:"group_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	// Username is the user linked to the person, if any. A user is at most
+	// one person of each group.
+	Username string `json:"username,omitempty"`
+}
+
+// Member is a person's membership of one block, with the per-block ratio.
+// Debt is derived from the member's ledger entries. Name is the person's name.
 type Member struct {
-	ID      string  `json:"id"`
-	BlockID string  `json:"block_id"`
-	Name    string  `json:"name"`
-	Ratio   float64 `json:"ratio"`
-	Debt    float64 `json:"debt"`
+	ID       string  `json:"id"`
+	BlockID  string  `json:"block_id"`
+	PersonID string  `json:"person_id"`
+	Name     string  `json:"name"`
+	Ratio    float64 `json:"ratio"`
+	Debt     Money   `json:"debt" swaggertype:"integer"`
+}
+
+// Membership is a member row together with the month and group of its
+// block, used for a person's history across blocks.
+type Membership struct {
+	Member
+	GroupID string `json:"group_id"`
+	Month   string `json:"month"`
+}
+
+// Split modes of a transaction. Ratios holds the weights for equal, shares
+// and percent; exact and itemized keep their input in Split.
+const (
+	SplitEqual    = "equal"
+	SplitShares   = "shares"
+	SplitPercent  = "percent"
+	SplitExact    = "exact"
+	SplitItemized = "itemized"
+)
+
+// SplitItem is a line of an itemized bill, shared equally by Members.
+type SplitItem struct {
+	Description string   `json:"description"`
+	Amount      Money    `json:"amount" swaggertype:"integer"`
+	Members     []string `json:"members"`
+}
+
+// Split is the mode-specific input of exact and itemized transactions. Tax
+// and tip are spread over the members in proportion to their item subtotal.
+type Split struct {
+	Exact map[string]Money `json:"exact,omitempty" swaggertype:"object,integer"`
+	Items []SplitItem      `json:"items,omitempty"`
+	Tax   Money            `json:"tax" swaggertype:"integer"`
+	Tip   Money            `json:"tip" swaggertype:"integer"`
 }
 
 type Transaction struct {
 	ID          string             `json:"id"`
 	BlockID     string             `json:"block_id"`
 	Description string             `json:"description"`
-	Amount      float64            `json:"amount"`
+	Amount      Money              `json:"amount" swaggertype:"integer"`
 	Payer       string             `json:"payer"`
-	Details     map[string]float64 `json:"details"`
+	Details     map[string]Money   `json:"details" swaggertype:"object,integer"`
 	Ratios      map[string]float64 `json:"ratios"`
+	SplitMode   string             `json:"split_mode"`
+	Split       *Split             `json:"split,omitempty"`
 	CreatedAt   time.Time          `json:"created_at"`
+	// CreatedBy is the username of whoever recorded the transaction.
+	CreatedBy string `json:"created_by"`
+
+	// Amount and Details are in the block's base currency. The amount as
+	// entered and the rate used to convert it are kept for auditing.
+	OriginalAmount   Money       `json:"original_amount" swaggertype:"integer"`
+	OriginalCurrency string      `json:"original_currency"`
+	FXRate           json.Number `json:"fx_rate" swaggertype:"number"`
+}
+
+// Sort orders of a transaction listing.
+const (
+	SortNewest = "-created_at"
+	SortOldest = "created_at"
+)
+
+// TransactionFilter selects one page of transactions. Zero fields do not
+// filter. BlockID limits the listing to one block and Members, when not nil,
+// to what one of the given members paid or shares, in whichever block.
+// Amounts are in the block's base currency, From is inclusive and To
+// exclusive, and Search matches descriptions containing every word: whole
+// words with Postgres full-text search, substrings on SQLite.
+type TransactionFilter struct {
+	BlockID     string
+	Members     []string
+	Payer       string
+	Participant string
+	MinAmount   *int64
+	MaxAmount   *int64
+	From        time.Time
+	To          time.Time
+	Search      string
+	Sort        string
+	Cursor      string
+	Limit       int
+}
+
+// TransactionPage is a page of transactions. NextCursor is empty on the last
+// page and Total counts every transaction matching the filter.
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor"`
+	Total        int           `json:"total"`
+}
+
+// FXRate says one unit of FromCurrency is worth Rate units of ToCurrency on
+// Date (YYYY-MM-DD) and the following days until a newer rate.
+type FXRate struct {
+	Date         string      `json:"date"`
+	FromCurrency string      `json:"from_currency"`
+	ToCurrency   string      `json:"to_currency"`
+	Rate         json.Number `json:"rate" swaggertype:"number"`
+}
+
+// Settlement is a payment from one member to another that pays back debt.
+type Settlement struct {
+	ID        string    `json:"id"`
+	BlockID   string    `json:"block_id"`
+	Payer     string    `json:"payer"`
+	Payee     string    `json:"payee"`
+	Amount    Money     `json:"amount" swaggertype:"integer"`
+	Note      string    `json:"note"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// OpeningBalance carries a member's unsettled balance out of a closed block
+// (FromBlockID/FromMemberID) into the next one (BlockID/MemberID).
+type OpeningBalance struct {
+	ID           string    `json:"id"`
+	BlockID      string    `json:"block_id"`
+	MemberID     string    `json:"member_id"`
+	Amount       Money     `json:"amount" swaggertype:"integer"`
+	FromBlockID  string    `json:"from_block_id"`
+	FromMemberID string    `json:"from_member_id"`
+	CreatedAt    time.Time `json:"created_at"`
 }
 
 type Block struct {
 	ID           string         `json:"id"`
+	GroupID      string         `json:"group_id"`
 	Month        string         `json:"month"`
 	Locked       bool           `json:"locked"`
+	BaseCurrency string         `json:"base_currency"`
 	Members      []*Member      `json:"members"`
 	Transactions []*Transaction `json:"transactions"`
 }
 
+// Roles of a user, from least to most privileged. Each role may do what the
+// roles before it may.
+const (
+	RoleViewer = "viewer"
+	RoleEditor = "editor"
+	RoleAdmin  = "admin"
+)
+
+// Roles lists the roles in order of privilege.
+var Roles = []string{RoleViewer, RoleEditor, RoleAdmin}
+
 type User struct {
 	ID       string `json:"id"`
 	Username string `json:"username"`
 	Password string `json:"password"` // Hashed password
+	Role     string `json:"role"`
 }
 
 type CreateBlock struct {
-	Month   string    `json:"month"`
-	Members []*Member `json:"members"`
+	Month        string    `json:"month"`
+	BaseCurrency string    `json:"base_currency"`
+	Members      []*Member `json:"members"`
 }
 
+// UserLog is an entry of the audit log. Seq, PrevHash and Hash chain it to
+// the entry written before it and are set by WriteBatch.
 type UserLog struct {
 	ID          string    `json:"id"`
 	Username    string    `db:"username"`
@@ -48,14 +211,46 @@ type UserLog struct {
 	IPAddress   string    `db:"ip_address"`
 	UserAgent   string    `db:"user_agent"`
 	Body        string    `db:"body"`
+	Status      int       `db:"status"`
+	DurationMs  int64     `db:"duration_ms"`
 	RequestTime string    `db:"request_time"`
 	CreatedAt   time.Time `json:"created_at"`
+	Seq         int64     `db:"seq"`
+	PrevHash    string    `db:"prev_hash"`
+	Hash        string    `db:"hash"`
+}
+
+// LogFilter selects one page of the audit log, newest first. Zero fields do
+// not filter; From is inclusive and To exclusive.
+type LogFilter struct {
+	Username   string
+	Method     string
+	PathPrefix string
+	Status     int
+	From       time.Time
+	To         time.Time
+	Cursor     string
+	Limit      int
+}
+
+// LogPage is a page of the audit log. NextCursor is empty on the last page.
+// Unlike transactions there is no total: counting the whole log on every
+// request is what paging it avoids.
+type LogPage struct {
+	Logs       []UserLog `json:"logs"`
+	NextCursor string    `json:"next_cursor"`
 }
 
 type UpdateTransactionPayload struct {
 	ID          string
 	Description string
-	Amount      float64
+	Amount      Money
 	Payer       string
 	Ratios      map[string]float64
+	SplitMode   string
+	Split       *Split
+	Details     map[string]Money
+
+	OriginalAmount Money
+	FXRate         json.Number
 }
@@ -0,0 +1,159 @@
+package repository
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used for amounts whose record does not carry a currency.
+const DefaultCurrency = "VND"
+
+// currencyExponents maps ISO-4217 codes to the number of minor-unit digits.
+// Codes missing from the table are treated as having two decimals.
+var currencyExponents = map[string]int{
+	"VND": 0,
+	"JPY": 0,
+	"KRW": 0,
+	"USD": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"THB": 2,
+	"SGD": 2,
+	"AUD": 2,
+	"CNY": 2,
+}
+
+// CurrencyExponent returns the number of minor-unit digits of currency.
+func CurrencyExponent(currency string) int {
+	if e, ok := currencyExponents[strings.ToUpper(currency)]; ok {
+		return e
+	}
+	return 2
+}
+
+// ValidCurrency reports whether code looks like an ISO-4217 alphabetic code.
+func ValidCurrency(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Money is an amount in integer minor units (đồng, cents, ...) of an
+// ISO-4217 currency. It is encoded in JSON as the bare minor-unit integer;
+// the currency travels with the record that owns the amount.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Add returns m + o. Amounts in different currencies cannot be added; a zero
+// value without currency adopts the other side's.
+func (m Money) Add(o Money) (Money, error) {
+	cur, err := m.sameCurrency(o)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: cur}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	return m.Add(o.Neg())
+}
+
+// Convert returns m in currency to, where rate is the number of units of to
+// worth one unit of m's currency. The result is rounded half away from zero
+// to to's minor unit.
+func (m Money) Convert(to string, rate *big.Rat) Money {
+	v := new(big.Rat).SetInt64(m.Amount)
+	v.Mul(v, rate)
+
+	shift := CurrencyExponent(to) - CurrencyExponent(m.Currency)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(max(shift, -shift))), nil))
+	if shift >= 0 {
+		v.Mul(v, scale)
+	} else {
+		v.Quo(v, scale)
+	}
+
+	// Round half away from zero.
+	num := new(big.Int).Abs(v.Num())
+	q, r := new(big.Int).QuoRem(num, v.Denom(), new(big.Int))
+	if r.Lsh(r, 1).Cmp(v.Denom()) >= 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	if v.Sign() < 0 {
+		q.Neg(q)
+	}
+	return NewMoney(q.Int64(), to)
+}
+
+func (m Money) sameCurrency(o Money) (string, error) {
+	switch {
+	case m.Currency == o.Currency:
+		return m.Currency, nil
+	case m.Currency == "":
+		return o.Currency, nil
+	case o.Currency == "":
+		return m.Currency, nil
+	}
+	return "", fmt.Errorf("currency mismatch: %s vs %s", m.Currency, o.Currency)
+}
+
+// String formats m in major units, e.g. "12.34 USD".
+func (m Money) String() string {
+	exp := CurrencyExponent(m.Currency)
+	abs := m.Amount
+	sign := ""
+	if abs < 0 {
+		sign = "-"
+		abs = -abs
+	}
+	digits := strconv.FormatInt(abs, 10)
+	if exp > 0 {
+		if len(digits) <= exp {
+			digits = strings.Repeat("0", exp-len(digits)+1) + digits
+		}
+		digits = digits[:len(digits)-exp] + "." + digits[len(digits)-exp:]
+	}
+	return strings.TrimSpace(sign + digits + " " + m.Currency)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(strconv.FormatInt(m.Amount, 10)), nil
+}
+
+// UnmarshalJSON accepts an integer number of minor units. Fractional values
+// are rejected rather than silently rounded.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return fmt.Errorf("amount must be a number of minor units: %w", err)
+	}
+	v, err := n.Int64()
+	if err != nil {
+		return fmt.Errorf("amount must be an integer number of minor units, got %s", n)
+	}
+	m.Amount = v
+	return nil
+}
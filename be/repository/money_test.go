@@ -0,0 +1,44 @@
+package repository_test
+
+import (
+	"testing"
+
+	"my-source/sheet-payment/be/repository"
+)
+
+func TestMoneyAddSub(t *testing.T) {
+	usd := func(n int64) repository.Money { return repository.NewMoney(n, "USD") }
+	tests := []struct {
+		name    string
+		op      func() (repository.Money, error)
+		want    repository.Money
+		wantErr bool
+	}{
+		{name: "add", op: func() (repository.Money, error) { return usd(150).Add(usd(-50)) }, want: usd(100)},
+		{name: "sub", op: func() (repository.Money, error) { return usd(150).Sub(usd(200)) }, want: usd(-50)},
+		{name: "add to a zero without currency", op: func() (repository.Money, error) {
+			return repository.Money{}.Add(usd(5))
+		}, want: usd(5)},
+		{name: "sub a zero without currency", op: func() (repository.Money, error) {
+			return usd(5).Sub(repository.Money{})
+		}, want: usd(5)},
+		{name: "add mismatched currencies", op: func() (repository.Money, error) {
+			return usd(5).Add(repository.NewMoney(5, "EUR"))
+		}, wantErr: true},
+		{name: "sub mismatched currencies", op: func() (repository.Money, error) {
+			return repository.NewMoney(5, "VND").Sub(usd(5))
+		}, wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := tt.op()
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s = %v, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s = %v, %v; want %v", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package repository
+
+type OpeningBalanceRepository struct {
+	DB DBTX
+}
+
+func NewOpeningBalanceRepository(db DBTX) *OpeningBalanceRepository {
+	return &OpeningBalanceRepository{DB: db}
+}
+
+func (r *OpeningBalanceRepository) Create(balances []OpeningBalance) error {
+	stmt, err := r.DB.Prepare(`
+		INSERT INTO opening_balances (id, block_id, member_id, amount, currency, from_block_id, from_member_id, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, ob := range balances {
+		if _, err := stmt.Exec(ob.ID, ob.BlockID, ob.MemberID, ob.Amount.Amount, currencyOrDefault(ob.Amount.Currency),
+			ob.FromBlockID, ob.FromMemberID, ob.CreatedAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *OpeningBalanceRepository) GetByBlockID(blockID string) ([]OpeningBalance, error) {
+	return r.query(`WHERE block_id = $1`, blockID)
+}
+
+func (r *OpeningBalanceRepository) GetByFromBlockID(blockID string) ([]OpeningBalance, error) {
+	return r.query(`WHERE from_block_id = $1`, blockID)
+}
+
+func (r *OpeningBalanceRepository) query(where string, args ...any) ([]OpeningBalance, error) {
+	rows, err := r.DB.Query(`SELECT id, block_id, member_id, amount, currency, from_block_id, from_member_id, created_at
+       FROM opening_balances `+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var balances []OpeningBalance
+	for rows.Next() {
+		var ob OpeningBalance
+		if err := rows.Scan(&ob.ID, &ob.BlockID, &ob.MemberID, &ob.Amount.Amount, &ob.Amount.Currency,
+			&ob.FromBlockID, &ob.FromMemberID, &ob.CreatedAt); err != nil {
+			return nil, err
+		}
+		balances = append(balances, ob)
+	}
+	return balances, rows.Err()
+}
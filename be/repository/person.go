@@ -0,0 +1,108 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PersonRepository struct {
+	DB DBTX
+}
+
+func NewPersonRepository(db DBTX) *PersonRepository {
+	return &PersonRepository{DB: db}
+}
+
+// personSelect names the linked user, so people are read with one query.
+const personSelect = `SELECT p.id, p.group_id, p.name, p.created_at, COALESCE(u.username, '')
+       FROM people p LEFT JOIN users u ON u.id = p.user_id`
+
+func (r *PersonRepository) query(query string, args ...any) ([]Person, error) {
+	rows, err := r.DB.Query(personSelect+` `+query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var people []Person
+	for rows.Next() {
+		var p Person
+		if err := rows.Scan(&p.ID, &p.GroupID, &p.Name, &p.CreatedAt, &p.Username); err != nil {
+			return nil, err
+		}
+		people = append(people, p)
+	}
+	return people, rows.Err()
+}
+
+func (r *PersonRepository) GetAll(groupID string) ([]Person, error) {
+	return r.query(`WHERE p.group_id = $1 ORDER BY p.name`, groupID)
+}
+
+func (r *PersonRepository) GetByID(groupID, id string) (Person, error) {
+	var p Person
+	err := r.DB.QueryRow(personSelect+` WHERE p.group_id = $1 AND p.id = $2`, groupID, id).
+		Scan(&p.ID, &p.GroupID, &p.Name, &p.CreatedAt, &p.Username)
+	return p, err
+}
+
+// GetOrCreateByName returns the group's oldest person with the given name,
+// creating one when nobody in the group has it yet. It is used when a block
+// is created from bare names instead of person IDs.
+func (r *PersonRepository) GetOrCreateByName(groupID, name string) (Person, error) {
+	p := Person{GroupID: groupID, Name: strings.TrimSpace(name)}
+	err := r.DB.QueryRow(personSelect+` WHERE p.group_id = $1 AND p.name = $2
+       ORDER BY p.created_at LIMIT 1`, groupID, p.Name).Scan(&p.ID, &p.GroupID, &p.Name, &p.CreatedAt, &p.Username)
+	if err == nil {
+		return p, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return p, err
+	}
+
+	p.ID = uuid.New().String()
+	p.CreatedAt = time.Now()
+	_, err = r.DB.Exec(`INSERT INTO people (id, group_id, name, created_at) VALUES ($1, $2, $3, $4)`,
+		p.ID, p.GroupID, p.Name, p.CreatedAt)
+	return p, err
+}
+
+// Link makes the person the user's person in its group, taking the link
+// from any other person of the group. An empty username unlinks the person.
+// It returns sql.ErrNoRows when the person is not one of the group's or the
+// user does not exist.
+func (r *PersonRepository) Link(groupID, personID, username string) error {
+	return inTx(r.DB, func(q DBTX) error {
+		var userID sql.NullString
+		if username != "" {
+			if err := q.QueryRow(`SELECT id FROM users WHERE username = $1`, username).Scan(&userID); err != nil {
+				return err
+			}
+			if _, err := q.Exec(`UPDATE people SET user_id = NULL WHERE group_id = $1 AND user_id = $2`,
+				groupID, userID); err != nil {
+				return err
+			}
+		}
+		res, err := q.Exec(`UPDATE people SET user_id = $1 WHERE group_id = $2 AND id = $3`, userID, groupID, personID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// GetByUsername returns the people linked to the user in the groups the
+// user is still a member of, ordered by group.
+func (r *PersonRepository) GetByUsername(username string) ([]Person, error) {
+	return r.query(`JOIN group_members gm ON gm.group_id = p.group_id AND gm.user_id = p.user_id
+       WHERE u.username = $1 ORDER BY p.group_id`, username)
+}
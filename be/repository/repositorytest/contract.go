@@ -0,0 +1,1181 @@
+// Package repositorytest checks that a storage backend honours the
+// behaviour the rest of the app relies on from the repository interfaces.
+// Every backend is expected to pass the same suite; see Check.
+package repositorytest
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"my-source/sheet-payment/be/repository"
+)
+
+// Backend is the set of repositories under test. They must share one empty
+// store.
+type Backend struct {
+	Groups       repository.IGroupRepository
+	Blocks       repository.IBlockRepository
+	Members      repository.IMemberRepository
+	Transactions repository.ITransactionRepository
+	People       repository.IPersonRepository
+	Settlements  repository.ISettlementRepository
+	Openings     repository.IOpeningBalanceRepository
+	Ledger       repository.ILedgerRepository
+	FXRates      repository.IFXRateRepository
+	Users        repository.IUserRepository
+	Logs         repository.ILogging
+	Tokens       repository.ITokenRepository
+	UnitOfWork   repository.IUnitOfWork
+}
+
+type checker struct {
+	t *testing.T
+}
+
+func (c *checker) errorf(format string, args ...any) {
+	c.t.Helper()
+	c.t.Errorf(format, args...)
+}
+
+// NewGroup creates a user and a group owned by it, for tests that only need
+// somewhere to put blocks, and returns the group's ID.
+func NewGroup(b Backend) (string, error) {
+	owner := &repository.User{ID: uuid.New().String(), Username: "owner-" + uuid.New().String()}
+	if err := b.Users.Create(owner); err != nil {
+		return "", err
+	}
+	group := repository.Group{ID: uuid.New().String(), Name: "Test"}
+	return group.ID, b.Groups.Create(group, owner.Username)
+}
+
+// Check runs the contract against b, one subtest per area so a failure
+// names the part of the backend that broke. Later areas build on the
+// group and block the earlier ones created, and are skipped without them.
+func Check(t *testing.T, b Backend) {
+	run := func(name string, fn func(c *checker)) {
+		t.Run(name, func(t *testing.T) { fn(&checker{t: t}) })
+	}
+
+	run("users", func(c *checker) { c.users(b) })
+	run("tokens", func(c *checker) { c.tokens(b) })
+	var group string
+	var groupOK bool
+	run("groups", func(c *checker) { group, groupOK = c.groups(b) })
+	if groupOK {
+		var block repository.Block
+		var blockOK bool
+		run("blocks", func(c *checker) { block, blockOK = c.blocks(b, group) })
+		if blockOK {
+			run("members", func(c *checker) { c.members(b, block) })
+			run("transactions", func(c *checker) { c.transactions(b, block) })
+			run("settlements", func(c *checker) { c.settlements(b, block) })
+			run("openings", func(c *checker) { c.openings(b, block) })
+			run("delete block", func(c *checker) { c.deleteBlock(b, block) })
+		}
+		run("list transactions", func(c *checker) { c.listTransactions(b, group) })
+		run("links", func(c *checker) { c.links(b, group) })
+		run("unit of work", func(c *checker) { c.unitOfWork(b, group) })
+		run("isolation", func(c *checker) { c.isolation(b, group) })
+	}
+	run("fx rates", func(c *checker) { c.fxRates(b) })
+	run("logs", func(c *checker) { c.logs(b) })
+	run("chains", func(c *checker) { c.chains(b) })
+}
+
+// post moves each member's balance through the ledger, as the business layer
+// does for every document.
+func (c *checker) post(b Backend, blockID, kind, refID string, deltas map[string]repository.Money) {
+	if err := b.Ledger.Post(repository.LedgerEntries(blockID, kind, refID, deltas)); err != nil {
+		c.errorf("Ledger.Post: %v", err)
+	}
+}
+
+func (c *checker) blocks(b Backend, group string) (repository.Block, bool) {
+	alice, err := b.People.GetOrCreateByName(group, " Alice ")
+	if err != nil {
+		c.errorf("People.GetOrCreateByName: %v", err)
+		return repository.Block{}, false
+	}
+	if again, _ := b.People.GetOrCreateByName(group, "Alice"); again.ID != alice.ID {
+		c.errorf("People.GetOrCreateByName created a second Alice: %s != %s", again.ID, alice.ID)
+	}
+	bob, err := b.People.GetOrCreateByName(group, "Bob")
+	if err != nil {
+		c.errorf("People.GetOrCreateByName: %v", err)
+		return repository.Block{}, false
+	}
+
+	block := repository.Block{
+		ID:           uuid.New().String(),
+		GroupID:      group,
+		Month:        "2099-01",
+		BaseCurrency: "USD",
+		Members: []*repository.Member{
+			{PersonID: alice.ID, Name: " Alice ", Ratio: 1},
+			{PersonID: bob.ID, Name: "Bob", Ratio: 2},
+		},
+	}
+	if err := b.Blocks.Create(block); err != nil {
+		c.errorf("Blocks.Create: %v", err)
+		return block, false
+	}
+
+	got, err := b.Blocks.GetByMonth(group, block.Month)
+	if err != nil {
+		c.errorf("Blocks.GetByMonth: %v", err)
+		return block, false
+	}
+	if got.ID != block.ID || got.GroupID != group || got.Locked || got.BaseCurrency != "USD" {
+		c.errorf("Blocks.GetByMonth = %+v, want id %s in group %s, unlocked, USD", got, block.ID, group)
+	}
+	if _, err := b.Blocks.GetByMonth(group, "1999-01"); err == nil {
+		c.errorf("Blocks.GetByMonth of a missing month returned no error")
+	}
+	if id, locked, err := b.Blocks.GetIDByMonth(group, block.Month); err != nil || id != block.ID || locked {
+		c.errorf("Blocks.GetIDByMonth = %s, %v, %v", id, locked, err)
+	}
+	if id, _, err := b.Blocks.Get(group, block.ID); err != nil || id != block.ID {
+		c.errorf("Blocks.Get = %s, %v", id, err)
+	}
+	if _, _, err := b.Blocks.Get(group, uuid.New().String()); err == nil {
+		c.errorf("Blocks.Get of a missing block returned no error")
+	}
+
+	all, err := b.Blocks.GetAllBlocks(group)
+	if err != nil || len(all) != 1 || all[0].Month != block.Month {
+		c.errorf("Blocks.GetAllBlocks = %+v, %v", all, err)
+	}
+
+	if err := b.Blocks.Lock(group, block.Month); err != nil {
+		c.errorf("Blocks.Lock: %v", err)
+	}
+	if _, locked, _ := b.Blocks.GetIDByMonth(group, block.Month); !locked {
+		c.errorf("block not locked after Lock")
+	}
+	if err := b.Blocks.DeleteBlock(group, block.ID); err == nil {
+		c.errorf("Blocks.DeleteBlock deleted a locked block")
+	}
+	if err := b.Blocks.Unlock(group, block.Month); err != nil {
+		c.errorf("Blocks.Unlock: %v", err)
+	}
+	if _, locked, _ := b.Blocks.GetIDByMonth(group, block.Month); locked {
+		c.errorf("block still locked after Unlock")
+	}
+
+	members, err := b.Members.GetByBlockID(block.ID)
+	if err != nil || len(members) != 2 {
+		c.errorf("Members.GetByBlockID = %+v, %v", members, err)
+		return block, false
+	}
+	block.Members = block.Members[:0]
+	for i := range members {
+		block.Members = append(block.Members, &members[i])
+	}
+	return block, true
+}
+
+func (c *checker) members(b Backend, block repository.Block) {
+	byName := map[string]repository.Member{}
+	for _, m := range block.Members {
+		byName[m.Name] = *m
+		if m.ID == "" || m.BlockID != block.ID {
+			c.errorf("member %+v: missing ID or wrong block", m)
+		}
+		if m.Debt.Currency != "USD" || !m.Debt.IsZero() {
+			c.errorf("member %s debt = %v, want 0 USD", m.Name, m.Debt)
+		}
+	}
+	alice, ok := byName["Alice"]
+	if !ok {
+		c.errorf("member names are not trimmed: %v", reflect.ValueOf(byName).MapKeys())
+		return
+	}
+
+	c.post(b, block.ID, repository.LedgerAdjustment, "members", map[string]repository.Money{
+		alice.ID: repository.NewMoney(150, "USD"),
+	})
+	c.post(b, block.ID, repository.LedgerAdjustment, "members", map[string]repository.Money{
+		alice.ID: repository.NewMoney(-50, "USD"),
+	})
+	if entries, err := b.Ledger.GetByBlockID(block.ID); err != nil || len(entries) != 2 ||
+		entries[0].MemberID != alice.ID || entries[0].Amount.Currency != "USD" {
+		c.errorf("Ledger.GetByBlockID = %+v, %v", entries, err)
+	}
+	if err := b.Members.UpdateRatio(alice.ID, 3); err != nil {
+		c.errorf("Members.UpdateRatio: %v", err)
+	}
+
+	debts, err := b.Members.GetDebtsByBlockID(block.ID)
+	if err != nil {
+		c.errorf("Members.GetDebtsByBlockID: %v", err)
+	} else if want := repository.NewMoney(100, "USD"); debts["Alice"] != want {
+		c.errorf("Alice debt = %v, want %v", debts["Alice"], want)
+	}
+
+	memberships, err := b.Members.GetByPersonID(alice.PersonID)
+	if err != nil || len(memberships) != 1 || memberships[0].Month != block.Month || memberships[0].Ratio != 3 {
+		c.errorf("Members.GetByPersonID = %+v, %v", memberships, err)
+	}
+
+	all, err := b.Members.GetAll(block.GroupID)
+	if err != nil || len(all) != len(block.Members) {
+		c.errorf("Members.GetAll = %d members, %v; want %d", len(all), err, len(block.Members))
+	}
+
+	// Reset so the transaction checks start from zero balances.
+	c.post(b, block.ID, repository.LedgerAdjustment, "members", map[string]repository.Money{
+		alice.ID: repository.NewMoney(-100, "USD"),
+	})
+}
+
+func (c *checker) transactions(b Backend, block repository.Block) {
+	alice, bob := *block.Members[0], *block.Members[1]
+	if alice.Name != "Alice" {
+		alice, bob = bob, alice
+	}
+
+	tx := repository.Transaction{
+		ID:             uuid.New().String(),
+		BlockID:        block.ID,
+		Description:    "Dinner",
+		Amount:         repository.NewMoney(1000, "USD"),
+		Payer:          alice.ID,
+		Ratios:         map[string]float64{alice.ID: 1, bob.ID: 3},
+		SplitMode:      repository.SplitShares,
+		CreatedAt:      time.Now().UTC().Truncate(time.Second),
+		CreatedBy:      "alice",
+		OriginalAmount: repository.NewMoney(1000, "USD"),
+	}
+	details := map[string]repository.Money{
+		alice.ID: repository.NewMoney(250, "USD"),
+		bob.ID:   repository.NewMoney(750, "USD"),
+	}
+	if err := b.Transactions.Add(tx); err != nil {
+		c.errorf("Transactions.Add: %v", err)
+		return
+	}
+	if err := b.Transactions.AddDetails(tx.ID, details); err != nil {
+		c.errorf("Transactions.AddDetails: %v", err)
+	}
+	c.post(b, block.ID, repository.LedgerTransaction, tx.ID, repository.DebtDeltas(tx.Amount, tx.Payer, details))
+	if debts, _ := b.Members.GetDebtsByBlockID(block.ID); debts["Alice"].Amount != 750 || debts["Bob"].Amount != -750 {
+		c.errorf("debts after posting the transaction = %v, want Alice 750, Bob -750", debts)
+	}
+
+	got, err := b.Transactions.GetByID(block.GroupID, tx.ID)
+	if err != nil {
+		c.errorf("Transactions.GetByID: %v", err)
+	} else {
+		if got.Amount != tx.Amount || got.Payer != tx.Payer || got.Description != tx.Description ||
+			got.BlockID != block.ID || got.SplitMode != tx.SplitMode || got.CreatedBy != tx.CreatedBy {
+			c.errorf("Transactions.GetByID = %+v, want %+v", got, tx)
+		}
+		if !reflect.DeepEqual(got.Ratios, tx.Ratios) {
+			c.errorf("ratios = %v, want %v", got.Ratios, tx.Ratios)
+		}
+		if !got.CreatedAt.Equal(tx.CreatedAt) {
+			c.errorf("created_at = %v, want %v", got.CreatedAt, tx.CreatedAt)
+		}
+		if got.FXRate != "1" {
+			c.errorf("fx_rate = %q, want 1", got.FXRate)
+		}
+	}
+	if _, err := b.Transactions.GetByID(block.GroupID, uuid.New().String()); err == nil {
+		c.errorf("Transactions.GetByID of a missing transaction returned no error")
+	}
+
+	if got, err := b.Transactions.GetDetails(tx.ID); err != nil || !reflect.DeepEqual(got, details) {
+		c.errorf("Transactions.GetDetails = %v, %v; want %v", got, err, details)
+	}
+
+	list, err := b.Transactions.GetByBlockID(block.ID)
+	if err != nil || len(list) != 1 || !reflect.DeepEqual(list[0].Details, details) {
+		c.errorf("Transactions.GetByBlockID = %+v, %v", list, err)
+	}
+
+	// UpdateTransaction rewrites the details but leaves the ledger alone.
+	update := repository.UpdateTransactionPayload{
+		ID:             tx.ID,
+		Description:    "Dinner and taxi",
+		Amount:         repository.NewMoney(1200, "USD"),
+		Payer:          bob.ID,
+		Ratios:         map[string]float64{alice.ID: 1, bob.ID: 1},
+		SplitMode:      repository.SplitEqual,
+		OriginalAmount: repository.NewMoney(1200, "USD"),
+		Details: map[string]repository.Money{
+			alice.ID: repository.NewMoney(600, "USD"),
+			bob.ID:   repository.NewMoney(600, "USD"),
+		},
+	}
+	if err := b.Transactions.UpdateTransaction(update); err != nil {
+		c.errorf("Transactions.UpdateTransaction: %v", err)
+	} else {
+		debts, err := b.Members.GetDebtsByBlockID(block.ID)
+		if err != nil {
+			c.errorf("Members.GetDebtsByBlockID: %v", err)
+		}
+		if debts["Alice"].Amount != 750 || debts["Bob"].Amount != -750 {
+			c.errorf("debts after UpdateTransaction = %v, want Alice 750, Bob -750", debts)
+		}
+		got, _ := b.Transactions.GetByID(block.GroupID, tx.ID)
+		if got.Description != update.Description || got.Payer != bob.ID || got.SplitMode != repository.SplitEqual {
+			c.errorf("transaction after UpdateTransaction = %+v", got)
+		}
+		c.expectedDebts(b, block, alice, bob)
+	}
+
+	if err := b.Blocks.Lock(block.GroupID, block.Month); err != nil {
+		c.errorf("Blocks.Lock: %v", err)
+	}
+	if err := b.Transactions.UpdateTransaction(update); err == nil {
+		c.errorf("Transactions.UpdateTransaction changed a transaction of a locked block")
+	}
+	if err := b.Blocks.Unlock(block.GroupID, block.Month); err != nil {
+		c.errorf("Blocks.Unlock: %v", err)
+	}
+
+	if err := b.Transactions.Delete(tx.ID); err != nil {
+		c.errorf("Transactions.Delete: %v", err)
+	}
+	if _, err := b.Transactions.GetByID(block.GroupID, tx.ID); err == nil {
+		c.errorf("transaction still found after Delete")
+	}
+	if got, _ := b.Transactions.GetDetails(tx.ID); len(got) != 0 {
+		c.errorf("details still found after Delete: %v", got)
+	}
+}
+
+// expectedDebts checks that the documents add up to the debts below, while
+// the ledger still holds the transaction as first posted, then posts the
+// difference and checks that the balances follow.
+func (c *checker) expectedDebts(b Backend, block repository.Block, alice, bob repository.Member) {
+	want := map[string]repository.Money{
+		alice.ID: repository.NewMoney(-600, "USD"),
+		bob.ID:   repository.NewMoney(600, "USD"),
+	}
+	if got, err := b.Members.ExpectedDebts(block.ID); err != nil || !reflect.DeepEqual(got, want) {
+		c.errorf("Members.ExpectedDebts = %v, %v; want %v", got, err, want)
+	}
+
+	c.post(b, block.ID, repository.LedgerAdjustment, "reconcile", map[string]repository.Money{
+		alice.ID: repository.NewMoney(-1350, "USD"),
+		bob.ID:   repository.NewMoney(1350, "USD"),
+	})
+	if got, _ := b.Members.ExpectedDebts(block.ID); !reflect.DeepEqual(got, want) {
+		c.errorf("Members.ExpectedDebts followed the ledger: %v", got)
+	}
+	debts, _ := b.Members.GetDebtsByBlockID(block.ID)
+	if debts["Alice"] != want[alice.ID] || debts["Bob"] != want[bob.ID] {
+		c.errorf("debts after the adjustment = %v, want %v", debts, want)
+	}
+}
+
+func (c *checker) settlements(b Backend, block repository.Block) {
+	now := time.Now().UTC().Truncate(time.Second)
+	first := repository.Settlement{
+		ID:        uuid.New().String(),
+		BlockID:   block.ID,
+		Payer:     block.Members[0].ID,
+		Payee:     block.Members[1].ID,
+		Amount:    repository.NewMoney(300, "USD"),
+		Note:      "cash",
+		CreatedAt: now.Add(-time.Hour),
+	}
+	second := first
+	second.ID = uuid.New().String()
+	second.CreatedAt = now
+	for _, s := range []repository.Settlement{first, second} {
+		if err := b.Settlements.Add(s); err != nil {
+			c.errorf("Settlements.Add: %v", err)
+			return
+		}
+	}
+
+	got, err := b.Settlements.GetByID(first.ID)
+	if err != nil || got.Payer != first.Payer || got.Amount != first.Amount || got.Note != first.Note ||
+		!got.CreatedAt.Equal(first.CreatedAt) {
+		c.errorf("Settlements.GetByID = %+v, %v; want %+v", got, err, first)
+	}
+	if _, err := b.Settlements.GetByID(uuid.New().String()); err == nil {
+		c.errorf("Settlements.GetByID of a missing settlement returned no error")
+	}
+
+	list, err := b.Settlements.GetByBlockID(block.ID)
+	if err != nil || len(list) != 2 || list[0].ID != second.ID {
+		c.errorf("Settlements.GetByBlockID = %+v, %v; want newest first", list, err)
+	}
+
+	for _, s := range []repository.Settlement{first, second} {
+		if err := b.Settlements.Delete(s.ID); err != nil {
+			c.errorf("Settlements.Delete: %v", err)
+		}
+	}
+	if list, _ := b.Settlements.GetByBlockID(block.ID); len(list) != 0 {
+		c.errorf("settlements still found after Delete: %+v", list)
+	}
+}
+
+// openings rolls a balance from block into a new month and checks that the
+// source block cannot be deleted while the new one still carries it, and that
+// deleting the new block hands the balance back.
+func (c *checker) openings(b Backend, block repository.Block) {
+	from := block.Members[0]
+	next := repository.Block{
+		ID:           uuid.New().String(),
+		GroupID:      block.GroupID,
+		Month:        "2099-02",
+		BaseCurrency: "USD",
+		Members:      []*repository.Member{{PersonID: from.PersonID, Name: from.Name, Ratio: 1}},
+	}
+	if err := b.Blocks.Create(next); err != nil {
+		c.errorf("Blocks.Create: %v", err)
+		return
+	}
+
+	before, _ := b.Members.GetDebtsByBlockID(block.ID)
+	ob := repository.OpeningBalance{
+		ID:           uuid.New().String(),
+		BlockID:      next.ID,
+		MemberID:     next.Members[0].ID,
+		Amount:       repository.NewMoney(40, "USD"),
+		FromBlockID:  block.ID,
+		FromMemberID: from.ID,
+		CreatedAt:    time.Now(),
+	}
+	if err := b.Openings.Create([]repository.OpeningBalance{ob}); err != nil {
+		c.errorf("Openings.Create: %v", err)
+		return
+	}
+	c.post(b, next.ID, repository.LedgerOpening, ob.ID, map[string]repository.Money{ob.MemberID: ob.Amount})
+	c.post(b, block.ID, repository.LedgerOpening, ob.ID, map[string]repository.Money{ob.FromMemberID: ob.Amount.Neg()})
+	if debts, _ := b.Members.GetDebtsByBlockID(next.ID); debts[from.Name] != ob.Amount {
+		c.errorf("carried debt = %v, want %v", debts[from.Name], ob.Amount)
+	}
+
+	list, err := b.Openings.GetByBlockID(next.ID)
+	if err != nil || len(list) != 1 || list[0].MemberID != ob.MemberID || list[0].Amount != ob.Amount ||
+		list[0].FromMemberID != from.ID {
+		c.errorf("Openings.GetByBlockID = %+v, %v", list, err)
+	}
+	if list, err := b.Openings.GetByFromBlockID(block.ID); err != nil || len(list) != 1 || list[0].ID != ob.ID {
+		c.errorf("Openings.GetByFromBlockID = %+v, %v", list, err)
+	}
+	if list, err := b.Openings.GetByFromBlockID(next.ID); err != nil || len(list) != 0 {
+		c.errorf("Openings.GetByFromBlockID of a block carried nothing = %+v, %v", list, err)
+	}
+
+	if err := b.Blocks.DeleteBlock(block.GroupID, block.ID); err == nil {
+		c.errorf("Blocks.DeleteBlock deleted a block whose balances were rolled over")
+	}
+	if err := b.Blocks.DeleteBlock(block.GroupID, next.ID); err != nil {
+		c.errorf("Blocks.DeleteBlock: %v", err)
+	}
+	after, _ := b.Members.GetDebtsByBlockID(block.ID)
+	if after[from.Name] != before[from.Name] {
+		c.errorf("debt of %s after deleting the rolled-over block = %v, want %v", from.Name, after[from.Name],
+			before[from.Name])
+	}
+}
+
+func (c *checker) deleteBlock(b Backend, block repository.Block) {
+	tx := repository.Transaction{
+		ID:        uuid.New().String(),
+		BlockID:   block.ID,
+		Amount:    repository.NewMoney(10, "USD"),
+		Payer:     block.Members[0].ID,
+		Ratios:    map[string]float64{},
+		CreatedAt: time.Now(),
+	}
+	if err := b.Transactions.Add(tx); err != nil {
+		c.errorf("Transactions.Add: %v", err)
+	}
+	if err := b.Blocks.DeleteBlock(block.GroupID, block.ID); err != nil {
+		c.errorf("Blocks.DeleteBlock: %v", err)
+		return
+	}
+	if _, err := b.Blocks.GetByMonth(block.GroupID, block.Month); err == nil {
+		c.errorf("block still found after DeleteBlock")
+	}
+	if members, _ := b.Members.GetByBlockID(block.ID); len(members) != 0 {
+		c.errorf("members still found after DeleteBlock: %+v", members)
+	}
+	if txs, _ := b.Transactions.GetByBlockID(block.ID); len(txs) != 0 {
+		c.errorf("transactions still found after DeleteBlock: %+v", txs)
+	}
+
+	// The ledger keeps the block's entries and zeroes every balance.
+	entries, err := b.Ledger.GetByBlockID(block.ID)
+	if err != nil || len(entries) == 0 {
+		c.errorf("Ledger.GetByBlockID after DeleteBlock = %+v, %v; want the entries kept", entries, err)
+	}
+	balances := map[string]int64{}
+	for _, e := range entries {
+		balances[e.MemberID] += e.Amount.Amount
+	}
+	for id, v := range balances {
+		if v != 0 {
+			c.errorf("balance of member %s after DeleteBlock = %d, want 0", id, v)
+		}
+	}
+}
+
+// listTransactions pages through a block of five transactions, two of them
+// sharing a timestamp, with each filter of TransactionFilter.
+func (c *checker) listTransactions(b Backend, group string) {
+	alice, _ := b.People.GetOrCreateByName(group, "Alice")
+	bob, _ := b.People.GetOrCreateByName(group, "Bob")
+	block := repository.Block{
+		ID:           uuid.New().String(),
+		GroupID:      group,
+		Month:        "2099-03",
+		BaseCurrency: "USD",
+		Members: []*repository.Member{
+			{PersonID: alice.ID, Name: alice.Name, Ratio: 1},
+			{PersonID: bob.ID, Name: bob.Name, Ratio: 1},
+		},
+	}
+	if err := b.Blocks.Create(block); err != nil {
+		c.errorf("Blocks.Create: %v", err)
+		return
+	}
+	a, o := block.Members[0].ID, block.Members[1].ID
+
+	start := time.Date(2099, 3, 1, 12, 0, 0, 0, time.UTC)
+	rows := []struct {
+		description string
+		amount      int64
+		payer       string
+		minute      int
+		shared      bool
+	}{
+		{"Lunch at 50% off", 100, a, 0, false},
+		{"Dinner", 200, a, 10, true},
+		{"Dinner and taxi", 300, o, 10, true},
+		{"Groceries", 400, o, 20, false},
+		{"Taxi", 500, a, 30, true},
+	}
+	ids := map[string]string{}
+	for _, row := range rows {
+		tx := repository.Transaction{
+			ID:          uuid.New().String(),
+			BlockID:     block.ID,
+			Description: row.description,
+			Amount:      repository.NewMoney(row.amount, "USD"),
+			Payer:       row.payer,
+			Ratios:      map[string]float64{},
+			CreatedAt:   start.Add(time.Duration(row.minute) * time.Minute),
+		}
+		details := map[string]repository.Money{a: tx.Amount}
+		if row.shared {
+			details = map[string]repository.Money{
+				a: repository.NewMoney(row.amount/2, "USD"),
+				o: repository.NewMoney(row.amount/2, "USD"),
+			}
+		}
+		if err := b.Transactions.Add(tx); err != nil {
+			c.errorf("Transactions.Add: %v", err)
+			return
+		}
+		if err := b.Transactions.AddDetails(tx.ID, details); err != nil {
+			c.errorf("Transactions.AddDetails: %v", err)
+		}
+		ids[row.description] = tx.ID
+	}
+
+	// all follows the cursors to the end and returns the descriptions in
+	// page order.
+	all := func(f repository.TransactionFilter) ([]string, int) {
+		f.BlockID, f.Limit = block.ID, 2
+		var got []string
+		total := -1
+		for range len(rows) + 1 {
+			page, err := b.Transactions.List(f)
+			if err != nil {
+				c.errorf("Transactions.List(%+v): %v", f, err)
+				return nil, 0
+			}
+			if total != -1 && page.Total != total {
+				c.errorf("Transactions.List total changed between pages: %d != %d", page.Total, total)
+			}
+			total = page.Total
+			for _, tx := range page.Transactions {
+				got = append(got, tx.Description)
+				if len(tx.Details) == 0 {
+					c.errorf("Transactions.List returned %q without details", tx.Description)
+				}
+			}
+			if page.NextCursor == "" {
+				return got, total
+			}
+			f.Cursor = page.NextCursor
+		}
+		c.errorf("Transactions.List kept returning a next cursor")
+		return got, total
+	}
+
+	// The two dinners share a timestamp and are ordered by ID.
+	dinners := []string{"Dinner", "Dinner and taxi"}
+	if ids["Dinner"] > ids["Dinner and taxi"] {
+		dinners = []string{"Dinner and taxi", "Dinner"}
+	}
+	oldest := append(append([]string{"Lunch at 50% off"}, dinners...), "Groceries", "Taxi")
+	newest := slices.Clone(oldest)
+	slices.Reverse(newest)
+
+	lo, hi := int64(200), int64(400)
+	tests := []struct {
+		name   string
+		filter repository.TransactionFilter
+		want   []string
+	}{
+		{"newest first", repository.TransactionFilter{}, newest},
+		{"oldest first", repository.TransactionFilter{Sort: repository.SortOldest}, oldest},
+		{"payer", repository.TransactionFilter{Payer: o, Sort: repository.SortOldest},
+			[]string{"Dinner and taxi", "Groceries"}},
+		{"participant", repository.TransactionFilter{Participant: o}, []string{"Taxi", dinners[1], dinners[0]}},
+		{"amount range", repository.TransactionFilter{MinAmount: &lo, MaxAmount: &hi, Sort: repository.SortOldest},
+			append(slices.Clone(dinners), "Groceries")},
+		{"date range", repository.TransactionFilter{From: start.Add(10 * time.Minute), To: start.Add(30 * time.Minute),
+			Sort: repository.SortOldest}, append(slices.Clone(dinners), "Groceries")},
+		{"search", repository.TransactionFilter{Search: "TAXI", Sort: repository.SortOldest},
+			[]string{"Dinner and taxi", "Taxi"}},
+		{"search every word", repository.TransactionFilter{Search: "dinner taxi"}, []string{"Dinner and taxi"}},
+		{"search literal percent", repository.TransactionFilter{Search: "50%"}, []string{"Lunch at 50% off"}},
+		{"search literal underscore", repository.TransactionFilter{Search: "5_"}, nil},
+		{"members", repository.TransactionFilter{Members: []string{o}},
+			[]string{"Taxi", "Groceries", dinners[1], dinners[0]}},
+		{"no members", repository.TransactionFilter{Members: []string{}}, nil},
+	}
+	for _, tt := range tests {
+		got, total := all(tt.filter)
+		if !slices.Equal(got, tt.want) || total != len(tt.want) {
+			c.errorf("Transactions.List %s = %q (total %d), want %q", tt.name, got, total, tt.want)
+		}
+	}
+
+	if _, err := b.Transactions.List(repository.TransactionFilter{BlockID: block.ID, Limit: 2, Cursor: "%%"}); err == nil {
+		c.errorf("Transactions.List accepted a malformed cursor")
+	}
+}
+
+func (c *checker) fxRates(b Backend) {
+	rates := []repository.FXRate{
+		{Date: "2099-01-01", FromCurrency: "USD", ToCurrency: "VND", Rate: "25000"},
+		{Date: "2099-01-10", FromCurrency: "USD", ToCurrency: "VND", Rate: "25100.5"},
+		{Date: "2099-01-05", FromCurrency: "EUR", ToCurrency: "VND", Rate: "27000"},
+	}
+	if err := b.FXRates.Upsert(rates); err != nil {
+		c.errorf("FXRates.Upsert: %v", err)
+		return
+	}
+
+	day := func(s string) time.Time {
+		t, _ := time.Parse(time.DateOnly, s)
+		return t
+	}
+	if got, err := b.FXRates.Find("USD", "VND", day("2099-01-09")); err != nil || got != rates[0] {
+		c.errorf("FXRates.Find before the second rate = %+v, %v; want %+v", got, err, rates[0])
+	}
+	if got, err := b.FXRates.Find("USD", "VND", day("2099-02-01")); err != nil || got != rates[1] {
+		c.errorf("FXRates.Find after the second rate = %+v, %v; want %+v", got, err, rates[1])
+	}
+	if _, err := b.FXRates.Find("USD", "VND", day("2098-12-31")); !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("FXRates.Find before any rate = %v, want sql.ErrNoRows", err)
+	}
+
+	updated := rates[0]
+	updated.Rate = "24900"
+	if err := b.FXRates.Upsert([]repository.FXRate{updated}); err != nil {
+		c.errorf("FXRates.Upsert: %v", err)
+	}
+	all, err := b.FXRates.GetAll()
+	want := []repository.FXRate{rates[1], rates[2], updated}
+	if err != nil || !reflect.DeepEqual(all, want) {
+		c.errorf("FXRates.GetAll = %+v, %v; want %+v", all, err, want)
+	}
+}
+
+// unitOfWork checks that a failed unit of work leaves no trace and a
+// successful one is visible afterwards.
+func (c *checker) unitOfWork(b Backend, group string) {
+	failure := errors.New("rollback")
+	err := b.UnitOfWork.Do(func(r repository.Repositories) error {
+		if _, err := r.People.GetOrCreateByName(group, "Rolled Back"); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		c.errorf("UnitOfWork.Do = %v, want the error of fn", err)
+	}
+
+	var committed repository.Person
+	err = b.UnitOfWork.Do(func(r repository.Repositories) error {
+		committed, err = r.People.GetOrCreateByName(group, "Committed")
+		return err
+	})
+	if err != nil {
+		c.errorf("UnitOfWork.Do: %v", err)
+	}
+
+	people, err := b.People.GetAll(group)
+	if err != nil {
+		c.errorf("People.GetAll: %v", err)
+	}
+	names := map[string]string{}
+	for _, p := range people {
+		names[p.Name] = p.ID
+	}
+	if _, ok := names["Rolled Back"]; ok {
+		c.errorf("person created in a failed unit of work was kept")
+	}
+	if names["Committed"] != committed.ID {
+		c.errorf("person created in a committed unit of work not found")
+	}
+}
+
+// groups creates the group the block checks run in, owned by alice, and
+// checks memberships. It uses the users created by users.
+func (c *checker) groups(b Backend) (string, bool) {
+	flat := repository.Group{ID: uuid.New().String(), Name: "Flat"}
+	if err := b.Groups.Create(flat, "alice"); err != nil {
+		c.errorf("Groups.Create: %v", err)
+		return "", false
+	}
+	ghost := repository.Group{ID: uuid.New().String(), Name: "Ghost"}
+	if err := b.Groups.Create(ghost, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("Groups.Create owned by a missing user = %v, want sql.ErrNoRows", err)
+	}
+	if role, err := b.Groups.GetRole(flat.ID, "alice"); err != nil || role != repository.RoleAdmin {
+		c.errorf("owner's role = %q, %v; want admin", role, err)
+	}
+	if _, err := b.Groups.GetRole(flat.ID, "bob"); !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("Groups.GetRole of a non-member = %v, want sql.ErrNoRows", err)
+	}
+
+	if err := b.Groups.SetMember(flat.ID, "bob", repository.RoleViewer); err != nil {
+		c.errorf("Groups.SetMember: %v", err)
+	}
+	if err := b.Groups.SetMember(flat.ID, "bob", repository.RoleEditor); err != nil {
+		c.errorf("Groups.SetMember of a member: %v", err)
+	}
+	if err := b.Groups.SetMember(flat.ID, "nobody", repository.RoleViewer); !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("Groups.SetMember of a missing user = %v, want sql.ErrNoRows", err)
+	}
+	members, err := b.Groups.GetMembers(flat.ID)
+	var got []string
+	for _, m := range members {
+		got = append(got, m.Username+":"+m.Role)
+	}
+	if want := []string{"alice:admin", "bob:editor"}; err != nil || !slices.Equal(got, want) {
+		c.errorf("Groups.GetMembers = %q, %v; want %q", got, err, want)
+	}
+
+	trip := repository.Group{ID: uuid.New().String(), Name: "Trip"}
+	if err := b.Groups.Create(trip, "bob"); err != nil {
+		c.errorf("Groups.Create: %v", err)
+	}
+	names := func(groups []repository.Group, err error) []string {
+		if err != nil {
+			c.errorf("listing groups: %v", err)
+		}
+		var names []string
+		for _, g := range groups {
+			names = append(names, g.Name+":"+g.Role)
+		}
+		return names
+	}
+	if got, want := names(b.Groups.GetByUsername("bob")), []string{"Flat:editor", "Trip:admin"}; !slices.Equal(got, want) {
+		c.errorf("Groups.GetByUsername = %q, want %q", got, want)
+	}
+	if got, want := names(b.Groups.GetAll()), []string{"Flat:", "Trip:"}; !slices.Equal(got, want) {
+		c.errorf("Groups.GetAll = %q, want %q (without the group of a failed Create)", got, want)
+	}
+
+	if err := b.Groups.RemoveMember(trip.ID, "bob"); err != nil {
+		c.errorf("Groups.RemoveMember: %v", err)
+	}
+	if err := b.Groups.RemoveMember(trip.ID, "bob"); !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("Groups.RemoveMember of a non-member = %v, want sql.ErrNoRows", err)
+	}
+	if got, want := names(b.Groups.GetByUsername("bob")), []string{"Flat:editor"}; !slices.Equal(got, want) {
+		c.errorf("Groups.GetByUsername after RemoveMember = %q, want %q", got, want)
+	}
+	return flat.ID, true
+}
+
+// isolation gives another group a block for the same month as one of group
+// and checks that neither group reaches the other's rows.
+func (c *checker) isolation(b Backend, group string) {
+	other := repository.Group{ID: uuid.New().String(), Name: "Other"}
+	if err := b.Groups.Create(other, "alice"); err != nil {
+		c.errorf("Groups.Create: %v", err)
+		return
+	}
+	ours, _ := b.People.GetOrCreateByName(group, "Alice")
+	theirs, err := b.People.GetOrCreateByName(other.ID, "Alice")
+	if err != nil || theirs.ID == ours.ID || theirs.GroupID != other.ID {
+		c.errorf("People.GetOrCreateByName in another group = %+v, %v; want a new person", theirs, err)
+		return
+	}
+	if _, err := b.People.GetByID(other.ID, ours.ID); err == nil {
+		c.errorf("People.GetByID returned another group's person")
+	}
+	if people, err := b.People.GetAll(other.ID); err != nil || len(people) != 1 || people[0].ID != theirs.ID {
+		c.errorf("People.GetAll = %+v, %v; want only %s", people, err, theirs.ID)
+	}
+
+	const month = "2099-05"
+	mine := repository.Block{ID: uuid.New().String(), GroupID: group, Month: month,
+		Members: []*repository.Member{{PersonID: ours.ID, Name: ours.Name, Ratio: 1}}}
+	block := repository.Block{ID: uuid.New().String(), GroupID: other.ID, Month: month,
+		Members: []*repository.Member{{PersonID: theirs.ID, Name: theirs.Name, Ratio: 1}}}
+	for _, blk := range []repository.Block{mine, block} {
+		if err := b.Blocks.Create(blk); err != nil {
+			c.errorf("Blocks.Create of a month another group has: %v", err)
+			return
+		}
+	}
+	tx := repository.Transaction{ID: uuid.New().String(), BlockID: block.ID, Amount: repository.NewMoney(10, "VND"),
+		Payer: block.Members[0].ID, Ratios: map[string]float64{}, CreatedAt: time.Now()}
+	if err := b.Transactions.Add(tx); err != nil {
+		c.errorf("Transactions.Add: %v", err)
+	}
+
+	if got, err := b.Blocks.GetByMonth(group, month); err != nil || got.ID != mine.ID {
+		c.errorf("Blocks.GetByMonth = %+v, %v; want %s", got, err, mine.ID)
+	}
+	if _, _, err := b.Blocks.Get(group, block.ID); err == nil {
+		c.errorf("Blocks.Get returned another group's block")
+	}
+	if all, err := b.Blocks.GetAllBlocks(other.ID); err != nil || len(all) != 1 || all[0].ID != block.ID {
+		c.errorf("Blocks.GetAllBlocks = %+v, %v; want only %s", all, err, block.ID)
+	}
+	if err := b.Blocks.Lock(group, month); err != nil {
+		c.errorf("Blocks.Lock: %v", err)
+	}
+	if _, locked, _ := b.Blocks.GetIDByMonth(other.ID, month); locked {
+		c.errorf("Blocks.Lock locked another group's month")
+	}
+	if err := b.Blocks.DeleteBlock(group, block.ID); err == nil {
+		c.errorf("Blocks.DeleteBlock deleted another group's block")
+	}
+	if _, err := b.Transactions.GetByID(group, tx.ID); err == nil {
+		c.errorf("Transactions.GetByID returned another group's transaction")
+	}
+	if _, err := b.Transactions.GetByID(other.ID, tx.ID); err != nil {
+		c.errorf("Transactions.GetByID: %v", err)
+	}
+	if members, err := b.Members.GetAll(other.ID); err != nil || len(members) != 1 || members[0].BlockID != block.ID {
+		c.errorf("Members.GetAll = %+v, %v; want the member of %s", members, err, block.ID)
+	}
+
+	// A feed over members reaches into every block they are in, and only
+	// there.
+	feed := func(member string) int {
+		page, err := b.Transactions.List(repository.TransactionFilter{Members: []string{member}, Limit: 10})
+		if err != nil {
+			c.errorf("Transactions.List: %v", err)
+		}
+		return page.Total
+	}
+	if n := feed(block.Members[0].ID); n != 1 {
+		c.errorf("Transactions.List of another block's member = %d transactions, want 1", n)
+	}
+	if n := feed(mine.Members[0].ID); n != 0 {
+		c.errorf("Transactions.List of a member without transactions = %d transactions, want 0", n)
+	}
+
+	// bob is not a member of the other group, so a link there stays hidden.
+	if err := b.People.Link(other.ID, theirs.ID, "bob"); err != nil {
+		c.errorf("People.Link: %v", err)
+	}
+	for _, p := range c.linked(b, "bob") {
+		if p.GroupID == other.ID {
+			c.errorf("People.GetByUsername returned a person of a group the user left")
+		}
+	}
+}
+
+// links checks linking users to people of the group.
+func (c *checker) links(b Backend, group string) {
+	alice, _ := b.People.GetOrCreateByName(group, "Alice")
+	bob, _ := b.People.GetOrCreateByName(group, "Bob")
+	if err := b.People.Link(group, alice.ID, "alice"); err != nil {
+		c.errorf("People.Link: %v", err)
+		return
+	}
+	if p, err := b.People.GetByID(group, alice.ID); err != nil || p.Username != "alice" {
+		c.errorf("People.GetByID after Link = %+v, %v; want username alice", p, err)
+	}
+	if got := c.linked(b, "alice"); len(got) != 1 || got[0].ID != alice.ID {
+		c.errorf("People.GetByUsername = %+v, want %s", got, alice.ID)
+	}
+
+	// A user is one person of the group: linking another moves the link.
+	if err := b.People.Link(group, bob.ID, "alice"); err != nil {
+		c.errorf("People.Link: %v", err)
+	}
+	if got := c.linked(b, "alice"); len(got) != 1 || got[0].ID != bob.ID {
+		c.errorf("People.GetByUsername after moving the link = %+v, want %s", got, bob.ID)
+	}
+	if p, _ := b.People.GetByID(group, alice.ID); p.Username != "" {
+		c.errorf("person kept the link after it moved: %+v", p)
+	}
+
+	if err := b.People.Link(group, bob.ID, "nobody"); !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("People.Link to a missing user = %v, want sql.ErrNoRows", err)
+	}
+	if err := b.People.Link(group, uuid.New().String(), "alice"); !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("People.Link of a missing person = %v, want sql.ErrNoRows", err)
+	}
+	if err := b.People.Link(group, bob.ID, ""); err != nil {
+		c.errorf("People.Link unlinking: %v", err)
+	}
+	if got := c.linked(b, "alice"); len(got) != 0 {
+		c.errorf("People.GetByUsername after unlinking = %+v, want none", got)
+	}
+	if err := b.People.Link(group, alice.ID, "alice"); err != nil {
+		c.errorf("People.Link: %v", err)
+	}
+	if m, err := b.Members.GetByPersonID(alice.ID); err != nil || len(m) == 0 || m[0].GroupID != group {
+		c.errorf("Members.GetByPersonID = %+v, %v; want memberships in group %s", m, err, group)
+	}
+}
+
+func (c *checker) linked(b Backend, username string) []repository.Person {
+	people, err := b.People.GetByUsername(username)
+	if err != nil {
+		c.errorf("People.GetByUsername: %v", err)
+	}
+	return people
+}
+
+func (c *checker) users(b Backend) {
+	u := &repository.User{ID: uuid.New().String(), Username: "alice", Password: "hash", Role: repository.RoleEditor}
+	if err := b.Users.Create(u); err != nil {
+		c.errorf("Users.Create: %v", err)
+		return
+	}
+	if err := b.Users.Create(&repository.User{ID: uuid.New().String(), Username: "alice", Password: "x"}); err == nil {
+		c.errorf("Users.Create accepted a duplicate username")
+	}
+	got, err := b.Users.GetByUsername("alice")
+	if err != nil || got == nil || *got != *u {
+		c.errorf("Users.GetByUsername = %+v, %v; want %+v", got, err, u)
+	}
+	if _, err := b.Users.GetByUsername("nobody"); err == nil {
+		c.errorf("Users.GetByUsername of a missing user returned no error")
+	}
+
+	if err := b.Users.Create(&repository.User{ID: uuid.New().String(), Username: "bob", Password: "x"}); err != nil {
+		c.errorf("Users.Create: %v", err)
+	}
+	if err := b.Users.SetRole("alice", repository.RoleAdmin); err != nil {
+		c.errorf("Users.SetRole: %v", err)
+	}
+	if err := b.Users.SetRole("nobody", repository.RoleAdmin); !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("Users.SetRole of a missing user = %v, want sql.ErrNoRows", err)
+	}
+	users, err := b.Users.GetAll()
+	var roles []string
+	for _, u := range users {
+		roles = append(roles, u.Username+":"+u.Role)
+	}
+	if want := []string{"alice:admin", "bob:viewer"}; err != nil || !slices.Equal(roles, want) {
+		c.errorf("Users.GetAll = %q, %v; want %q (users without a role are viewers)", roles, err, want)
+	}
+}
+
+// tokens rotates a refresh token, replays the old one and denies an access
+// token. It uses the user created by users.
+func (c *checker) tokens(b Backend) {
+	u, err := b.Users.GetByUsername("alice")
+	if err != nil {
+		c.errorf("Users.GetByUsername: %v", err)
+		return
+	}
+	now := time.Now().Truncate(time.Second)
+	first := repository.RefreshToken{ID: uuid.New().String(), UserID: u.ID, FamilyID: "f1", TokenHash: "h1",
+		ExpiresAt: now.Add(time.Hour), CreatedAt: now}
+	if err := b.Tokens.CreateRefreshToken(first); err != nil {
+		c.errorf("Tokens.CreateRefreshToken: %v", err)
+		return
+	}
+	got, err := b.Tokens.GetRefreshToken("h1")
+	if err != nil || got.ID != first.ID || got.Username != "alice" || got.RevokedAt != nil ||
+		!got.ExpiresAt.Equal(first.ExpiresAt) {
+		c.errorf("Tokens.GetRefreshToken = %+v, %v; want %+v", got, err, first)
+	}
+	if _, err := b.Tokens.GetRefreshToken("unknown"); !errors.Is(err, sql.ErrNoRows) {
+		c.errorf("Tokens.GetRefreshToken of an unknown token = %v, want sql.ErrNoRows", err)
+	}
+
+	second := first
+	second.ID, second.TokenHash = uuid.New().String(), "h2"
+	if err := b.Tokens.RotateRefreshToken(first.ID, second); err != nil {
+		c.errorf("Tokens.RotateRefreshToken: %v", err)
+	}
+	third := first
+	third.ID, third.TokenHash = uuid.New().String(), "h3"
+	if err := b.Tokens.RotateRefreshToken(first.ID, third); !errors.Is(err, repository.ErrTokenReused) {
+		c.errorf("rotating a rotated token = %v, want ErrTokenReused", err)
+	}
+	if _, err := b.Tokens.GetRefreshToken("h3"); err == nil {
+		c.errorf("a token rotated from a reused one was stored")
+	}
+	if got, _ := b.Tokens.GetRefreshToken("h1"); got.RevokedAt == nil {
+		c.errorf("rotated token was not revoked")
+	}
+	if err := b.Tokens.RevokeFamily("f1"); err != nil {
+		c.errorf("Tokens.RevokeFamily: %v", err)
+	}
+	if got, _ := b.Tokens.GetRefreshToken("h2"); got.RevokedAt == nil {
+		c.errorf("Tokens.RevokeFamily left %+v live", got)
+	}
+
+	if err := b.Tokens.Deny("jti-1", now.Add(time.Hour)); err != nil {
+		c.errorf("Tokens.Deny: %v", err)
+	}
+	if err := b.Tokens.Deny("jti-1", now.Add(time.Hour)); err != nil {
+		c.errorf("Tokens.Deny twice: %v", err)
+	}
+	// Concurrent logouts with the same access token deny it at once.
+	errs := make(chan error, 8)
+	for range cap(errs) {
+		go func() { errs <- b.Tokens.Deny("jti-3", now.Add(time.Hour)) }()
+	}
+	for range cap(errs) {
+		if err := <-errs; err != nil {
+			c.errorf("concurrent Tokens.Deny: %v", err)
+		}
+	}
+	if denied, err := b.Tokens.IsDenied("jti-1"); err != nil || !denied {
+		c.errorf("Tokens.IsDenied(jti-1) = %v, %v; want true", denied, err)
+	}
+	if denied, err := b.Tokens.IsDenied("jti-2"); err != nil || denied {
+		c.errorf("Tokens.IsDenied(jti-2) = %v, %v; want false", denied, err)
+	}
+
+	if err := b.Tokens.PruneExpired(now.Add(2 * time.Hour)); err != nil {
+		c.errorf("Tokens.PruneExpired: %v", err)
+	}
+	if denied, _ := b.Tokens.IsDenied("jti-1"); denied {
+		c.errorf("expired denylist entry survived PruneExpired")
+	}
+	if _, err := b.Tokens.GetRefreshToken("h2"); err == nil {
+		c.errorf("expired refresh token survived PruneExpired")
+	}
+}
+
+func (c *checker) logs(b Backend) {
+	start := time.Date(2099, 1, 1, 8, 0, 0, 0, time.UTC)
+	entries := []repository.UserLog{
+		{Username: "alice", Method: "GET", Path: "/blocks", Status: 200, CreatedAt: start},
+		{Username: "alice", Method: "POST", Path: "/blocks/2099-01/transactions", Status: 200,
+			CreatedAt: start.Add(time.Hour)},
+		{Username: "bob", Method: "POST", Path: "/blocks/2099-01/transactions", Status: 400,
+			CreatedAt: start.Add(time.Hour)},
+		{Username: "bob", Method: "DELETE", Path: "/transactions/1", Status: 403, CreatedAt: start.Add(2 * time.Hour)},
+		{Username: "alice", Method: "GET", Path: "/logs", Status: 200, IPAddress: "127.0.0.1", UserAgent: "test",
+			Body: `{"password":"[REDACTED]"}`, DurationMs: 12, CreatedAt: start.Add(3 * time.Hour)},
+	}
+	for _, e := range entries[:2] {
+		if err := b.Logs.Write(e); err != nil {
+			c.errorf("Logs.Write: %v", err)
+			return
+		}
+	}
+	if err := b.Logs.WriteBatch(entries[2:]); err != nil {
+		c.errorf("Logs.WriteBatch: %v", err)
+		return
+	}
+	if page, err := b.Logs.List(repository.LogFilter{Limit: 1}); err != nil || len(page.Logs) != 1 {
+		c.errorf("Logs.List = %+v, %v", page, err)
+	} else if got, want := page.Logs[0], entries[4]; got.IPAddress != want.IPAddress ||
+		got.UserAgent != want.UserAgent || got.Body != want.Body || got.DurationMs != want.DurationMs ||
+		!got.CreatedAt.Equal(want.CreatedAt) {
+		c.errorf("newest log entry = %+v, want %+v", got, want)
+	}
+
+	// all follows the cursors to the end and returns the paths and statuses
+	// in page order.
+	all := func(f repository.LogFilter) []string {
+		f.Limit = 2
+		var got []string
+		for range len(entries) + 1 {
+			page, err := b.Logs.List(f)
+			if err != nil {
+				c.errorf("Logs.List(%+v): %v", f, err)
+				return nil
+			}
+			for _, l := range page.Logs {
+				if l.ID == "" || l.CreatedAt.IsZero() {
+					c.errorf("log entry %+v: missing id or time", l)
+				}
+				got = append(got, l.Method+" "+strconv.Itoa(l.Status))
+			}
+			if page.NextCursor == "" {
+				return got
+			}
+			f.Cursor = page.NextCursor
+		}
+		c.errorf("Logs.List kept returning a next cursor")
+		return got
+	}
+
+	tests := []struct {
+		name   string
+		filter repository.LogFilter
+		want   []string
+	}{
+		{"newest first", repository.LogFilter{}, []string{"GET 200", "DELETE 403", "POST 400", "POST 200", "GET 200"}},
+		{"username", repository.LogFilter{Username: "bob"}, []string{"DELETE 403", "POST 400"}},
+		{"method", repository.LogFilter{Method: "post"}, []string{"POST 400", "POST 200"}},
+		{"path prefix", repository.LogFilter{PathPrefix: "/blocks/"}, []string{"POST 400", "POST 200"}},
+		{"path prefix is literal", repository.LogFilter{PathPrefix: "/block_"}, nil},
+		{"status", repository.LogFilter{Status: 200}, []string{"GET 200", "POST 200", "GET 200"}},
+		{"time window", repository.LogFilter{From: start.Add(time.Hour), To: start.Add(3 * time.Hour)},
+			[]string{"DELETE 403", "POST 400", "POST 200"}},
+	}
+	for _, tt := range tests {
+		if got := all(tt.filter); !slices.Equal(got, tt.want) {
+			c.errorf("Logs.List %s = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if _, err := b.Logs.List(repository.LogFilter{Limit: 2, Cursor: "%%"}); err == nil {
+		c.errorf("Logs.List accepted a malformed cursor")
+	}
+
+	if n, err := b.Logs.Prune(start.Add(time.Hour), true); err != nil || n != 1 {
+		c.errorf("Logs.Prune = %d, %v; want 1", n, err)
+	}
+	if n, err := b.Logs.Prune(start.Add(2*time.Hour), false); err != nil || n != 2 {
+		c.errorf("Logs.Prune = %d, %v; want 2", n, err)
+	}
+	if got := all(repository.LogFilter{}); !slices.Equal(got, []string{"GET 200", "DELETE 403"}) {
+		c.errorf("Logs.List after Prune = %q", got)
+	}
+}
+
+// chains verifies the ledger and audit chains written by the other checks,
+// which include pruning the log.
+func (c *checker) chains(b Backend) {
+	for _, verify := range []func() (repository.ChainReport, error){b.Ledger.Verify, b.Logs.Verify} {
+		report, err := verify()
+		if err != nil {
+			c.errorf("Verify: %v", err)
+			continue
+		}
+		if report.Broken != nil || report.Entries == 0 || report.Head == "" {
+			c.errorf("Verify %s = %+v, broken %+v; want an intact chain", report.Chain, report, report.Broken)
+		}
+	}
+}
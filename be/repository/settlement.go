@@ -0,0 +1,50 @@
+package repository
+
+type SettlementRepository struct {
+	DB DBTX
+}
+
+func NewSettlementRepository(db DBTX) *SettlementRepository {
+	return &SettlementRepository{DB: db}
+}
+
+func (r *SettlementRepository) Add(s Settlement) error {
+	_, err := r.DB.Exec(`
+		INSERT INTO settlements (id, block_id, payer, payee, amount, currency, note, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, s.ID, s.BlockID, s.Payer, s.Payee, s.Amount.Amount, currencyOrDefault(s.Amount.Currency), s.Note, s.CreatedAt)
+	return err
+}
+
+func (r *SettlementRepository) GetByID(id string) (Settlement, error) {
+	var s Settlement
+	err := r.DB.QueryRow(`SELECT id, block_id, payer, payee, amount, currency, note, created_at
+       FROM settlements WHERE id = $1`, id).
+		Scan(&s.ID, &s.BlockID, &s.Payer, &s.Payee, &s.Amount.Amount, &s.Amount.Currency, &s.Note, &s.CreatedAt)
+	return s, err
+}
+
+func (r *SettlementRepository) GetByBlockID(blockID string) ([]Settlement, error) {
+	rows, err := r.DB.Query(`SELECT id, block_id, payer, payee, amount, currency, note, created_at
+       FROM settlements WHERE block_id = $1 ORDER BY created_at DESC`, blockID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var settlements []Settlement
+	for rows.Next() {
+		var s Settlement
+		if err := rows.Scan(&s.ID, &s.BlockID, &s.Payer, &s.Payee, &s.Amount.Amount, &s.Amount.Currency,
+			&s.Note, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		settlements = append(settlements, s)
+	}
+	return settlements, nil
+}
+
+func (r *SettlementRepository) Delete(id string) error {
+	_, err := r.DB.Exec(`DELETE FROM settlements WHERE id = $1`, id)
+	return err
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+// TieBreak decides who receives a leftover minor unit when two members have
+// the same fractional remainder.
+type TieBreak int
+
+const (
+	// TieBreakPayer lets the payer absorb the leftover units first.
+	TieBreakPayer TieBreak = iota
+	// TieBreakLargestShare gives leftover units to the largest weight first.
+	TieBreakLargestShare
+)
+
+func ParseTieBreak(s string) (TieBreak, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "", "payer":
+		return TieBreakPayer, nil
+	case "largest", "largest_share":
+		return TieBreakLargestShare, nil
+	}
+	return 0, fmt.Errorf("unknown tie break %q", s)
+}
+
+var ErrZeroWeight = errors.New("participants weight must be > 0")
+
+// Allocator splits an amount across members by weight using the
+// largest-remainder method, so the shares always add up to the amount.
+type Allocator struct {
+	TieBreak TieBreak
+}
+
+func NewAllocator(tb TieBreak) Allocator {
+	return Allocator{TieBreak: tb}
+}
+
+type allocation struct {
+	memberID string
+	weight   *big.Rat
+	share    int64
+	rem      *big.Rat
+}
+
+// Split returns each member's share of amount. Every member gets the floor of
+// its exact quota; the units left over go one by one to the largest
+// fractional remainders, ties broken by a.TieBreak and then by member ID.
+func (a Allocator) Split(amount Money, weights map[string]float64, payer string) (map[string]Money, error) {
+	total := new(big.Rat)
+	allocs := make([]*allocation, 0, len(weights))
+	for memberID, w := range weights {
+		if w < 0 {
+			return nil, fmt.Errorf("weight of %s must not be negative", memberID)
+		}
+		r := new(big.Rat)
+		if r.SetFloat64(w) == nil {
+			return nil, fmt.Errorf("weight of %s is not a finite number", memberID)
+		}
+		total.Add(total, r)
+		allocs = append(allocs, &allocation{memberID: memberID, weight: r})
+	}
+	if total.Sign() == 0 {
+		return nil, ErrZeroWeight
+	}
+
+	// Work on the magnitude so floors round toward zero for refunds too.
+	abs := amount.Amount
+	sign := int64(1)
+	if abs < 0 {
+		abs, sign = -abs, -1
+	}
+	absRat := new(big.Rat).SetInt64(abs)
+
+	var allocated int64
+	for _, al := range allocs {
+		quota := new(big.Rat).Mul(absRat, al.weight)
+		quota.Quo(quota, total)
+		floor := new(big.Int).Quo(quota.Num(), quota.Denom())
+		al.share = floor.Int64()
+		al.rem = quota.Sub(quota, new(big.Rat).SetInt(floor))
+		allocated += al.share
+	}
+
+	sort.Slice(allocs, func(i, j int) bool {
+		x, y := allocs[i], allocs[j]
+		if c := x.rem.Cmp(y.rem); c != 0 {
+			return c > 0
+		}
+		switch a.TieBreak {
+		case TieBreakPayer:
+			if (x.memberID == payer) != (y.memberID == payer) {
+				return x.memberID == payer
+			}
+		case TieBreakLargestShare:
+			if c := x.weight.Cmp(y.weight); c != 0 {
+				return c > 0
+			}
+		}
+		return x.memberID < y.memberID
+	})
+
+	for i := int64(0); i < abs-allocated; i++ {
+		allocs[i].share++
+	}
+
+	shares := make(map[string]Money, len(allocs))
+	for _, al := range allocs {
+		shares[al.memberID] = NewMoney(sign*al.share, amount.Currency)
+	}
+	return shares, nil
+}
+
+// DebtDeltas returns how a transaction moves each member's debt: the payer is
+// credited the full amount and every participant is charged their share.
+func DebtDeltas(amount Money, payer string, details map[string]Money) map[string]Money {
+	deltas := make(map[string]Money, len(details)+1)
+	deltas[payer] = amount
+	for memberID, share := range details {
+		d := deltas[memberID]
+		d.Amount -= share.Amount
+		d.Currency = amount.Currency
+		deltas[memberID] = d
+	}
+	return deltas
+}
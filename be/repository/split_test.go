@@ -0,0 +1,218 @@
+package repository_test
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"math/big"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+
+	"my-source/sheet-payment/be/repository"
+)
+
+// splitCase is a random split: an amount, which may be negative or zero, and
+// up to eight weights, some of them zero but not all.
+type splitCase struct {
+	Amount  int64
+	Weights map[string]float64
+	Payer   string
+}
+
+func (splitCase) Generate(r *rand.Rand, _ int) reflect.Value {
+	c := splitCase{Amount: r.Int63n(2_000_000_001) - 1_000_000_000, Weights: map[string]float64{}}
+	switch r.Intn(4) {
+	case 0:
+		c.Amount = 0
+	case 1:
+		c.Amount = int64(r.Intn(21) - 10)
+	}
+	n := 1 + r.Intn(8)
+	for i := range n {
+		var w float64
+		switch r.Intn(4) {
+		case 0:
+			w = 0
+		case 1:
+			w = float64(1 + r.Intn(5))
+		default:
+			w = r.Float64() * 100
+		}
+		c.Weights[fmt.Sprintf("m%d", i)] = w
+	}
+	c.Weights[fmt.Sprintf("m%d", r.Intn(n))] = 1 + r.Float64()
+	c.Payer = fmt.Sprintf("m%d", r.Intn(n+1))
+	return reflect.ValueOf(c)
+}
+
+func quickCheck(t *testing.T, property func(c splitCase) bool) {
+	t.Helper()
+	if err := quick.Check(property, &quick.Config{MaxCount: 2000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func allocators() map[string]repository.Allocator {
+	return map[string]repository.Allocator{
+		"payer":   repository.NewAllocator(repository.TieBreakPayer),
+		"largest": repository.NewAllocator(repository.TieBreakLargestShare),
+	}
+}
+
+func TestSplitProperties(t *testing.T) {
+	for name, a := range allocators() {
+		t.Run(name+"/sums to the amount", func(t *testing.T) {
+			quickCheck(t, func(c splitCase) bool {
+				shares, err := a.Split(repository.NewMoney(c.Amount, "USD"), c.Weights, c.Payer)
+				if err != nil || len(shares) != len(c.Weights) {
+					t.Logf("Split(%+v) = %v, %v", c, shares, err)
+					return false
+				}
+				var sum int64
+				for _, s := range shares {
+					sum += s.Amount
+				}
+				return sum == c.Amount
+			})
+		})
+
+		t.Run(name+"/within one unit of the quota", func(t *testing.T) {
+			quickCheck(t, func(c splitCase) bool {
+				shares, err := a.Split(repository.NewMoney(c.Amount, "USD"), c.Weights, c.Payer)
+				if err != nil {
+					return false
+				}
+				total := new(big.Rat)
+				for _, w := range c.Weights {
+					total.Add(total, new(big.Rat).SetFloat64(w))
+				}
+				one := big.NewRat(1, 1)
+				for id, w := range c.Weights {
+					quota := new(big.Rat).Mul(big.NewRat(c.Amount, 1), new(big.Rat).SetFloat64(w))
+					quota.Quo(quota, total)
+					diff := new(big.Rat).Sub(big.NewRat(shares[id].Amount, 1), quota)
+					if diff.Abs(diff).Cmp(one) >= 0 {
+						t.Logf("share of %s = %d, quota %s", id, shares[id].Amount, quota.FloatString(4))
+						return false
+					}
+				}
+				return true
+			})
+		})
+
+		t.Run(name+"/deterministic", func(t *testing.T) {
+			quickCheck(t, func(c splitCase) bool {
+				want, err := a.Split(repository.NewMoney(c.Amount, "USD"), c.Weights, c.Payer)
+				if err != nil {
+					return false
+				}
+				// Map iteration order changes between calls and between maps
+				// built in a different order.
+				for range 5 {
+					weights := make(map[string]float64, len(c.Weights))
+					keys := make([]string, 0, len(c.Weights))
+					for id := range c.Weights {
+						keys = append(keys, id)
+					}
+					for i := len(keys) - 1; i >= 0; i-- {
+						weights[keys[i]] = c.Weights[keys[i]]
+					}
+					got, err := a.Split(repository.NewMoney(c.Amount, "USD"), weights, c.Payer)
+					if err != nil || !maps.Equal(got, want) {
+						return false
+					}
+				}
+				return true
+			})
+		})
+	}
+
+	t.Run("debt deltas balance", func(t *testing.T) {
+		a := repository.NewAllocator(repository.TieBreakPayer)
+		quickCheck(t, func(c splitCase) bool {
+			amount := repository.NewMoney(c.Amount, "USD")
+			shares, err := a.Split(amount, c.Weights, c.Payer)
+			if err != nil {
+				return false
+			}
+			deltas := repository.DebtDeltas(amount, c.Payer, shares)
+			var sum int64
+			for _, d := range deltas {
+				sum += d.Amount
+			}
+			return sum == 0 && deltas[c.Payer].Amount == c.Amount-shares[c.Payer].Amount
+		})
+	})
+}
+
+func TestSplitTieBreak(t *testing.T) {
+	tests := []struct {
+		name     string
+		tieBreak repository.TieBreak
+		amount   int64
+		weights  map[string]float64
+		payer    string
+		want     map[string]int64
+	}{
+		{"payer absorbs the leftover", repository.TieBreakPayer, 100,
+			map[string]float64{"a": 1, "b": 1, "c": 1}, "b", map[string]int64{"a": 33, "b": 34, "c": 33}},
+		{"payer refunded the leftover", repository.TieBreakPayer, -100,
+			map[string]float64{"a": 1, "b": 1, "c": 1}, "c", map[string]int64{"a": -33, "b": -33, "c": -34}},
+		{"payer not sharing falls back to member ID", repository.TieBreakPayer, 100,
+			map[string]float64{"a": 1, "b": 1, "c": 1}, "z", map[string]int64{"a": 34, "b": 33, "c": 33}},
+		// Quotas 0.5 and 2.5 tie on their remainder.
+		{"payer before a larger weight", repository.TieBreakPayer, 3,
+			map[string]float64{"a": 1, "b": 5}, "a", map[string]int64{"a": 1, "b": 2}},
+		{"larger weight before the payer", repository.TieBreakLargestShare, 3,
+			map[string]float64{"a": 1, "b": 5}, "a", map[string]int64{"a": 0, "b": 3}},
+		{"equal weights fall back to member ID", repository.TieBreakLargestShare, 100,
+			map[string]float64{"a": 1, "b": 1, "c": 1}, "c", map[string]int64{"a": 34, "b": 33, "c": 33}},
+		{"larger remainder wins over both", repository.TieBreakPayer, 2,
+			map[string]float64{"a": 1, "b": 2}, "a", map[string]int64{"a": 1, "b": 1}},
+		{"zero amount", repository.TieBreakPayer, 0,
+			map[string]float64{"a": 1, "b": 2}, "a", map[string]int64{"a": 0, "b": 0}},
+		{"zero weight gets nothing", repository.TieBreakPayer, 101,
+			map[string]float64{"a": 1, "b": 0, "c": 1}, "b", map[string]int64{"a": 51, "b": 0, "c": 50}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shares, err := repository.NewAllocator(tt.tieBreak).Split(repository.NewMoney(tt.amount, "USD"),
+				tt.weights, tt.payer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]int64{}
+			for id, s := range shares {
+				got[id] = s.Amount
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("Split = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitRejectsWeights(t *testing.T) {
+	a := repository.NewAllocator(repository.TieBreakPayer)
+	tests := map[string]map[string]float64{
+		"no weights":      {},
+		"all zero":        {"a": 0, "b": 0},
+		"negative":        {"a": 1, "b": -1},
+		"not a number":    {"a": math.NaN()},
+		"infinite weight": {"a": math.Inf(1)},
+	}
+	for name, weights := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := a.Split(repository.NewMoney(100, "USD"), weights, "a"); err == nil {
+				t.Errorf("Split(%v) succeeded", weights)
+			}
+		})
+	}
+	if _, err := a.Split(repository.NewMoney(100, "USD"), map[string]float64{"a": 0}, "a"); !errors.Is(err,
+		repository.ErrZeroWeight) {
+		t.Errorf("Split with zero weights = %v, want ErrZeroWeight", err)
+	}
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrTokenReused means a refresh token was presented after it had already
+// been rotated or revoked.
+var ErrTokenReused = errors.New("refresh token already used")
+
+// RefreshToken is a stored refresh token. Only the SHA-256 hash of the token
+// is kept; Username is read from the user's row.
+type RefreshToken struct {
+	ID        string
+	UserID    string
+	Username  string
+	FamilyID  string
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+	RevokedAt *time.Time
+}
+
+type TokenRepository struct {
+	DB DBTX
+}
+
+func NewTokenRepository(db DBTX) *TokenRepository {
+	return &TokenRepository{DB: db}
+}
+
+func (r *TokenRepository) CreateRefreshToken(t RefreshToken) error {
+	_, err := r.DB.Exec(`INSERT INTO refresh_tokens (id, user_id, family_id, token_hash, expires_at, created_at)
+       VALUES ($1, $2, $3, $4, $5, $6)`,
+		t.ID, t.UserID, t.FamilyID, t.TokenHash, t.ExpiresAt.UTC(), t.CreatedAt.UTC())
+	return err
+}
+
+// GetRefreshToken finds a token by its hash, revoked or not. It returns
+// sql.ErrNoRows for an unknown token.
+func (r *TokenRepository) GetRefreshToken(hash string) (RefreshToken, error) {
+	var t RefreshToken
+	var revokedAt sql.NullTime
+	err := r.DB.QueryRow(`SELECT rt.id, rt.user_id, u.username, rt.family_id, rt.token_hash, rt.expires_at,
+       rt.created_at, rt.revoked_at
+       FROM refresh_tokens rt JOIN users u ON u.id = rt.user_id
+       WHERE rt.token_hash = $1`, hash).Scan(&t.ID, &t.UserID, &t.Username, &t.FamilyID, &t.TokenHash,
+		&t.ExpiresAt, &t.CreatedAt, &revokedAt)
+	if revokedAt.Valid {
+		t.RevokedAt = &revokedAt.Time
+	}
+	return t, err
+}
+
+// RotateRefreshToken revokes the token oldID and stores next in its place.
+// It returns ErrTokenReused when oldID was already revoked, so of two
+// requests racing with the same token only one gets a new one.
+func (r *TokenRepository) RotateRefreshToken(oldID string, next RefreshToken) error {
+	return inTx(r.DB, func(q DBTX) error {
+		res, err := q.Exec(`UPDATE refresh_tokens SET revoked_at = $1 WHERE id = $2 AND revoked_at IS NULL`,
+			time.Now().UTC(), oldID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil {
+			return err
+		} else if n == 0 {
+			return ErrTokenReused
+		}
+		return NewTokenRepository(q).CreateRefreshToken(next)
+	})
+}
+
+// RevokeFamily revokes every token rotated from the same login.
+func (r *TokenRepository) RevokeFamily(familyID string) error {
+	_, err := r.DB.Exec(`UPDATE refresh_tokens SET revoked_at = $1 WHERE family_id = $2 AND revoked_at IS NULL`,
+		time.Now().UTC(), familyID)
+	return err
+}
+
+// RevokeUserTokens revokes every refresh token of the user.
+func (r *TokenRepository) RevokeUserTokens(userID string) error {
+	_, err := r.DB.Exec(`UPDATE refresh_tokens SET revoked_at = $1 WHERE user_id = $2 AND revoked_at IS NULL`,
+		time.Now().UTC(), userID)
+	return err
+}
+
+// Deny adds an access token to the denylist until it expires. Denying a
+// token twice, as two concurrent logouts may, keeps the first entry.
+func (r *TokenRepository) Deny(jti string, expiresAt time.Time) error {
+	_, err := r.DB.Exec(`INSERT INTO revoked_tokens (jti, expires_at) VALUES ($1, $2) ON CONFLICT (jti) DO NOTHING`,
+		jti, expiresAt.UTC())
+	return err
+}
+
+func (r *TokenRepository) IsDenied(jti string) (bool, error) {
+	var denied bool
+	err := r.DB.QueryRow(`SELECT EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1)`, jti).Scan(&denied)
+	return denied, err
+}
+
+// PruneExpired drops refresh tokens and denylist entries that expired
+// before now; an expired token is rejected without them.
+func (r *TokenRepository) PruneExpired(now time.Time) error {
+	if _, err := r.DB.Exec(`DELETE FROM refresh_tokens WHERE expires_at < $1`, now.UTC()); err != nil {
+		return err
+	}
+	_, err := r.DB.Exec(`DELETE FROM revoked_tokens WHERE expires_at < $1`, now.UTC())
+	return err
+}
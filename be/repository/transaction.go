@@ -1,21 +1,26 @@
 package repository
 
 import (
-	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strconv"
+	"strings"
 )
 
 type TransactionRepository struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func NewTransactionRepository(db *sql.DB) *TransactionRepository {
+func NewTransactionRepository(db DBTX) *TransactionRepository {
 	return &TransactionRepository{DB: db}
 }
 
-func (r *TransactionRepository) GetByBlockID(blockID string) ([]Transaction, error) {
-	rows, err := r.DB.Query(`SELECT id, description, amount, payer, created_at, ratios FROM transactions WHERE block_id = $1`, blockID)
+const transactionSelect = `SELECT t.id, t.block_id, t.description, t.amount, t.currency, t.payer, t.created_at,
+       t.created_by, t.ratios, t.split_mode, t.split, t.original_amount, t.original_currency, t.fx_rate
+       FROM transactions t`
+
+func (r *TransactionRepository) query(query string, args ...any) ([]Transaction, error) {
+	rows, err := r.DB.Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -24,39 +29,168 @@ func (r *TransactionRepository) GetByBlockID(blockID string) ([]Transaction, err
 	var txs []Transaction
 	for rows.Next() {
 		var tx Transaction
-		var ratiosJSON []byte
+		var ratiosJSON, splitJSON []byte
 
-		tx.BlockID = blockID
-		tx.Details = map[string]float64{}
+		tx.Details = map[string]Money{}
 		tx.Ratios = map[string]float64{}
 
-		err := rows.Scan(&tx.ID, &tx.Description, &tx.Amount, &tx.Payer, &tx.CreatedAt, &ratiosJSON)
+		var fxRate string
+		err := rows.Scan(&tx.ID, &tx.BlockID, &tx.Description, &tx.Amount.Amount, &tx.Amount.Currency, &tx.Payer,
+			&tx.CreatedAt, &tx.CreatedBy, &ratiosJSON, &tx.SplitMode, &splitJSON, &tx.OriginalAmount.Amount, &tx.OriginalCurrency,
+			&fxRate)
 		if err != nil {
 			return nil, err
 		}
+		tx.OriginalAmount.Currency = tx.OriginalCurrency
+		tx.FXRate = json.Number(fxRate)
 		if err := json.Unmarshal(ratiosJSON, &tx.Ratios); err != nil {
 			return nil, err
 		}
-
-		// Query details
-		detailRows, err := r.DB.Query(`SELECT member_id, amount FROM transaction_details WHERE transaction_id = $1`, tx.ID)
-		if err != nil {
+		if tx.Split, err = unmarshalSplit(splitJSON); err != nil {
 			return nil, err
 		}
-		for detailRows.Next() {
-			var memberID string
-			var amount float64
-			if err := detailRows.Scan(&memberID, &amount); err != nil {
-				detailRows.Close()
-				return nil, err
-			}
-			tx.Details[memberID] = amount
-		}
-		detailRows.Close()
 
 		txs = append(txs, tx)
 	}
-	return txs, nil
+	return txs, rows.Err()
+}
+
+// loadDetails fills in the details of txs from a query returning
+// (transaction_id, member_id, amount) rows, so a whole list costs one query.
+func (r *TransactionRepository) loadDetails(txs []Transaction, query string, args ...any) error {
+	byID := make(map[string]*Transaction, len(txs))
+	for i := range txs {
+		byID[txs[i].ID] = &txs[i]
+	}
+
+	rows, err := r.DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var txID, memberID string
+		var amount int64
+		if err := rows.Scan(&txID, &memberID, &amount); err != nil {
+			return err
+		}
+		if tx, ok := byID[txID]; ok {
+			tx.Details[memberID] = NewMoney(amount, tx.Amount.Currency)
+		}
+	}
+	return rows.Err()
+}
+
+// GetByBlockID returns the block's transactions, oldest first, with their
+// details. The details of the whole block are read with one more query
+// rather than one per transaction.
+func (r *TransactionRepository) GetByBlockID(blockID string) ([]Transaction, error) {
+	txs, err := r.query(transactionSelect+` WHERE t.block_id = $1 ORDER BY t.created_at, t.id`, blockID)
+	if err != nil {
+		return nil, err
+	}
+	err = r.loadDetails(txs, `SELECT td.transaction_id, td.member_id, td.amount FROM transaction_details td
+       JOIN transactions t ON t.id = td.transaction_id WHERE t.block_id = $1`, blockID)
+	return txs, err
+}
+
+// List returns one page of the transactions matching filter, with the total
+// count of matches. Filtering, ordering and paging all run in SQL.
+func (r *TransactionRepository) List(filter TransactionFilter) (TransactionPage, error) {
+	page := TransactionPage{Transactions: []Transaction{}}
+
+	w := &where{}
+	if filter.BlockID != "" {
+		w.add(`t.block_id = ` + w.arg(filter.BlockID))
+	}
+	if filter.Members != nil {
+		if len(filter.Members) == 0 {
+			return page, nil
+		}
+		in := make([]string, len(filter.Members))
+		for i, id := range filter.Members {
+			in[i] = w.arg(id)
+		}
+		list := strings.Join(in, ", ")
+		w.add(`(t.payer IN (` + list + `) OR EXISTS (SELECT 1 FROM transaction_details td
+           WHERE td.transaction_id = t.id AND td.member_id IN (` + list + `)))`)
+	}
+	if filter.Payer != "" {
+		w.add(`t.payer = ` + w.arg(filter.Payer))
+	}
+	if filter.Participant != "" {
+		w.add(`EXISTS (SELECT 1 FROM transaction_details td WHERE td.transaction_id = t.id AND td.member_id = ` +
+			w.arg(filter.Participant) + `)`)
+	}
+	if filter.MinAmount != nil {
+		w.add(`t.amount >= ` + w.arg(*filter.MinAmount))
+	}
+	if filter.MaxAmount != nil {
+		w.add(`t.amount <= ` + w.arg(*filter.MaxAmount))
+	}
+	if !filter.From.IsZero() {
+		w.add(`t.created_at >= ` + w.arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		w.add(`t.created_at < ` + w.arg(filter.To))
+	}
+	// Postgres searches the words of the description, using the GIN index on
+	// the same expression. SQLite has no full-text search without an
+	// extension, so it falls back to a substring match per word.
+	if strings.TrimSpace(filter.Search) != "" && !isSQLite(r.DB) {
+		w.add(`to_tsvector('simple', COALESCE(t.description, '')) @@ plainto_tsquery('simple', ` +
+			w.arg(filter.Search) + `)`)
+	} else {
+		for _, word := range strings.Fields(filter.Search) {
+			w.add(`LOWER(t.description) LIKE ` + w.arg("%"+escapeLike(strings.ToLower(word))+"%") + ` ESCAPE '\'`)
+		}
+	}
+
+	if err := r.DB.QueryRow(`SELECT COUNT(*) FROM transactions t `+w.String(), w.args...).Scan(&page.Total); err != nil {
+		return page, err
+	}
+
+	order, before := `DESC`, `<`
+	if filter.Sort == SortOldest {
+		order, before = `ASC`, `>`
+	}
+	if filter.Cursor != "" {
+		createdAt, id, err := DecodeCursor(filter.Cursor)
+		if err != nil {
+			return page, err
+		}
+		w.add(`(t.created_at, t.id) ` + before + ` (` + w.arg(createdAt) + `, ` + w.arg(id) + `)`)
+	}
+
+	// Read one row past the page to know whether another page follows.
+	txs, err := r.query(transactionSelect+` `+w.String()+` ORDER BY t.created_at `+order+`, t.id `+order+
+		` LIMIT `+strconv.Itoa(filter.Limit+1), w.args...)
+	if err != nil {
+		return page, err
+	}
+	if len(txs) > filter.Limit {
+		txs = txs[:filter.Limit]
+		last := txs[len(txs)-1]
+		page.NextCursor = EncodeCursor(last.CreatedAt, last.ID)
+	}
+	if len(txs) == 0 {
+		return page, nil
+	}
+
+	ids := &where{}
+	placeholders := make([]string, len(txs))
+	for i, tx := range txs {
+		placeholders[i] = ids.arg(tx.ID)
+	}
+	err = r.loadDetails(txs, `SELECT transaction_id, member_id, amount FROM transaction_details
+       WHERE transaction_id IN (`+strings.Join(placeholders, ", ")+`)`, ids.args...)
+	page.Transactions = txs
+	return page, err
+}
+
+// escapeLike makes % and _ in s match literally in a LIKE pattern.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
 }
 
 func (r *TransactionRepository) Add(tx Transaction) error {
@@ -64,16 +198,23 @@ func (r *TransactionRepository) Add(tx Transaction) error {
 	if err != nil {
 		return err
 	}
+	splitJSON, err := marshalSplit(tx.Split)
+	if err != nil {
+		return err
+	}
 
 	_, err = r.DB.Exec(`
-		INSERT INTO transactions (id, block_id, payer, amount, description, created_at, ratios)
-		VALUES ($1, $2, $3, $4, $5, $6, $7)
-	`, tx.ID, tx.BlockID, tx.Payer, tx.Amount, tx.Description, tx.CreatedAt, ratiosJSON)
+		INSERT INTO transactions (id, block_id, payer, amount, currency, description, created_at, created_by, ratios,
+			split_mode, split, original_amount, original_currency, fx_rate)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+	`, tx.ID, tx.BlockID, tx.Payer, tx.Amount.Amount, currencyOrDefault(tx.Amount.Currency), tx.Description, tx.CreatedAt,
+		tx.CreatedBy, ratiosJSON, splitModeOrDefault(tx.SplitMode), splitJSON,
+		tx.OriginalAmount.Amount, currencyOrDefault(tx.OriginalAmount.Currency), rateOrOne(tx.FXRate))
 
 	return err
 }
 
-func (r *TransactionRepository) AddDetails(txID string, details map[string]float64) error {
+func (r *TransactionRepository) AddDetails(txID string, details map[string]Money) error {
 	stmt, err := r.DB.Prepare(`
 		INSERT INTO transaction_details (transaction_id, member_id, amount)
 		VALUES ($1, $2, $3)
@@ -84,37 +225,46 @@ func (r *TransactionRepository) AddDetails(txID string, details map[string]float
 	defer stmt.Close()
 
 	for memberID, amount := range details {
-		if _, err := stmt.Exec(txID, memberID, amount); err != nil {
+		if _, err := stmt.Exec(txID, memberID, amount.Amount); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
-func (r *TransactionRepository) GetByID(id string) (Transaction, error) {
+// GetByID returns the transaction when it belongs to a block of the group.
+func (r *TransactionRepository) GetByID(groupID, id string) (Transaction, error) {
 	var tx Transaction
-	var ratiosJson []byte
-	err := r.DB.QueryRow(`SELECT id, block_id, payer, amount, 
-       description, created_at, ratios FROM transactions WHERE id = $1`, id).
-		Scan(&tx.ID, &tx.BlockID, &tx.Payer, &tx.Amount, &tx.Description, &tx.CreatedAt, &ratiosJson)
+	var ratiosJson, splitJSON []byte
+	var fxRate string
+	err := r.DB.QueryRow(`SELECT t.id, t.block_id, t.payer, t.amount, t.currency,
+       t.description, t.created_at, t.created_by, t.ratios, t.split_mode, t.split, t.original_amount, t.original_currency, t.fx_rate
+       FROM transactions t JOIN blocks b ON b.id = t.block_id
+       WHERE b.group_id = $1 AND t.id = $2`, groupID, id).
+		Scan(&tx.ID, &tx.BlockID, &tx.Payer, &tx.Amount.Amount, &tx.Amount.Currency, &tx.Description, &tx.CreatedAt,
+			&tx.CreatedBy, &ratiosJson, &tx.SplitMode, &splitJSON, &tx.OriginalAmount.Amount, &tx.OriginalCurrency, &fxRate)
 	if err != nil {
 		return tx, err
 	}
+	tx.OriginalAmount.Currency = tx.OriginalCurrency
+	tx.FXRate = json.Number(fxRate)
 	_ = json.Unmarshal(ratiosJson, &tx.Ratios)
-	return tx, nil
+	tx.Split, err = unmarshalSplit(splitJSON)
+	return tx, err
 }
 
-func (r *TransactionRepository) GetDetails(id string) (map[string]float64, error) {
-	details := make(map[string]float64)
-	rows, err := r.DB.Query(`SELECT member_id, amount FROM transaction_details WHERE transaction_id = $1`, id)
+func (r *TransactionRepository) GetDetails(id string) (map[string]Money, error) {
+	details := make(map[string]Money)
+	rows, err := r.DB.Query(`SELECT td.member_id, td.amount, t.currency FROM transaction_details td
+       JOIN transactions t ON t.id = td.transaction_id WHERE td.transaction_id = $1`, id)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		var mid string
-		var amt float64
-		if err := rows.Scan(&mid, &amt); err != nil {
+		var amt Money
+		if err := rows.Scan(&mid, &amt.Amount, &amt.Currency); err != nil {
 			return nil, err
 		}
 		details[mid] = amt
@@ -132,21 +282,15 @@ func (r *TransactionRepository) Delete(id string) error {
 }
 
 func (r *TransactionRepository) UpdateTransaction(payload UpdateTransactionPayload) error {
-	tx, err := r.DB.Begin()
-	if err != nil {
-		return err
-	}
-	defer tx.Rollback()
-
 	// Lấy block_id của transaction hiện tại
 	var blockID string
-	err = tx.QueryRow(`SELECT block_id FROM transactions WHERE id = $1`, payload.ID).Scan(&blockID)
+	err := r.DB.QueryRow(`SELECT block_id FROM transactions WHERE id = $1`, payload.ID).Scan(&blockID)
 	if err != nil {
 		return fmt.Errorf("failed to get block_id: %w", err)
 	}
 
 	var lock bool
-	err = tx.QueryRow(`SELECT locked FROM blocks WHERE id = $1`, blockID).Scan(&lock)
+	err = r.DB.QueryRow(`SELECT locked FROM blocks WHERE id = $1`, blockID).Scan(&lock)
 	if err != nil || lock {
 		return fmt.Errorf("failed to get block or block is locking: %w", err)
 	}
@@ -156,62 +300,96 @@ func (r *TransactionRepository) UpdateTransaction(payload UpdateTransactionPaylo
 	if err != nil {
 		return err
 	}
-
-	_, err = tx.Exec(`UPDATE transactions SET description=$1, amount=$2, payer=$3, ratios=$4 WHERE id=$5`,
-		payload.Description, payload.Amount, payload.Payer, ratiosJSON, payload.ID)
+	splitJSON, err := marshalSplit(payload.Split)
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(`DELETE FROM transaction_details WHERE transaction_id=$1`, payload.ID)
+	_, err = r.DB.Exec(`UPDATE transactions SET description=$1, amount=$2, payer=$3, ratios=$4, split_mode=$5, split=$6,
+       original_amount=$7, original_currency=$8, fx_rate=$9 WHERE id=$10`,
+		payload.Description, payload.Amount.Amount, payload.Payer, ratiosJSON, splitModeOrDefault(payload.SplitMode),
+		splitJSON, payload.OriginalAmount.Amount, currencyOrDefault(payload.OriginalAmount.Currency),
+		rateOrOne(payload.FXRate), payload.ID)
 	if err != nil {
 		return err
 	}
 
-	var totalRatio float64
-	for _, ratio := range payload.Ratios {
-		totalRatio += ratio
-	}
-	if totalRatio == 0 {
-		return fmt.Errorf("total ratio cannot be zero")
+	_, err = r.DB.Exec(`DELETE FROM transaction_details WHERE transaction_id=$1`, payload.ID)
+	if err != nil {
+		return err
 	}
 
-	for memberID, ratio := range payload.Ratios {
-		amount := payload.Amount * (ratio / totalRatio)
-		_, err = tx.Exec(
+	for memberID, amount := range payload.Details {
+		_, err = r.DB.Exec(
 			`INSERT INTO transaction_details (transaction_id, member_id, amount) VALUES ($1, $2, $3)`,
-			payload.ID, memberID, amount,
+			payload.ID, memberID, amount.Amount,
 		)
 		if err != nil {
 			return err
 		}
 	}
+	return nil
+}
 
-	if err := r.UpdateMembersDebtTx(tx, blockID); err != nil {
-		return err
+// ledgerDebt is the debt of member m as the documents have it: what the
+// member paid minus their shares, plus settlement payments made minus
+// received, plus balances carried in minus balances carried out.
+const ledgerDebt = `COALESCE((
+		SELECT SUM(t.amount) FROM transactions t
+		WHERE t.block_id = m.block_id AND t.payer = m.id
+	), 0) - COALESCE((
+		SELECT SUM(td.amount)
+		FROM transaction_details td
+		JOIN transactions t2 ON td.transaction_id = t2.id
+		WHERE t2.block_id = m.block_id AND td.member_id = m.id
+	), 0) + COALESCE((
+		SELECT SUM(s.amount) FROM settlements s
+		WHERE s.block_id = m.block_id AND s.payer = m.id
+	), 0) - COALESCE((
+		SELECT SUM(s.amount) FROM settlements s
+		WHERE s.block_id = m.block_id AND s.payee = m.id
+	), 0) + COALESCE((
+		SELECT SUM(ob.amount) FROM opening_balances ob WHERE ob.member_id = m.id
+	), 0) - COALESCE((
+		SELECT SUM(ob.amount) FROM opening_balances ob WHERE ob.from_member_id = m.id
+	), 0)`
+
+func currencyOrDefault(currency string) string {
+	if currency == "" {
+		return DefaultCurrency
 	}
+	return currency
+}
 
-	return tx.Commit()
-}
-
-func (r *TransactionRepository) UpdateMembersDebtTx(tx *sql.Tx, blockID string) error {
-	_, err := tx.Exec(`
-		UPDATE members m
-		SET debt = COALESCE((
-			SELECT SUM(
-				CASE 
-					WHEN t.payer = m.id THEN t.amount
-					ELSE 0
-				END
-			) - COALESCE((
-				SELECT SUM(td.amount)
-				FROM transaction_details td
-				JOIN transactions t2 ON td.transaction_id = t2.id
-				WHERE t2.block_id = m.block_id AND td.member_id = m.id
-			), 0)
-			FROM transactions t
-			WHERE t.block_id = m.block_id
-		), 0)
-		WHERE m.block_id = $1`, blockID)
-	return err
+func rateOrOne(rate json.Number) string {
+	if rate == "" {
+		return "1"
+	}
+	return rate.String()
+}
+
+func splitModeOrDefault(mode string) string {
+	if mode == "" {
+		return SplitShares
+	}
+	return mode
+}
+
+// marshalSplit stores a nil split as SQL NULL.
+func marshalSplit(s *Split) ([]byte, error) {
+	if s == nil {
+		return nil, nil
+	}
+	return json.Marshal(s)
+}
+
+func unmarshalSplit(data []byte) (*Split, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var s Split
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
 }
@@ -0,0 +1,143 @@
+package repository_test
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"my-source/sheet-payment/be/repository"
+	"my-source/sheet-payment/be/repository/repositorytest"
+)
+
+// BenchmarkGetByBlockID lists a busy month: 500 transactions shared by four
+// members, next to a second block of the same size. path=per-transaction is
+// the baseline GetByBlockID replaced, which read each transaction's details
+// with its own query while the outer cursor was open; compare the two with
+// benchstat -col /path.
+func BenchmarkGetByBlockID(b *testing.B) {
+	url := "sqlite://" + b.TempDir() + "/expenses.db"
+	backend := sqlBackend(b, url)
+	group, err := repositorytest.NewGroup(backend)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	var blockID string
+	for _, month := range []string{"2099-01", "2099-02"} {
+		block := repository.Block{ID: uuid.New().String(), GroupID: group, Month: month, BaseCurrency: "USD"}
+		for i := range 4 {
+			p, err := backend.People.GetOrCreateByName(group, fmt.Sprintf("Member %d", i))
+			if err != nil {
+				b.Fatal(err)
+			}
+			block.Members = append(block.Members, &repository.Member{PersonID: p.ID, Name: p.Name, Ratio: 1})
+		}
+		if err := backend.Blocks.Create(block); err != nil {
+			b.Fatal(err)
+		}
+		blockID = block.ID
+
+		err := backend.UnitOfWork.Do(func(r repository.Repositories) error {
+			start := time.Now()
+			for i := range 500 {
+				tx := repository.Transaction{
+					ID:        uuid.New().String(),
+					BlockID:   block.ID,
+					Amount:    repository.NewMoney(400, "USD"),
+					Payer:     block.Members[i%4].ID,
+					Ratios:    map[string]float64{},
+					CreatedAt: start.Add(time.Duration(i) * time.Minute),
+				}
+				if err := r.Transactions.Add(tx); err != nil {
+					return err
+				}
+				details := map[string]repository.Money{}
+				for _, m := range block.Members {
+					details[m.ID] = repository.NewMoney(100, "USD")
+				}
+				if err := r.Transactions.AddDetails(tx.ID, details); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Run("path=single", func(b *testing.B) {
+		for b.Loop() {
+			txs, err := backend.Transactions.GetByBlockID(blockID)
+			if err != nil || len(txs) != 500 || len(txs[0].Details) != 4 {
+				b.Fatalf("GetByBlockID = %d transactions, %v", len(txs), err)
+			}
+		}
+	})
+
+	driver, dsn := repository.ParseDatabaseURL(url)
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+	q := repository.Bind(db, driver)
+	b.Run("path=per-transaction", func(b *testing.B) {
+		for b.Loop() {
+			txs, err := detailsPerTransaction(q, blockID)
+			if err != nil || len(txs) != 500 || len(txs[0].Details) != 4 {
+				b.Fatalf("detailsPerTransaction = %d transactions, %v", len(txs), err)
+			}
+		}
+	})
+}
+
+// detailsPerTransaction reads the block's transactions the way GetByBlockID
+// did before it joined the details: one query per transaction.
+func detailsPerTransaction(q repository.DBTX, blockID string) ([]repository.Transaction, error) {
+	rows, err := q.Query(`SELECT id, description, amount, currency, payer, created_at, ratios, split_mode, split,
+       original_amount, original_currency, fx_rate FROM transactions WHERE block_id = $1
+       ORDER BY created_at, id`, blockID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var txs []repository.Transaction
+	for rows.Next() {
+		var tx repository.Transaction
+		var ratiosJSON, splitJSON []byte
+		var fxRate string
+		if err := rows.Scan(&tx.ID, &tx.Description, &tx.Amount.Amount, &tx.Amount.Currency, &tx.Payer,
+			&tx.CreatedAt, &ratiosJSON, &tx.SplitMode, &splitJSON, &tx.OriginalAmount.Amount, &tx.OriginalCurrency,
+			&fxRate); err != nil {
+			return nil, err
+		}
+		tx.FXRate = json.Number(fxRate)
+		if err := json.Unmarshal(ratiosJSON, &tx.Ratios); err != nil {
+			return nil, err
+		}
+
+		detailRows, err := q.Query(`SELECT member_id, amount FROM transaction_details WHERE transaction_id = $1`,
+			tx.ID)
+		if err != nil {
+			return nil, err
+		}
+		tx.Details = map[string]repository.Money{}
+		for detailRows.Next() {
+			var memberID string
+			var amount int64
+			if err := detailRows.Scan(&memberID, &amount); err != nil {
+				detailRows.Close()
+				return nil, err
+			}
+			tx.Details[memberID] = repository.NewMoney(amount, tx.Amount.Currency)
+		}
+		detailRows.Close()
+		txs = append(txs, tx)
+	}
+	return txs, rows.Err()
+}
@@ -0,0 +1,94 @@
+package repository
+
+import "database/sql"
+
+// DBTX is the subset of *sql.DB and *sql.Tx used by the repositories, so the
+// same repository code can run either standalone or inside a transaction.
+type DBTX interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+	Prepare(query string) (*sql.Stmt, error)
+}
+
+// Repositories groups the repositories bound to a single unit of work.
+type Repositories struct {
+	Blocks       IBlockRepository
+	Members      IMemberRepository
+	Transactions ITransactionRepository
+	Settlements  ISettlementRepository
+	Openings     IOpeningBalanceRepository
+	People       IPersonRepository
+	Ledger       ILedgerRepository
+	FXRates      IFXRateRepository
+}
+
+type UnitOfWork struct {
+	DB     *sql.DB
+	Driver string
+}
+
+func NewUnitOfWork(db *sql.DB, driver string) *UnitOfWork {
+	return &UnitOfWork{DB: db, Driver: driver}
+}
+
+// Do runs fn with repositories sharing one *sql.Tx. The transaction is
+// committed when fn returns nil and rolled back otherwise.
+func (u *UnitOfWork) Do(fn func(r Repositories) error) error {
+	tx, err := u.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	q := Bind(tx, u.Driver)
+	if err := fn(Repositories{
+		Blocks:       NewBlockRepository(q),
+		Members:      NewMemberRepository(q),
+		Transactions: NewTransactionRepository(q),
+		Settlements:  NewSettlementRepository(q),
+		Openings:     NewOpeningBalanceRepository(q),
+		People:       NewPersonRepository(q),
+		Ledger:       NewLedgerRepository(q),
+		FXRates:      NewFXRateRepository(q),
+	}); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// inTx runs fn in a transaction of its own unless db already belongs to one,
+// for writes that must not be seen half done.
+func inTx(db DBTX, fn func(q DBTX) error) error {
+	var conn *sql.DB
+	bind := func(tx *sql.Tx) DBTX { return tx }
+	switch d := db.(type) {
+	case *sql.DB:
+		conn = d
+	case sqliteDB:
+		if inner, ok := d.db.(*sql.DB); ok {
+			conn = inner
+			bind = func(tx *sql.Tx) DBTX { return sqliteDB{db: tx} }
+		}
+	}
+	if conn == nil {
+		return fn(db)
+	}
+
+	tx, err := conn.Begin()
+	if err != nil {
+		return err
+	}
+	if err := fn(bind(tx)); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -3,17 +3,17 @@ package repository
 import "database/sql"
 
 type UserRepository struct {
-	DB *sql.DB
+	DB DBTX
 }
 
-func NewUserRepository(db *sql.DB) *UserRepository {
+func NewUserRepository(db DBTX) *UserRepository {
 	return &UserRepository{DB: db}
 }
 
 func (r *UserRepository) GetByUsername(username string) (*User, error) {
-	row := r.DB.QueryRow(`SELECT id, username, password FROM users WHERE username = $1`, username)
+	row := r.DB.QueryRow(`SELECT id, username, password, role FROM users WHERE username = $1`, username)
 	var u User
-	err := row.Scan(&u.ID, &u.Username, &u.Password)
+	err := row.Scan(&u.ID, &u.Username, &u.Password, &u.Role)
 	if err != nil {
 		return nil, err
 	}
@@ -21,7 +21,49 @@ func (r *UserRepository) GetByUsername(username string) (*User, error) {
 }
 
 func (r *UserRepository) Create(user *User) error {
-	_, err := r.DB.Exec(`INSERT INTO users (id, username, password) VALUES ($1, $2, $3)`,
-		user.ID, user.Username, user.Password)
+	_, err := r.DB.Exec(`INSERT INTO users (id, username, password, role) VALUES ($1, $2, $3, $4)`,
+		user.ID, user.Username, user.Password, roleOrDefault(user.Role))
 	return err
 }
+
+// GetAll returns every user ordered by username.
+func (r *UserRepository) GetAll() ([]User, error) {
+	rows, err := r.DB.Query(`SELECT id, username, password, role FROM users ORDER BY username`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Password, &u.Role); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// SetRole changes the user's role. It returns sql.ErrNoRows for an unknown
+// user.
+func (r *UserRepository) SetRole(username, role string) error {
+	res, err := r.DB.Exec(`UPDATE users SET role = $1 WHERE username = $2`, role, username)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// roleOrDefault gives users created without a role the least privileged one.
+func roleOrDefault(role string) string {
+	if role == "" {
+		return RoleViewer
+	}
+	return role
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+
+	"my-source/sheet-payment/be/config"
+	"my-source/sheet-payment/be/repository"
+)
+
+const userUsage = "usage: user role <username> viewer|editor|admin"
+
+// runUser handles `user role <username> <role>`, which sets a user's role
+// without an admin token, e.g. to promote the first admin of an upgraded
+// database.
+func runUser(args []string) {
+	if len(args) != 3 || args[0] != "role" || !slices.Contains(repository.Roles, args[2]) {
+		fmt.Fprintln(os.Stderr, userUsage)
+		os.Exit(2)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("config: %v", err)
+	}
+	db, driver := repository.OpenDB(cfg.DatabaseURL)
+	defer db.Close()
+
+	username, role := args[1], args[2]
+	err = repository.NewUserRepository(repository.Bind(db, driver)).SetRole(username, role)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Fatalf("no user %q", username)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Printf("%s\t%s\n", username, role)
+}
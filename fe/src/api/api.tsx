@@ -6,18 +6,67 @@ const api = axios.create({
     baseURL: API_URL,
 });
 
-// Interceptor: tự động thêm Authorization header cho mỗi request
+// Interceptor: tự động thêm Authorization header cho mỗi request, và nhóm
+// đang chọn để server biết các tháng thuộc nhóm nào
 api.interceptors.request.use((config) => {
     const token = localStorage.getItem("token");
     if (token) {
         config.headers.Authorization = `Bearer ${token}`;
     }
+    const group = localStorage.getItem("group_id");
+    if (group) {
+        config.headers["X-Group-ID"] = group;
+    }
     return config;
 });
 
+// Access tokens are short-lived: on a 401, trade the refresh token for a new
+// pair once and retry. Concurrent requests share the same refresh.
+let refreshing: Promise<string> | null = null;
+
+const refreshToken = async () => {
+    const refresh = localStorage.getItem("refresh_token");
+    if (!refresh) {
+        throw new Error("no refresh token");
+    }
+    const res = await axios.post(`${API_URL}/auth/refresh`, { refresh_token: refresh });
+    localStorage.setItem("token", res.data.token);
+    localStorage.setItem("refresh_token", res.data.refresh_token);
+    localStorage.setItem("role", res.data.role);
+    return res.data.token as string;
+};
+
+api.interceptors.response.use(undefined, async (error) => {
+    const config = error.config;
+    if (error.response?.status !== 401 || !config || config._retried) {
+        throw error;
+    }
+    config._retried = true;
+    try {
+        refreshing = refreshing || refreshToken().finally(() => { refreshing = null; });
+        const token = await refreshing;
+        config.headers.Authorization = `Bearer ${token}`;
+        return api(config);
+    } catch {
+        localStorage.removeItem("refresh_token");
+        throw error;
+    }
+});
+
 // Transactions
-export const getTransactions = (month: string) =>
-    api.get(`/blocks/${month}/transactions`);
+// The listing is paginated; follow next_cursor to load the whole block.
+export const getTransactions = async (month: string) => {
+    const transactions: any[] = [];
+    let cursor = "";
+    do {
+        const res = await api.get(`/blocks/${month}/transactions`, {
+            params: { limit: 200, cursor: cursor || undefined },
+        });
+        transactions.push(...(res.data.transactions || []));
+        cursor = res.data.next_cursor;
+    } while (cursor);
+    return { data: transactions };
+};
 
 export const getMembers = (month: string) =>
     api.get(`/blocks/${month}/members`);
@@ -35,6 +84,26 @@ export const addTransaction = (
 export const deleteTransaction = (id: string) =>
     api.delete(`/transactions/${id}`);
 
+// Groups
+export const getGroups = () => api.get("/groups");
+
+export const createGroup = (name: string) => api.post("/groups", { name });
+
+// Later requests work in the selected group, with the user's role in it.
+export const selectGroup = (group: { id: string; role: string }) => {
+    localStorage.setItem("group_id", group.id);
+    localStorage.setItem("group_role", group.role);
+};
+
+// The signed-in user's people, across every group
+export const getMyBalances = () => api.get("/me/balances");
+
+export const getMyTransactions = (cursor?: string) =>
+    api.get("/me/transactions", { params: { cursor: cursor || undefined } });
+
+export const linkPerson = (personId: string, username: string) =>
+    api.put(`/people/${personId}/user`, { username });
+
 // Blocks
 export const getBlocks = () => api.get("/blocks");
 
@@ -43,8 +112,12 @@ export const createBlock = (month: string, members: string[]) => {
     return api.post("/blocks", { month, members: memberArray });
 };
 
-export const toggleLock = (month: string, locked: boolean) =>
-    api.post(`/blocks/${month}/${locked ? "unlock" : "lock"}`, {});
+// Locking refuses with 409 and the reconcile report while balances have
+// drifted from the ledger; repair fixes them first.
+export const toggleLock = (month: string, locked: boolean, repair = false) =>
+    api.post(`/blocks/${month}/${locked ? "unlock" : "lock"}`, {}, {
+        params: repair ? { repair: true } : undefined,
+    });
 
 // Auth
 export const login = async (username: string, password: string) => {
@@ -60,26 +133,46 @@ export const login = async (username: string, password: string) => {
     }
 
     localStorage.setItem("token", data.token);
+    localStorage.setItem("refresh_token", data.refresh_token);
+    localStorage.setItem("role", data.role);
     localStorage.setItem("username", username);
     return data.token;
 };
 
+// Revokes the session's tokens on the server and drops the local copies.
+export const logout = async () => {
+    try {
+        await api.post("/auth/logout", { refresh_token: localStorage.getItem("refresh_token") || "" });
+    } catch {
+        // An expired session has nothing left to revoke.
+    } finally {
+        localStorage.removeItem("token");
+        localStorage.removeItem("refresh_token");
+        localStorage.removeItem("role");
+        localStorage.removeItem("group_id");
+        localStorage.removeItem("group_role");
+    }
+};
+
+// The server enforces roles; these only hide actions the user cannot take.
+const roles = ["viewer", "editor", "admin"];
+
+export const hasRole = (min: string) =>
+    roles.indexOf(localStorage.getItem("role") || "") >= roles.indexOf(min);
+
+// Months belong to a group, so what the user may do with them depends on
+// the role in the selected group.
+export const hasGroupRole = (min: string) =>
+    roles.indexOf(localStorage.getItem("group_role") || "") >= roles.indexOf(min);
+
 export const updateTransaction = (id: string, payload: {
     description: string;
     amount: number;
     payer: string;
     ratios: Record<string, number>;
 }) => {
-    return axios.put(`${API_URL}/transactions/${id}`, payload, {
-        headers: {
-            Authorization: `Bearer ${localStorage.getItem("token")}`,
-        },
-    });
+    return api.put(`/transactions/${id}`, payload);
 };
 
 export const deleteBlock = (month: string) =>
-    axios.delete(`${API_URL}/blocks/${month}`, {
-        headers: {
-            Authorization: `Bearer ${localStorage.getItem("token")}`,
-        },
-    });
\ No newline at end of file
+    api.delete(`/blocks/${month}`);
\ No newline at end of file
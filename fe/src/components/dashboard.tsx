@@ -19,19 +19,35 @@ import {
     DialogActions,
     IconButton,
     Tooltip,
+    Select,
+    MenuItem,
 } from "@mui/material";
 import LockIcon from "@mui/icons-material/Lock";
 import LockOpenIcon from "@mui/icons-material/LockOpen";
 import DeleteIcon from "@mui/icons-material/Delete";
-import { getBlocks, createBlock, toggleLock, deleteBlock } from "../api/api";
+import {
+    getBlocks,
+    createBlock,
+    toggleLock,
+    deleteBlock,
+    logout,
+    hasRole,
+    hasGroupRole,
+    getGroups,
+    createGroup,
+    selectGroup,
+} from "../api/api";
 
 export default function Dashboard() {
     const [blocks, setBlocks] = useState<any[]>([]);
+    const [groups, setGroups] = useState<any[]>([]);
+    const [groupId, setGroupId] = useState(localStorage.getItem("group_id") || "");
     const [loading, setLoading] = useState(true);
     const [open, setOpen] = useState(false);
     const [month, setMonth] = useState("");
     const [members, setMembers] = useState("");
     const username = localStorage.getItem("username") || "User";
+    const isAdmin = hasGroupRole("admin");
     const navigate = useNavigate();
 
     const fetchBlocks = () => {
@@ -51,10 +67,51 @@ export default function Dashboard() {
             .finally(() => setLoading(false));
     };
 
+    // Keep the stored group if the user is still in it, otherwise start with
+    // the first one.
+    const fetchGroups = (prefer = groupId) => {
+        getGroups()
+            .then((res) => {
+                const list = Array.isArray(res.data) ? res.data : [];
+                setGroups(list);
+                const group = list.find((g: any) => g.id === prefer) || list[0];
+                if (!group) {
+                    setBlocks([]);
+                    setLoading(false);
+                    return;
+                }
+                selectGroup(group);
+                setGroupId(group.id);
+                fetchBlocks();
+            })
+            .catch((err) => {
+                console.error("Failed to load groups", err);
+                setLoading(false);
+            });
+    };
+
     useEffect(() => {
-        fetchBlocks();
+        fetchGroups();
     }, []);
 
+    const handleSelectGroup = (id: string) => {
+        const group = groups.find((g) => g.id === id);
+        if (group) {
+            selectGroup(group);
+            setGroupId(id);
+            fetchBlocks();
+        }
+    };
+
+    const handleCreateGroup = () => {
+        const name = window.prompt("Tên nhóm mới");
+        if (name) {
+            createGroup(name)
+                .then((res) => fetchGroups(res.data.id))
+                .catch((err) => console.error("Failed to create group", err));
+        }
+    };
+
     const handleCreateBlock = () => {
         createBlock(month, members.split(","))
             .then(() => {
@@ -68,6 +125,13 @@ export default function Dashboard() {
 
     const handleToggleLock = (month: string, locked: boolean) => {
         toggleLock(month, locked)
+            .catch(err => {
+                const drifted = err.response?.status === 409 && err.response.data?.discrepancies?.length;
+                if (drifted && window.confirm(`Số dư tháng ${month} lệch so với sổ cái. Sửa lại rồi khóa?`)) {
+                    return toggleLock(month, locked, true);
+                }
+                throw err;
+            })
             .then(fetchBlocks)
             .catch(err => console.error("Failed to toggle lock", err));
     };
@@ -93,14 +157,34 @@ export default function Dashboard() {
                 <Toolbar sx={{ display: "flex", justifyContent: "space-between" }}>
                     <Typography variant="h6">Home</Typography>
                     <Box display="flex" alignItems="center" gap={2}>
+                        {groups.length > 0 && (
+                            <Select
+                                size="small"
+                                value={groupId}
+                                onChange={(e) => handleSelectGroup(e.target.value as string)}
+                                sx={{ color: "inherit", backgroundColor: "rgba(255,255,255,0.15)" }}
+                            >
+                                {groups.map((g) => (
+                                    <MenuItem key={g.id} value={g.id}>
+                                        {g.name}
+                                    </MenuItem>
+                                ))}
+                            </Select>
+                        )}
+                        {hasRole("editor") && (
+                            <Button color="inherit" onClick={handleCreateGroup}>
+                                Tạo nhóm
+                            </Button>
+                        )}
                         <Typography variant="subtitle1" component="span">
                             Chào, {username}
                         </Typography>
                         <Button
                             color="inherit"
                             onClick={() => {
-                                localStorage.removeItem("token");
-                                window.location.href = "/login";
+                                logout().finally(() => {
+                                    window.location.href = "/login";
+                                });
                             }}
                         >
                             Đăng xuất
@@ -140,34 +224,36 @@ export default function Dashboard() {
                                             primary={`${i + 1}. Tháng: ${block.month}`}
                                             secondary={block.locked ? "Đã khóa" : "Chưa khóa"}
                                         />
-                                        <Box display="flex" alignItems="center" gap={1}>
-                                            <Tooltip title={block.locked ? "Mở khóa tháng này" : "Khóa tháng này"}>
-                                                <IconButton
-                                                    edge="end"
-                                                    onClick={(e) => {
-                                                        e.stopPropagation();
-                                                        handleToggleLock(block.month, block.locked);
-                                                    }}
-                                                >
-                                                    {block.locked ? (
-                                                        <LockIcon color="error" />
-                                                    ) : (
-                                                        <LockOpenIcon color="success" />
-                                                    )}
-                                                </IconButton>
-                                            </Tooltip>
-                                            <Tooltip title="Xóa tháng này">
-                                                <IconButton
-                                                    edge="end"
-                                                    onClick={(e) => {
-                                                        e.stopPropagation();
-                                                        handleDeleteBlock(block.id);
-                                                    }}
-                                                >
-                                                    <DeleteIcon color="error" />
-                                                </IconButton>
-                                            </Tooltip>
-                                        </Box>
+                                        {isAdmin && (
+                                            <Box display="flex" alignItems="center" gap={1}>
+                                                <Tooltip title={block.locked ? "Mở khóa tháng này" : "Khóa tháng này"}>
+                                                    <IconButton
+                                                        edge="end"
+                                                        onClick={(e) => {
+                                                            e.stopPropagation();
+                                                            handleToggleLock(block.month, block.locked);
+                                                        }}
+                                                    >
+                                                        {block.locked ? (
+                                                            <LockIcon color="error" />
+                                                        ) : (
+                                                            <LockOpenIcon color="success" />
+                                                        )}
+                                                    </IconButton>
+                                                </Tooltip>
+                                                <Tooltip title="Xóa tháng này">
+                                                    <IconButton
+                                                        edge="end"
+                                                        onClick={(e) => {
+                                                            e.stopPropagation();
+                                                            handleDeleteBlock(block.id);
+                                                        }}
+                                                    >
+                                                        <DeleteIcon color="error" />
+                                                    </IconButton>
+                                                </Tooltip>
+                                            </Box>
+                                        )}
                                     </ListItemButton>
                                 ))
                             ) : (
@@ -177,15 +263,17 @@ export default function Dashboard() {
                                     align="center"
                                     sx={{ mt: 2 }}
                                 >
-                                    Không có tháng nào được tạo
+                                    {groups.length > 0 ? "Không có tháng nào được tạo" : "Bạn chưa thuộc nhóm nào"}
                                 </Typography>
                             )}
                         </List>
-                        <Box mt={2} textAlign="center">
-                            <Button variant="contained" color="secondary" onClick={() => setOpen(true)}>
-                                Tạo tháng mới
-                            </Button>
-                        </Box>
+                        {groups.length > 0 && hasGroupRole("editor") && (
+                            <Box mt={2} textAlign="center">
+                                <Button variant="contained" color="secondary" onClick={() => setOpen(true)}>
+                                    Tạo tháng mới
+                                </Button>
+                            </Box>
+                        )}
                     </CardContent>
                 </Card>
             </Box>